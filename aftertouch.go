@@ -0,0 +1,179 @@
+package octane
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"gitlab.com/gomidi/midi/v2"
+)
+
+// AftertouchPoly converts channel aftertouch into poly aftertouch for each held note.
+const AftertouchPoly = "poly"
+
+// AftertouchCC converts channel aftertouch into a control change.
+const AftertouchCC = "cc"
+
+// AftertouchMax converts poly aftertouch into channel aftertouch, by the greatest pressure.
+const AftertouchMax = "max"
+
+// AftertouchAverage converts poly aftertouch into channel aftertouch, by the mean pressure.
+const AftertouchAverage = "average"
+
+// ParseAftertouch reads a "poly", "cc:<controller>", "max", or "average" aftertouch conversion.
+func ParseAftertouch(s string) (Aftertouch, error) {
+	var aftertouch Aftertouch
+
+	if before, after, found := strings.Cut(s, ":"); found {
+		cc, err := strconv.ParseUint(after, 10, 8)
+
+		if err != nil {
+			return Aftertouch{}, fmt.Errorf("invalid MIDI controller: %v", after)
+		}
+
+		controller := uint8(cc)
+		aftertouch.Mode = before
+		aftertouch.CC = &controller
+	} else {
+		aftertouch.Mode = s
+	}
+
+	return aftertouch, aftertouch.Validate()
+}
+
+// Aftertouch converts between channel aftertouch, poly aftertouch, and control changes.
+type Aftertouch struct {
+	// Channel selects the source channel (1-16).
+	// Zero matches any channel.
+	Channel uint8 `json:"channel,omitempty"`
+
+	// Mode denotes the conversion (AftertouchPoly, AftertouchCC, AftertouchMax, or AftertouchAverage).
+	Mode string `json:"mode"`
+
+	// CC selects the target controller, required in AftertouchCC mode and unused otherwise.
+	CC *uint8 `json:"cc,omitempty"`
+}
+
+// Validate checks the conversion for unsupported modes and out of range fields.
+func (o Aftertouch) Validate() error {
+	if o.Channel > 16 {
+		return fmt.Errorf("aftertouch has invalid MIDI channel: %v", o.Channel)
+	}
+
+	switch o.Mode {
+	case AftertouchCC:
+		if o.CC == nil {
+			return fmt.Errorf("aftertouch cc requires a MIDI controller")
+		}
+
+		if *o.CC > 127 {
+			return fmt.Errorf("aftertouch has invalid MIDI controller: %v", *o.CC)
+		}
+
+		return nil
+	case AftertouchPoly, AftertouchMax, AftertouchAverage:
+		if o.CC != nil {
+			return fmt.Errorf("aftertouch %v takes no MIDI controller", o.Mode)
+		}
+
+		return nil
+	default:
+		return fmt.Errorf("unsupported aftertouch mode: %v", o.Mode)
+	}
+}
+
+// Transformer prepares a stateful conversion.
+func (o Aftertouch) Transformer() Transformer {
+	return &aftertouch{Aftertouch: o}
+}
+
+// aftertouch tracks held notes and their pressures.
+type aftertouch struct {
+	Aftertouch
+
+	mutex sync.Mutex
+
+	held [16][128]bool
+
+	pressures [16][128]uint8
+}
+
+// Transform converts matching aftertouch messages.
+func (o *aftertouch) Transform(msg midi.Message, emit func(midi.Message)) {
+	var channel uint8
+	var key uint8
+	var velocity uint8
+	var pressure uint8
+
+	if msg.GetChannel(&channel) && !matchesChannel(o.Channel, channel) {
+		emit(msg)
+		return
+	}
+
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	switch {
+	case msg.GetNoteStart(&channel, &key, &velocity):
+		o.held[channel][key] = true
+		o.pressures[channel][key] = 0
+		emit(msg)
+	case msg.GetNoteEnd(&channel, &key):
+		hadPressure := o.pressures[channel][key] != 0
+		o.held[channel][key] = false
+		o.pressures[channel][key] = 0
+		emit(msg)
+
+		if hadPressure && (o.Mode == AftertouchMax || o.Mode == AftertouchAverage) {
+			emit(midi.AfterTouch(channel, o.aggregate(channel)))
+		}
+	case msg.GetAfterTouch(&channel, &pressure):
+		switch o.Mode {
+		case AftertouchPoly:
+			for k, held := range o.held[channel] {
+				if held {
+					emit(midi.PolyAfterTouch(channel, uint8(k), pressure))
+				}
+			}
+		case AftertouchCC:
+			emit(midi.ControlChange(channel, *o.CC, pressure))
+		default:
+			emit(msg)
+		}
+	case msg.GetPolyAfterTouch(&channel, &key, &pressure):
+		switch o.Mode {
+		case AftertouchMax, AftertouchAverage:
+			o.pressures[channel][key] = pressure
+			emit(midi.AfterTouch(channel, o.aggregate(channel)))
+		default:
+			emit(msg)
+		}
+	default:
+		emit(msg)
+	}
+}
+
+// aggregate combines the poly pressures of held notes on a channel.
+func (o *aftertouch) aggregate(channel uint8) uint8 {
+	var greatest uint8
+	var sum int
+	var count int
+
+	for k, held := range o.held[channel] {
+		if !held {
+			continue
+		}
+
+		p := o.pressures[channel][k]
+		greatest = max(greatest, p)
+		sum += int(p)
+		count++
+	}
+
+	if o.Mode == AftertouchMax || count == 0 {
+		return greatest
+	}
+
+	return uint8(sum / count)
+}
@@ -0,0 +1,70 @@
+package octane_test
+
+import (
+	"testing"
+
+	"github.com/mcandre/octane"
+	"gitlab.com/gomidi/midi/v2"
+)
+
+func TestAftertouchPoly(t *testing.T) {
+	aftertouch := octane.Aftertouch{Mode: octane.AftertouchPoly}.Transformer()
+	var got []midi.Message
+	emit := func(msg midi.Message) { got = append(got, msg) }
+
+	aftertouch.Transform(midi.NoteOn(0, 60, 100), emit)
+	aftertouch.Transform(midi.NoteOn(0, 64, 100), emit)
+	aftertouch.Transform(midi.NoteOff(0, 60), emit)
+	got = nil
+	aftertouch.Transform(midi.AfterTouch(0, 50), emit)
+
+	if len(got) != 1 || got[0].String() != midi.PolyAfterTouch(0, 64, 50).String() {
+		t.Errorf("expected poly aftertouch for held key 64, got %v", got)
+	}
+}
+
+func TestAftertouchAverage(t *testing.T) {
+	aftertouch := octane.Aftertouch{Mode: octane.AftertouchAverage}.Transformer()
+	var got []midi.Message
+	emit := func(msg midi.Message) { got = append(got, msg) }
+
+	aftertouch.Transform(midi.NoteOn(0, 60, 100), emit)
+	aftertouch.Transform(midi.NoteOn(0, 64, 100), emit)
+	aftertouch.Transform(midi.PolyAfterTouch(0, 60, 40), emit)
+	aftertouch.Transform(midi.PolyAfterTouch(0, 64, 80), emit)
+
+	var pressure uint8
+
+	if !got[len(got)-1].GetAfterTouch(nil, &pressure) || pressure != 60 {
+		t.Errorf("expected average pressure 60, got %v", got[len(got)-1])
+	}
+}
+
+func TestParseAftertouch(t *testing.T) {
+	aftertouch, err := octane.ParseAftertouch("cc:2")
+
+	if err != nil {
+		t.Error(err)
+	}
+
+	if aftertouch.Mode != octane.AftertouchCC || aftertouch.CC == nil || *aftertouch.CC != 2 {
+		t.Errorf("expected cc mode for controller 2, got %v", aftertouch)
+	}
+
+	for _, s := range []string{"sideways", "cc", "cc:128", "poly:5", "max:9"} {
+		if _, err2 := octane.ParseAftertouch(s); err2 == nil {
+			t.Errorf("expected error for %q", s)
+		}
+	}
+
+	cc := uint8(2)
+
+	for _, aftertouch := range []octane.Aftertouch{
+		{Mode: octane.AftertouchCC},
+		{Mode: octane.AftertouchAverage, CC: &cc},
+	} {
+		if err2 := aftertouch.Validate(); err2 == nil {
+			t.Errorf("expected error for %v", aftertouch)
+		}
+	}
+}
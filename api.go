@@ -0,0 +1,256 @@
+package octane
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+)
+
+// MonitorBufferSize denotes how many monitor events queue per client before dropping.
+const MonitorBufferSize = 256
+
+// APIRequest models the body of API POST requests.
+// Each endpoint reads its own field.
+type APIRequest struct {
+	// Transpose denotes a runtime note offset.
+	Transpose *int `json:"transpose,omitempty"`
+
+	// Bypass denotes whether to forward messages without transformations.
+	Bypass *bool `json:"bypass,omitempty"`
+
+	// Preset names a preset. Blank selects the top level settings.
+	Preset *string `json:"preset,omitempty"`
+
+	// Command denotes an Engine command.
+	Command *string `json:"command,omitempty"`
+}
+
+// api serves an Engine over HTTP.
+type api struct {
+	engine *Engine
+
+	ports func() []Probe
+
+	// origins allows web pages on other hosts, like "http://localhost:3000".
+	origins []string
+}
+
+// NewAPIHandler serves a JSON API for monitoring and controlling an Engine:
+//
+// GET /status reports the runtime state and counters.
+// GET /ports lists MIDI devices, as reported by ports.
+// GET /events streams monitored messages as Server-Sent Events,
+// as JSON, or in the text format with ?format=text.
+// GET /ws bridges transformed messages to WebSocket clients, and injects their messages.
+// POST /transpose, /bypass, /preset, and /command adjust settings.
+// POST /panic silences all notes.
+//
+// POST requests respond with the updated status.
+// They require a JSON content type.
+//
+// Browsers may only send POST requests and open /ws from the same host,
+// or from the given origins, like "http://localhost:3000",
+// so that other web pages cannot forge them.
+func NewAPIHandler(engine *Engine, ports func() []Probe, origins ...string) http.Handler {
+	o := api{engine: engine, ports: ports, origins: origins}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /status", o.status)
+	mux.HandleFunc("GET /ports", o.listPorts)
+	mux.HandleFunc("GET /events", o.events)
+	mux.HandleFunc("GET /ws", o.webSocket)
+	mux.HandleFunc("POST /transpose", o.guard(o.update))
+	mux.HandleFunc("POST /bypass", o.guard(o.update))
+	mux.HandleFunc("POST /preset", o.guard(o.update))
+	mux.HandleFunc("POST /command", o.guard(o.update))
+	mux.HandleFunc("POST /panic", o.guard(o.panicAll))
+	return mux
+}
+
+// writeJSON responds with a JSON value.
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
+}
+
+// writeError responds with a JSON error.
+func writeError(w http.ResponseWriter, code int, err error) {
+	writeJSON(w, code, map[string]string{"error": err.Error()})
+}
+
+// trusted reports whether a request comes from a page on the API's own host or an allowed origin,
+// or from a client other than a browser, which sends no Origin header.
+func (o api) trusted(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+
+	if origin == "" || slices.Contains(o.origins, origin) {
+		return true
+	}
+
+	u, err := url.Parse(origin)
+	return err == nil && u.Host == r.Host && localHost(r)
+}
+
+// localHost reports whether a request names the API by a loopback name or by its listening address,
+// rather than by a domain name that a web page could rebind to the API.
+func localHost(r *http.Request) bool {
+	host, _, err := net.SplitHostPort(r.Host)
+
+	if err != nil {
+		host = strings.Trim(r.Host, "[]")
+	}
+
+	if host == "localhost" {
+		return true
+	}
+
+	ip := net.ParseIP(host)
+
+	if ip == nil {
+		return false
+	}
+
+	if ip.IsLoopback() {
+		return true
+	}
+
+	addr, ok := r.Context().Value(http.LocalAddrContextKey).(*net.TCPAddr)
+	return ok && addr.IP.Equal(ip)
+}
+
+// guard rejects POST requests that web pages on other hosts could forge:
+// cross-origin requests, and requests lacking a JSON content type,
+// which HTML forms cannot send.
+func (o api) guard(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !o.trusted(r) {
+			writeError(w, http.StatusForbidden, fmt.Errorf("cross-origin request from %v", r.Header.Get("Origin")))
+			return
+		}
+
+		if mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type")); err != nil || mediaType != "application/json" {
+			writeError(w, http.StatusUnsupportedMediaType, fmt.Errorf("requires Content-Type: application/json"))
+			return
+		}
+
+		handler(w, r)
+	}
+}
+
+// status reports the runtime state.
+func (o api) status(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, o.engine.Status())
+}
+
+// listPorts reports MIDI devices.
+func (o api) listPorts(w http.ResponseWriter, _ *http.Request) {
+	ports := []Probe{}
+
+	if o.ports != nil {
+		ports = append(ports, o.ports()...)
+	}
+
+	writeJSON(w, http.StatusOK, ports)
+}
+
+// update applies the setting named by the request path.
+func (o api) update(w http.ResponseWriter, r *http.Request) {
+	var request APIRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	var err error
+
+	switch {
+	case r.URL.Path == "/transpose" && request.Transpose != nil:
+		o.engine.SetTransposition(*request.Transpose)
+	case r.URL.Path == "/bypass" && request.Bypass != nil:
+		o.engine.SetBypass(*request.Bypass)
+	case r.URL.Path == "/preset" && request.Preset != nil:
+		err = o.engine.SetPreset(*request.Preset)
+	case r.URL.Path == "/command" && request.Command != nil:
+		err = o.engine.Command(*request.Command)
+	default:
+		err = fmt.Errorf("missing field for %v", r.URL.Path)
+	}
+
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	o.status(w, r)
+}
+
+// panicAll silences all notes.
+func (o api) panicAll(w http.ResponseWriter, r *http.Request) {
+	o.engine.Panic()
+	o.status(w, r)
+}
+
+// events streams monitored messages as Server-Sent Events.
+// Slow clients miss events rather than delaying message processing.
+func (o api) events(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+
+	if !ok {
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("streaming unsupported"))
+		return
+	}
+
+	text := r.URL.Query().Get("format") == StdioText
+	var line bytes.Buffer
+	recorder := NewTextRecorder(&line)
+	queue := make(chan MonitorEvent, MonitorBufferSize)
+
+	stop := o.engine.Monitor(func(event MonitorEvent) {
+		select {
+		case queue <- event:
+		default:
+		}
+	})
+	defer stop()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event := <-queue:
+			bs, err := json.Marshal(event)
+
+			if text {
+				line.Reset()
+				err = recorder.Monitor(event)
+				bs = bytes.TrimSuffix(line.Bytes(), []byte("\n"))
+			}
+
+			if err != nil {
+				continue
+			}
+
+			if _, err2 := fmt.Fprintf(w, "data: %s\n\n", bs); err2 != nil {
+				return
+			}
+
+			flusher.Flush()
+		}
+	}
+}
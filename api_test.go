@@ -0,0 +1,222 @@
+package octane_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/mcandre/octane"
+	"gitlab.com/gomidi/midi/v2"
+	"gitlab.com/gomidi/midi/v2/drivers"
+)
+
+func TestAPIHandler(t *testing.T) {
+	out := &fakeOut{name: "synth"}
+	engine, err := octane.NewEngine(octane.Config{}, []drivers.Out{out})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewServer(octane.NewAPIHandler(engine, nil))
+	defer server.Close()
+
+	response, err := http.Post(server.URL+"/transpose", "application/json", strings.NewReader(`{"transpose": -12}`))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var status octane.Status
+	err = json.NewDecoder(response.Body).Decode(&status)
+	response.Body.Close()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if status.Transpose != -12 {
+		t.Errorf("expected transpose -12, got %v", status.Transpose)
+	}
+
+	response, err = http.Post(server.URL+"/preset", "application/json", strings.NewReader(`{"preset": "missing"}`))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	response.Body.Close()
+
+	if response.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected status %v, got %v", http.StatusBadRequest, response.StatusCode)
+	}
+
+	engine.Process(midi.NoteOn(0, 60, 100), false, true)
+
+	response, err = http.Post(server.URL+"/panic", "application/json", nil)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = json.NewDecoder(response.Body).Decode(&status)
+	response.Body.Close()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if status.Received != 1 || len(status.Routes) != 1 || status.Routes[0].Sounding != 0 {
+		t.Errorf("expected one received message and no sounding notes, got %+v", status)
+	}
+
+	// note on, release note off, 16 All Notes Off
+	if len(out.sent) != 18 {
+		t.Errorf("expected 18 sent messages, got %v", out.sent)
+	}
+}
+
+func TestAPIHandlerForgery(t *testing.T) {
+	out := &fakeOut{name: "synth"}
+	engine, err := octane.NewEngine(octane.Config{}, []drivers.Out{out})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewServer(octane.NewAPIHandler(engine, nil))
+	defer server.Close()
+
+	// DNS rebinding points a web page's own domain at the API.
+	port := server.URL[strings.LastIndex(server.URL, ":"):]
+	rebound := "rebind.example" + port
+
+	cases := []struct {
+		contentType string
+		origin      string
+		host        string
+		code        int
+	}{
+		{"text/plain", "", "", http.StatusUnsupportedMediaType},
+		{"application/x-www-form-urlencoded", "", "", http.StatusUnsupportedMediaType},
+		{"application/json", "http://evil.example", "", http.StatusForbidden},
+		{"application/json", "http://" + rebound, rebound, http.StatusForbidden},
+		{"application/json", "http://localhost" + port, "localhost" + port, http.StatusOK},
+		{"application/json; charset=utf-8", server.URL, "", http.StatusOK},
+	}
+
+	for _, c := range cases {
+		request, err2 := http.NewRequest(http.MethodPost, server.URL+"/transpose", strings.NewReader(`{"transpose": 12}`))
+
+		if err2 != nil {
+			t.Fatal(err2)
+		}
+
+		request.Header.Set("Content-Type", c.contentType)
+
+		if c.origin != "" {
+			request.Header.Set("Origin", c.origin)
+		}
+
+		if c.host != "" {
+			request.Host = c.host
+		}
+
+		response, err2 := http.DefaultClient.Do(request)
+
+		if err2 != nil {
+			t.Fatal(err2)
+		}
+
+		response.Body.Close()
+
+		if response.StatusCode != c.code {
+			t.Errorf("expected status %v for %v from %q, got %v", c.code, c.contentType, c.origin, response.StatusCode)
+		}
+	}
+
+	if transpose := engine.Transposition(); transpose != 12 {
+		t.Errorf("expected only the genuine requests to apply, got transpose %v", transpose)
+	}
+}
+
+func TestAPIHandlerReleaseMonitored(t *testing.T) {
+	out := &fakeOut{name: "synth"}
+	engine, err := octane.NewEngine(octane.Config{}, []drivers.Out{out})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var events []octane.MonitorEvent
+	defer engine.Monitor(func(event octane.MonitorEvent) { events = append(events, event) })()
+	engine.Process(midi.NoteOn(0, 60, 100), false, true)
+	engine.SetTransposition(12)
+
+	if len(events) != 3 || events[2].Direction != octane.DirectionOut || events[2].Bytes != "80 3C 00" {
+		t.Errorf("expected the released note off to be monitored, got %v", events)
+	}
+
+	if sent := engine.Status().Routes[0].Sent; sent != 2 {
+		t.Errorf("expected the released note off to count, got %v", sent)
+	}
+}
+
+func TestAPIHandlerEvents(t *testing.T) {
+	out := &fakeOut{name: "synth"}
+	engine, err := octane.NewEngine(octane.Config{TransposeNote: 12}, []drivers.Out{out})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewServer(octane.NewAPIHandler(engine, nil))
+	defer server.Close()
+
+	response, err := http.Get(server.URL + "/events")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer response.Body.Close()
+
+	engine.Process(midi.NoteOn(0, 60, 100), false, true)
+
+	scanner := bufio.NewScanner(response.Body)
+	var events []octane.MonitorEvent
+
+	for len(events) < 2 && scanner.Scan() {
+		data, found := strings.CutPrefix(scanner.Text(), "data: ")
+
+		if !found {
+			continue
+		}
+
+		var event octane.MonitorEvent
+
+		if err2 := json.Unmarshal([]byte(data), &event); err2 != nil {
+			t.Fatal(err2)
+		}
+
+		events = append(events, event)
+	}
+
+	expected := []octane.MonitorEvent{
+		octane.NewMonitorEvent(octane.DirectionIn, "", midi.NoteOn(0, 60, 100)),
+		octane.NewMonitorEvent(octane.DirectionOut, "synth", midi.NoteOn(0, 72, 100)),
+	}
+
+	if len(events) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, events)
+	}
+
+	for i, event := range expected {
+		if events[i] != event {
+			t.Errorf("expected %v, got %v", event, events[i])
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package octane
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"gitlab.com/gomidi/midi/v2"
+)
+
+// CCMapping redirects a control change to another channel and controller.
+type CCMapping struct {
+	// InChannel selects the source channel (1-16).
+	// Zero matches any channel.
+	InChannel uint8 `json:"inChannel,omitempty"`
+
+	// InCC selects the source controller (0-127).
+	InCC uint8 `json:"inCC"`
+
+	// OutChannel selects the target channel (1-16).
+	// Zero preserves the source channel.
+	OutChannel uint8 `json:"outChannel,omitempty"`
+
+	// OutCC selects the target controller (0-127).
+	OutCC uint8 `json:"outCC"`
+
+	// InMin denotes the lower bound of the source range.
+	InMin uint8 `json:"inMin,omitempty"`
+
+	// InMax denotes the upper bound of the source range.
+	// When both InMin and InMax are zero, the full 0-127 range applies.
+	InMax uint8 `json:"inMax,omitempty"`
+
+	// OutMin denotes the lower bound of the target range.
+	OutMin uint8 `json:"outMin,omitempty"`
+
+	// OutMax denotes the upper bound of the target range.
+	// When both OutMin and OutMax are zero, the full 0-127 range applies.
+	OutMax uint8 `json:"outMax,omitempty"`
+
+	// Invert flips the direction of the target range.
+	Invert bool `json:"invert,omitempty"`
+
+	// Curve shapes values with an exponent.
+	// Values above 1 favor finer control near the minimum,
+	// values below 1 favor finer control near the maximum.
+	// Zero means linear.
+	Curve float64 `json:"curve,omitempty"`
+}
+
+// ParseChannelController reads a "[<channel>/]<controller>" pair.
+func ParseChannelController(s string) (uint8, uint8, error) {
+	var channel uint64
+
+	if before, after, found := strings.Cut(s, "/"); found {
+		ch, err := strconv.ParseUint(before, 10, 8)
+
+		if err != nil || ch < 1 || ch > 16 {
+			return 0, 0, fmt.Errorf("invalid MIDI channel: %v", before)
+		}
+
+		channel = ch
+		s = after
+	}
+
+	cc, err := strconv.ParseUint(s, 10, 8)
+
+	if err != nil || cc > 127 {
+		return 0, 0, fmt.Errorf("invalid MIDI controller: %v", s)
+	}
+
+	return uint8(channel), uint8(cc), nil
+}
+
+// ParseCCMapping reads a "[<channel>/]<cc>:[<channel>/]<cc>" mapping.
+func ParseCCMapping(s string) (CCMapping, error) {
+	before, after, found := strings.Cut(s, ":")
+
+	if !found {
+		return CCMapping{}, fmt.Errorf("invalid CC mapping: %v", s)
+	}
+
+	inChannel, inCC, err := ParseChannelController(before)
+
+	if err != nil {
+		return CCMapping{}, err
+	}
+
+	outChannel, outCC, err := ParseChannelController(after)
+
+	if err != nil {
+		return CCMapping{}, err
+	}
+
+	return CCMapping{
+		InChannel:  inChannel,
+		InCC:       inCC,
+		OutChannel: outChannel,
+		OutCC:      outCC,
+	}, nil
+}
+
+// Validate checks the mapping for out of range fields.
+func (o CCMapping) Validate() error {
+	if o.InChannel > 16 || o.OutChannel > 16 {
+		return fmt.Errorf("CC mapping %v:%v has invalid MIDI channel", o.InCC, o.OutCC)
+	}
+
+	if o.InCC > 127 || o.OutCC > 127 {
+		return fmt.Errorf("CC mapping %v:%v has invalid MIDI controller", o.InCC, o.OutCC)
+	}
+
+	if o.InMin > 127 || o.InMax > 127 || o.OutMin > 127 || o.OutMax > 127 {
+		return fmt.Errorf("CC mapping %v:%v has invalid range", o.InCC, o.OutCC)
+	}
+
+	if o.Curve < 0 || math.IsNaN(o.Curve) || math.IsInf(o.Curve, 0) {
+		return fmt.Errorf("CC mapping %v:%v has invalid curve: %v", o.InCC, o.OutCC, o.Curve)
+	}
+
+	return nil
+}
+
+// Matches reports whether the mapping applies to a control change.
+func (o CCMapping) Matches(channel uint8, controller uint8) bool {
+	return controller == o.InCC && matchesChannel(o.InChannel, channel)
+}
+
+// ScaleRange maps a value between ranges, with optional inversion and curve shaping.
+// Degenerate (0, 0) ranges are treated as the full 0-127 range.
+func ScaleRange(value uint8, inMin uint8, inMax uint8, outMin uint8, outMax uint8, invert bool, curve float64) uint8 {
+	if inMin == 0 && inMax == 0 {
+		inMax = 127
+	}
+
+	if outMin == 0 && outMax == 0 {
+		outMax = 127
+	}
+
+	var x float64
+
+	if inMax != inMin {
+		x = (float64(value) - float64(inMin)) / (float64(inMax) - float64(inMin))
+	}
+
+	x = math.Min(math.Max(x, 0), 1)
+
+	if invert {
+		x = 1 - x
+	}
+
+	if curve > 0 {
+		x = math.Pow(x, curve)
+	}
+
+	y := float64(outMin) + x*(float64(outMax)-float64(outMin))
+	return uint8(math.Round(math.Min(math.Max(y, 0), 127)))
+}
+
+// Scale applies the mapping's ranges, inversion, and curve to a value.
+func (o CCMapping) Scale(value uint8) uint8 {
+	return ScaleRange(value, o.InMin, o.InMax, o.OutMin, o.OutMax, o.Invert, o.Curve)
+}
+
+// CCMap remaps control changes.
+// Control changes without a matching mapping pass through unchanged.
+type CCMap []CCMapping
+
+// Transform applies each matching mapping.
+func (o CCMap) Transform(msg midi.Message, emit func(midi.Message)) {
+	var channel uint8
+	var controller uint8
+	var value uint8
+
+	if !msg.GetControlChange(&channel, &controller, &value) {
+		emit(msg)
+		return
+	}
+
+	var matched bool
+
+	for _, mapping := range o {
+		if !mapping.Matches(channel, controller) {
+			continue
+		}
+
+		matched = true
+		outChannel := channel
+
+		if mapping.OutChannel != 0 {
+			outChannel = mapping.OutChannel - 1
+		}
+
+		emit(midi.ControlChange(outChannel, mapping.OutCC, mapping.Scale(value)))
+	}
+
+	if !matched {
+		emit(msg)
+	}
+}
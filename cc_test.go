@@ -0,0 +1,75 @@
+package octane_test
+
+import (
+	"testing"
+
+	"github.com/mcandre/octane"
+	"gitlab.com/gomidi/midi/v2"
+)
+
+func TestParseCCMapping(t *testing.T) {
+	mapping, err := octane.ParseCCMapping("1/74:2/71")
+
+	if err != nil {
+		t.Error(err)
+	}
+
+	expected := octane.CCMapping{InChannel: 1, InCC: 74, OutChannel: 2, OutCC: 71}
+
+	if mapping != expected {
+		t.Errorf("expected %v, got %v", expected, mapping)
+	}
+
+	if _, err2 := octane.ParseCCMapping("74"); err2 == nil {
+		t.Errorf("expected error for missing target")
+	}
+
+	if _, err2 := octane.ParseCCMapping("17/74:71"); err2 == nil {
+		t.Errorf("expected error for invalid channel")
+	}
+}
+
+func TestCCMappingScale(t *testing.T) {
+	mapping := octane.CCMapping{InMin: 0, InMax: 100, OutMin: 20, OutMax: 40}
+
+	if v := mapping.Scale(50); v != 30 {
+		t.Errorf("expected 30, got %v", v)
+	}
+
+	if v := mapping.Scale(127); v != 40 {
+		t.Errorf("expected clamping to 40, got %v", v)
+	}
+
+	mapping.Invert = true
+
+	if v := mapping.Scale(0); v != 40 {
+		t.Errorf("expected inverted 40, got %v", v)
+	}
+
+	curved := octane.CCMapping{Curve: 2}
+
+	if v := curved.Scale(64); v >= 64 {
+		t.Errorf("expected exponential curve to lower midpoint, got %v", v)
+	}
+}
+
+func TestCCMapTransform(t *testing.T) {
+	ccMap := octane.CCMap{{InCC: 74, OutChannel: 3, OutCC: 71}}
+	var got []midi.Message
+	emit := func(msg midi.Message) { got = append(got, msg) }
+
+	ccMap.Transform(midi.ControlChange(0, 74, 100), emit)
+	ccMap.Transform(midi.ControlChange(0, 1, 5), emit)
+
+	if len(got) != 2 {
+		t.Fatalf("expected 2 messages, got %v", len(got))
+	}
+
+	if got[0].String() != midi.ControlChange(2, 71, 100).String() {
+		t.Errorf("expected remapped CC, got %v", got[0])
+	}
+
+	if got[1].String() != midi.ControlChange(0, 1, 5).String() {
+		t.Errorf("expected pass through CC, got %v", got[1])
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/mcandre/octane"
+	"gitlab.com/gomidi/midi/v2/drivers"
+)
+
+// errNotFound signals a missing MIDI device.
+type errNotFound struct {
+	// Direction denotes octane.DirectionIn or octane.DirectionOut.
+	Direction string
+
+	// Name denotes the requested device name.
+	Name string
+}
+
+// Error renders the missing device.
+func (o errNotFound) Error() string {
+	return fmt.Sprintf("Unable to find MIDI %v named: %v", strings.ToUpper(o.Direction), o.Name)
+}
+
+// selectMIDIIns filters MIDI IN devices by comma-separated names.
+// Blank names select all devices.
+func selectMIDIIns(midiIns []drivers.In, names string) ([]drivers.In, error) {
+	if names == "" {
+		return midiIns, nil
+	}
+
+	var selected []drivers.In
+
+	for _, name := range strings.Split(names, ",") {
+		var foundMIDI bool
+
+		for _, midiIn := range midiIns {
+			if midiIn.String() == name {
+				selected = append(selected, midiIn)
+				foundMIDI = true
+				break
+			}
+		}
+
+		if !foundMIDI {
+			return nil, errNotFound{Direction: octane.DirectionIn, Name: name}
+		}
+	}
+
+	return selected, nil
+}
+
+// selectMIDIOuts filters MIDI OUT devices by comma-separated names.
+// Blank names select all devices.
+func selectMIDIOuts(midiOuts []drivers.Out, names string) ([]drivers.Out, error) {
+	if names == "" {
+		return midiOuts, nil
+	}
+
+	var selected []drivers.Out
+
+	for _, name := range strings.Split(names, ",") {
+		var foundMIDI bool
+
+		for _, midiOut := range midiOuts {
+			if midiOut.String() == name {
+				selected = append(selected, midiOut)
+				foundMIDI = true
+				break
+			}
+		}
+
+		if !foundMIDI {
+			return nil, errNotFound{Direction: octane.DirectionOut, Name: name}
+		}
+	}
+
+	return selected, nil
+}
+
+// list reports MIDI devices, optionally probing their identities.
+//
+// When -in or -out name devices, only those devices are listed,
+// and any missing device yields errNotFound.
+func list(midiIns []drivers.In, midiOuts []drivers.Out) error {
+	midiIns, err := selectMIDIIns(midiIns, *flagIn)
+
+	if err != nil {
+		return err
+	}
+
+	midiOuts, err = selectMIDIOuts(midiOuts, *flagOut)
+
+	if err != nil {
+		return err
+	}
+
+	var probes []octane.Probe
+
+	if *flagProbe {
+		probes = octane.ProbeIdentities(midiIns, midiOuts, *flagProbeTimeout)
+	} else {
+		for _, midiIn := range midiIns {
+			probes = append(probes, octane.NewProbe(midiIn, octane.DirectionIn))
+		}
+
+		for _, midiOut := range midiOuts {
+			probes = append(probes, octane.NewProbe(midiOut, octane.DirectionOut))
+		}
+	}
+
+	switch *flagFormat {
+	case "text":
+		listText(probes, len(midiIns), len(midiOuts))
+		return nil
+	case "json":
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "    ")
+		return encoder.Encode(probes)
+	case "tsv":
+		listTSV(probes)
+		return nil
+	default:
+		return fmt.Errorf("unsupported format: %v", *flagFormat)
+	}
+}
+
+// listText renders device probes as bullet points.
+func listText(probes []octane.Probe, inCount int, outCount int) {
+	if inCount == 0 {
+		fmt.Println("No MIDI IN devices.")
+	} else {
+		fmt.Printf("MIDI IN devices:\n\n")
+
+		for _, probe := range probes[:inCount] {
+			listTextProbe(probe)
+		}
+
+		fmt.Println()
+	}
+
+	if outCount == 0 {
+		fmt.Println("No MIDI OUT devices.")
+	} else {
+		fmt.Printf("MIDI OUT devices:\n\n")
+
+		for _, probe := range probes[inCount:] {
+			listTextProbe(probe)
+		}
+
+		fmt.Println()
+	}
+}
+
+// listTextProbe renders a device probe as a bullet point.
+func listTextProbe(probe octane.Probe) {
+	fmt.Printf("* %v\n", probe.Name)
+
+	for _, identity := range probe.Identities {
+		fmt.Printf("    * %v\n", identity)
+	}
+}
+
+// listTSV renders device probes as tab separated values, with a header row.
+func listTSV(probes []octane.Probe) {
+	fmt.Println("number\tkind\tname\tdirection\topen\tidentities")
+
+	for _, probe := range probes {
+		var identities []string
+
+		for _, identity := range probe.Identities {
+			identities = append(identities, identity.String())
+		}
+
+		fmt.Printf("%v\t%v\t%v\t%v\t%v\t%v\n", probe.Number, probe.Kind, probe.Name, probe.Direction, probe.Open, strings.Join(identities, "; "))
+	}
+}
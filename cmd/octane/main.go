@@ -2,127 +2,349 @@
 package main
 
 import (
+	"bufio"
 	"flag"
 	"fmt"
+	"io"
+	"net"
+	"net/http"
 	"os"
+	"os/signal"
+	"slices"
+	"strconv"
 	"strings"
 
 	"github.com/mcandre/octane"
 	"gitlab.com/gomidi/midi/v2"
-	"gitlab.com/gomidi/midi/v2/drivers"
 	_ "gitlab.com/gomidi/midi/v2/drivers/rtmididrv"
 )
 
+// exitNotFound signals a missing MIDI device.
+const exitNotFound = 2
+
 var flagList = flag.Bool("list", false, "List MIDI devices")
-var flagIn = flag.String("in", "", "Select comma-separated MIDI IN devices by name. Example: \"Arturia KeyStep 32,SQ-1 SEQ IN\"")
-var flagOut = flag.String("out", "", "Select comma-separated MIDI OUT devices by name. Example: \"Arturia KeyStep 32,SQ-1 MIDI OUT\"")
+var flagProbe = flag.Bool("probe", false, "With -list, identify devices by Universal Device Inquiry")
+var flagProbeTimeout = flag.Duration("probeTimeout", octane.DefaultProbeTimeout, "With -probe, wait this long for Identity Reply messages per MIDI OUT device")
+var flagFormat = flag.String("format", "text", "With -list, select output format: text, json, or tsv")
+var flagIn = flag.String("in", "", "Select comma-separated MIDI IN devices by name, or - for stdin. Example: \"Arturia KeyStep 32,SQ-1 SEQ IN\"")
+var flagOut = flag.String("out", "", "Select comma-separated MIDI OUT devices by name, or - for stdout. Example: \"Arturia KeyStep 32,SQ-1 MIDI OUT\"")
+var flagStdio = flag.String("stdio", octane.StdioRaw, "With -in - or -out -, select the stream format: raw, hex, json, or text")
 var flagTransposeNote = flag.Int("transposeNote", 0, "Note offset. Example: -48")
+var flagMapCC = flag.String("mapCC", "", "Remap comma-separated control changes, as [<channel>/]<cc>:[<channel>/]<cc>. Example: \"74:71,1/1:2/11\"")
+var flagBendRange = flag.String("bendRange", "", "Rescale pitch bend between device bend ranges, as <in semitones>:<out semitones>. Example: 2:12")
+var flagAftertouch = flag.String("aftertouch", "", "Convert aftertouch: poly, cc:<controller>, max, or average. Example: poly")
+var flagMapProgram = flag.String("mapProgram", "", "Remap comma-separated program changes, as [<channel>/]<program>:[<channel>/]<program>. Example: \"0:12,2/5:3/7\"")
+var flagFilter = flag.String("filter", "", "Apply semicolon-separated message filters, as <drop|pass|divert=<device>>:<expression>. Example: \"drop:type == cc && controller == 1;divert=TR-8:channel == 10\"")
+var flagScript = flag.String("script", "", "Transform messages with a Starlark script file. Example: echo.star")
+var flagHelper = flag.String("helper", "", "Transform messages with an external process over stdin and stdout. Example: \"python3 harmonize.py\"")
+var flagHelperFormat = flag.String("helperFormat", octane.StdioJSON, "With -helper, select the exchange format: json or raw")
+var flagHelperBudget = flag.Duration("helperBudget", octane.DefaultHelperBudget, "With -helper, select the latency budget per message")
+var flagHelperFallback = flag.String("helperFallback", octane.HelperBypass, "With -helper, handle messages missing the latency budget: bypass or drop")
+var flagEcho = flag.String("echo", "", "Echo notes, as <delay|<division>@<bpm>>:<repeats>[:<decay>[:<transpose>]]. Example: \"1/8d@120:4:0.7:12\"")
+var flagRatchet = flag.String("ratchet", "", "Repeat held notes synced to incoming timing clock, as comma-separated note divisions, optionally selected by a controller, as <rates>[:<cc>]. Example: \"1/8,1/16,1/32:20\"")
+var flagRatchetMatch = flag.String("ratchetMatch", "", "With -ratchet, select the notes to repeat by filter expression. Example: \"channel == 10\"")
+var flagRatchetVelocity = flag.String("ratchetVelocity", octane.RatchetNote, "With -ratchet, take repeat velocities from the original note or from aftertouch: note or aftertouch")
+var flagSysEx = flag.Bool("sysex", false, "Forward SysEx messages")
+var flagControl = flag.String("control", "", "Select the control MIDI IN device by name. Example: \"nanoPAD2\"")
+var flagControlMap = flag.String("controlMap", "", "Map comma-separated control messages to actions, as <note|cc|program>:[<channel>/]<number>:<action>. Example: \"note:36:octaveDown,note:38:octaveUp,cc:64:bypass\"")
+var flagPreset = flag.String("preset", "", "Select the initial preset by name. Example: chorus")
+var flagCommands = flag.Bool("commands", false, "Read control commands from stdin, one per line: an action name, or preset <name>")
+var flagConfig = flag.String("config", "", "Load settings from a JSON file. Example: octane.json")
+var flagWatch = flag.Bool("watch", false, "With -config or -script, reload settings whenever the files change")
+var flagMonitor = flag.Bool("monitor", false, "Print messages received and sent, in the text format")
+var flagRecord = flag.String("record", "", "Write received messages to a file in the text format, for replay with -in - -stdio text. Example: take.txt")
+var flagHTTP = flag.String("http", "", "Serve a JSON control API at an address, on loopback unless a host is given. Example: 8080")
+var flagHTTPOrigins = flag.String("httpOrigins", "", "With -http, allow comma-separated web page origins on other hosts to control octane. Example: \"http://localhost:3000\"")
 var flagHelp = flag.Bool("help", false, "Show usage information")
 var flagVersion = flag.Bool("version", false, "Show version information")
 
-func main() {
-	flag.Parse()
+// loadConfig reads the -config file, if any, applying CLI flag overrides.
+func loadConfig() (*octane.Config, error) {
+	var config octane.Config
 
-	switch {
-	case *flagVersion:
-		fmt.Printf("%s\n", octane.Version)
-		os.Exit(0)
-	case *flagHelp:
-		flag.PrintDefaults()
-		os.Exit(0)
+	if *flagConfig != "" {
+		c, err := octane.LoadConfig(*flagConfig)
+
+		if err != nil {
+			return nil, err
+		}
+
+		config = *c
 	}
 
-	defer midi.CloseDriver()
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "transposeNote" {
+			config.TransposeNote = *flagTransposeNote
+		}
+	})
 
-	fmt.Println("Polling for MIDI devices...")
+	if *flagMapCC != "" {
+		for _, spec := range strings.Split(*flagMapCC, ",") {
+			mapping, err := octane.ParseCCMapping(spec)
 
-	midiIns := midi.GetInPorts()
-	midiOuts := midi.GetOutPorts()
+			if err != nil {
+				return nil, err
+			}
 
-	if *flagList {
-		if len(midiIns) == 0 {
-			fmt.Println("No MIDI IN devices.")
-		} else {
-			fmt.Printf("MIDI IN devices:\n\n")
+			config.MapCC = append(config.MapCC, mapping)
+		}
+	}
+
+	if *flagMapProgram != "" {
+		for _, spec := range strings.Split(*flagMapProgram, ",") {
+			mapping, err := octane.ParseProgramMapping(spec)
 
-			for _, midiIn := range midiIns {
-				fmt.Printf("* %v\n", midiIn)
+			if err != nil {
+				return nil, err
 			}
 
-			fmt.Println()
+			config.MapProgram = append(config.MapProgram, mapping)
 		}
+	}
 
-		if len(midiOuts) == 0 {
-			fmt.Println("No MIDI OUT devices.")
-		} else {
-			fmt.Printf("MIDI OUT devices:\n\n")
+	if *flagFilter != "" {
+		for _, spec := range strings.Split(*flagFilter, ";") {
+			filter, err := octane.ParseFilter(spec)
 
-			for _, midiOut := range midiOuts {
-				fmt.Printf("* %v\n", midiOut)
+			if err != nil {
+				return nil, err
 			}
 
-			fmt.Println()
+			config.Filters = append(config.Filters, filter)
 		}
+	}
 
-		os.Exit(0)
+	if *flagScript != "" {
+		config.Script = *flagScript
+	}
+
+	if *flagHelper != "" {
+		config.Helper = &octane.Helper{
+			Command:  strings.Fields(*flagHelper),
+			Format:   *flagHelperFormat,
+			Budget:   flagHelperBudget.String(),
+			Fallback: *flagHelperFallback,
+		}
 	}
 
-	var midiInWhitelist []string
+	if *flagEcho != "" {
+		echo, err := octane.ParseEcho(*flagEcho)
 
-	if *flagIn != "" {
-		midiInWhitelist = strings.Split(*flagIn, ",")
+		if err != nil {
+			return nil, err
+		}
+
+		config.Echo = &echo
 	}
 
-	var midiInsFiltered []drivers.In
+	if *flagRatchet != "" {
+		ratchet, err := octane.ParseRatchet(*flagRatchet)
 
-	if len(midiInWhitelist) == 0 {
-		midiInsFiltered = midiIns
-	} else {
-		for _, name := range midiInWhitelist {
-			var foundMIDI bool
+		if err != nil {
+			return nil, err
+		}
 
-			for _, midiIn := range midiIns {
-				if midiIn.String() == name {
-					midiInsFiltered = append(midiInsFiltered, midiIn)
-					foundMIDI = true
-					break
-				}
-			}
+		ratchet.Match = *flagRatchetMatch
+		ratchet.Velocity = *flagRatchetVelocity
 
-			if !foundMIDI {
-				fmt.Fprintf(os.Stderr, "Unable to find MIDI IN named: %v\n", name)
-				os.Exit(1)
+		if err2 := ratchet.Validate(); err2 != nil {
+			return nil, err2
+		}
+
+		config.Ratchet = &ratchet
+	}
+
+	if *flagBendRange != "" {
+		bendRange, err := octane.ParseBendRange(*flagBendRange)
+
+		if err != nil {
+			return nil, err
+		}
+
+		config.BendRange = append(config.BendRange, bendRange)
+	}
+
+	if *flagAftertouch != "" {
+		aftertouch, err := octane.ParseAftertouch(*flagAftertouch)
+
+		if err != nil {
+			return nil, err
+		}
+
+		config.Aftertouch = append(config.Aftertouch, aftertouch)
+	}
+
+	if *flagControl != "" || *flagControlMap != "" {
+		if config.Control == nil {
+			config.Control = &octane.Control{}
+		}
+
+		if *flagControl != "" {
+			config.Control.In = *flagControl
+		}
+	}
+
+	if *flagControlMap != "" {
+		for _, spec := range strings.Split(*flagControlMap, ",") {
+			mapping, err := octane.ParseControlMapping(spec)
+
+			if err != nil {
+				return nil, err
 			}
+
+			config.Control.Map = append(config.Control.Map, mapping)
 		}
 	}
 
-	var midiOutWhitelist []string
+	if *flagPreset != "" {
+		config.Preset = *flagPreset
+	}
+
+	if *flagSysEx && config.SysEx == nil {
+		config.SysEx = &octane.SysEx{}
+	}
 
-	if *flagOut != "" {
-		midiOutWhitelist = strings.Split(*flagOut, ",")
+	if err := config.Validate(); err != nil {
+		return nil, err
 	}
 
-	var midiOutsFiltered []drivers.Out
+	return &config, nil
+}
+
+// httpAddress defaults the host of an -http address, or a bare port, to loopback,
+// reporting whether the address accepts only local connections.
+func httpAddress(s string) (string, bool, error) {
+	host, port, err := net.SplitHostPort(s)
+
+	if err != nil {
+		if _, err2 := strconv.ParseUint(s, 10, 16); err2 != nil {
+			return "", false, fmt.Errorf("invalid HTTP address: %v", s)
+		}
+
+		host, port = "", s
+	}
+
+	if host == "" {
+		host = "127.0.0.1"
+	}
+
+	ip := net.ParseIP(host)
+	return net.JoinHostPort(host, port), host == "localhost" || (ip != nil && ip.IsLoopback()), nil
+}
 
-	if len(midiOutWhitelist) == 0 {
-		midiOutsFiltered = midiOuts
-	} else {
-		for _, name := range midiOutWhitelist {
-			var foundMIDI bool
+func main() {
+	if len(os.Args) > 1 && os.Args[1] == "sysex" {
+		if err := sysexMain(os.Args[2:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
 
-			for _, midiOut := range midiOuts {
-				if midiOut.String() == name {
-					midiOutsFiltered = append(midiOutsFiltered, midiOut)
-					foundMIDI = true
-					break
-				}
+			if _, ok := err.(errNotFound); ok {
+				os.Exit(exitNotFound)
 			}
 
-			if !foundMIDI {
-				fmt.Fprintf(os.Stderr, "Unable to find MIDI OUT named: %v\n", name)
-				os.Exit(1)
+			os.Exit(1)
+		}
+
+		os.Exit(0)
+	}
+
+	flag.Parse()
+
+	switch {
+	case *flagVersion:
+		fmt.Printf("%s\n", octane.Version)
+		os.Exit(0)
+	case *flagHelp:
+		flag.PrintDefaults()
+		os.Exit(0)
+	}
+
+	config, err := loadConfig()
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	usesStdin := slices.Contains(strings.Split(*flagIn, ","), octane.StdioName)
+	usesStdout := slices.Contains(strings.Split(*flagOut, ","), octane.StdioName)
+
+	if usesStdin && *flagCommands {
+		fmt.Fprintln(os.Stderr, "-commands conflicts with -in -")
+		os.Exit(1)
+	}
+
+	// Keep stdout clean for streamed MIDI.
+	status := io.Writer(os.Stdout)
+
+	if usesStdout {
+		status = os.Stderr
+	}
+
+	defer midi.CloseDriver()
+
+	if *flagFormat == "text" {
+		fmt.Fprintln(status, "Polling for MIDI devices...")
+	}
+
+	pseudoIns, pseudoOuts := config.PseudoPorts()
+	midiIns := append(midi.GetInPorts(), pseudoIns...)
+	midiOuts := append(midi.GetOutPorts(), pseudoOuts...)
+	var stdio *octane.StdioPort
+
+	if usesStdin || usesStdout {
+		var r io.Reader
+		var w io.Writer
+
+		if usesStdin {
+			r = os.Stdin
+		}
+
+		if usesStdout {
+			w = os.Stdout
+		}
+
+		stdio, err = octane.NewStdioPort(octane.StdioName, r, w, *flagStdio)
+
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+
+		if usesStdin {
+			midiIns = append(midiIns, stdio)
+		}
+
+		if usesStdout {
+			midiOuts = append(midiOuts, stdio)
+		}
+	}
+
+	if *flagList {
+		if err := list(midiIns, midiOuts); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+
+			if _, ok := err.(errNotFound); ok {
+				os.Exit(exitNotFound)
 			}
+
+			os.Exit(1)
 		}
+
+		os.Exit(0)
+	}
+
+	midiInsFiltered, err := selectMIDIIns(midiIns, *flagIn)
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(exitNotFound)
+	}
+
+	midiOutsFiltered, err := selectMIDIOuts(midiOuts, *flagOut)
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(exitNotFound)
 	}
 
 	for _, midiIn := range midiInsFiltered {
@@ -132,7 +354,7 @@ func main() {
 
 		defer midiIn.Close()
 
-		fmt.Printf("Connected to MIDI IN device: %v\n", midiIn)
+		fmt.Fprintf(status, "Connected to MIDI IN device: %v\n", midiIn)
 	}
 
 	for _, midiOut := range midiOutsFiltered {
@@ -142,11 +364,198 @@ func main() {
 
 		defer midiOut.Close()
 
-		fmt.Printf("Connected to MIDI OUT device: %v\n", midiOut)
+		fmt.Fprintf(status, "Connected to MIDI OUT device: %v\n", midiOut)
+	}
+
+	engine, err := octane.NewEngine(*config, midiOutsFiltered)
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
 	}
 
+	defer engine.Close()
+
+	var controlRouted bool
+
 	for _, midiIn := range midiInsFiltered {
-		octane.Stream(midiIn, midiOutsFiltered, *flagTransposeNote)
+		if _, err2 := engine.Listen(midiIn); err2 != nil {
+			fmt.Fprintln(os.Stderr, err2)
+		}
+
+		if config.Control != nil && midiIn.String() == config.Control.In {
+			controlRouted = true
+		}
+	}
+
+	if config.Control != nil && config.Control.In != "" && !controlRouted {
+		controlIns, err2 := selectMIDIIns(midiIns, config.Control.In)
+
+		if err2 != nil {
+			fmt.Fprintln(os.Stderr, err2)
+			os.Exit(exitNotFound)
+		}
+
+		controlIn := controlIns[0]
+
+		if err3 := controlIn.Open(); err3 != nil {
+			panic(err3)
+		}
+
+		defer controlIn.Close()
+
+		fmt.Fprintf(status, "Connected to control MIDI IN device: %v\n", controlIn)
+
+		if _, err3 := engine.ListenControl(controlIn); err3 != nil {
+			fmt.Fprintln(os.Stderr, err3)
+		}
+	}
+
+	if *flagMonitor {
+		recorder := octane.NewTextRecorder(status)
+
+		defer engine.Monitor(func(event octane.MonitorEvent) {
+			if err2 := recorder.Monitor(event); err2 != nil {
+				fmt.Fprintln(os.Stderr, err2)
+			}
+		})()
+	}
+
+	if *flagRecord != "" {
+		f, err2 := os.Create(*flagRecord)
+
+		if err2 != nil {
+			fmt.Fprintln(os.Stderr, err2)
+			os.Exit(1)
+		}
+
+		defer f.Close()
+		recorder := octane.NewTextRecorder(f)
+
+		defer engine.Monitor(func(event octane.MonitorEvent) {
+			if event.Direction != octane.DirectionIn {
+				return
+			}
+
+			bs, _, err3 := octane.ParseHexBytes(event.Bytes, false)
+
+			if err3 == nil {
+				err3 = recorder.Write(midi.Message(bs))
+			}
+
+			if err3 != nil {
+				fmt.Fprintln(os.Stderr, err3)
+			}
+		})()
+
+		fmt.Fprintf(status, "Recording to: %v\n", *flagRecord)
+	}
+
+	if *flagHTTP != "" {
+		ports := func() []octane.Probe {
+			var probes []octane.Probe
+
+			for _, midiIn := range append(midi.GetInPorts(), pseudoIns...) {
+				probes = append(probes, octane.NewProbe(midiIn, octane.DirectionIn))
+			}
+
+			for _, midiOut := range append(midi.GetOutPorts(), pseudoOuts...) {
+				probes = append(probes, octane.NewProbe(midiOut, octane.DirectionOut))
+			}
+
+			return probes
+		}
+
+		addr, loopback, err2 := httpAddress(*flagHTTP)
+
+		if err2 != nil {
+			fmt.Fprintln(os.Stderr, err2)
+			os.Exit(1)
+		}
+
+		if !loopback {
+			fmt.Fprintf(os.Stderr, "Warning: the HTTP API has no authentication, and %v accepts connections from other machines\n", addr)
+		}
+
+		var origins []string
+
+		if *flagHTTPOrigins != "" {
+			origins = strings.Split(*flagHTTPOrigins, ",")
+		}
+
+		server := &http.Server{Addr: addr, Handler: octane.NewAPIHandler(engine, ports, origins...)}
+
+		go func() {
+			if err2 := server.ListenAndServe(); err2 != nil {
+				fmt.Fprintln(os.Stderr, err2)
+				os.Exit(1)
+			}
+		}()
+
+		fmt.Fprintf(status, "Serving HTTP API at: http://%v/\n", addr)
+	}
+
+	var watched []string
+
+	for _, pth := range []string{*flagConfig, config.Script} {
+		if pth != "" {
+			watched = append(watched, pth)
+		}
+	}
+
+	if len(watched) != 0 {
+		reload := func() {
+			c, err2 := loadConfig()
+
+			if err2 == nil {
+				err2 = engine.Reload(*c)
+			}
+
+			if err2 != nil {
+				fmt.Fprintf(os.Stderr, "Keeping previous settings: %v\n", err2)
+				return
+			}
+
+			fmt.Fprintf(status, "Reloaded configuration: %v\n", strings.Join(watched, ", "))
+		}
+
+		hangups := make(chan os.Signal, 1)
+
+		if len(reloadSignals) != 0 {
+			signal.Notify(hangups, reloadSignals...)
+		}
+
+		go func() {
+			for range hangups {
+				reload()
+			}
+		}()
+
+		if *flagWatch {
+			for _, pth := range watched {
+				defer octane.WatchConfig(pth, octane.DefaultWatchInterval, reload)()
+			}
+		}
+	}
+
+	if *flagCommands {
+		scanner := bufio.NewScanner(os.Stdin)
+
+		for scanner.Scan() {
+			if strings.TrimSpace(scanner.Text()) == "" {
+				continue
+			}
+
+			if err2 := engine.Command(scanner.Text()); err2 != nil {
+				fmt.Fprintln(os.Stderr, err2)
+			}
+		}
+	}
+
+	// Exit once piped input ends, like other filters.
+	if usesStdin {
+		<-stdio.Done()
+		return
 	}
 
 	select {}
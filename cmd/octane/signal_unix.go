@@ -0,0 +1,11 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// reloadSignals trigger configuration reloads.
+var reloadSignals = []os.Signal{syscall.SIGHUP}
@@ -0,0 +1,8 @@
+//go:build windows
+
+package main
+
+import "os"
+
+// reloadSignals trigger configuration reloads.
+var reloadSignals []os.Signal
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync/atomic"
+
+	"github.com/mcandre/octane"
+	"gitlab.com/gomidi/midi/v2"
+)
+
+// sysexUsage documents the sysex subcommands.
+const sysexUsage = `Usage:
+  octane sysex dump -in <device> -o <file.syx> [-count <n>] [-bufferSize <bytes>]
+  octane sysex send -out <device> [-delay <duration>] <file.syx>...`
+
+// sysexDump captures SysEx patch dumps into a .syx file.
+func sysexDump(args []string) error {
+	flagSet := flag.NewFlagSet("sysex dump", flag.ExitOnError)
+	flagIn := flagSet.String("in", "", "Select MIDI IN device by name")
+	flagO := flagSet.String("o", "", "Write SysEx messages to a .syx file")
+	flagCount := flagSet.Int("count", 0, "Stop after capturing this many messages. Zero captures until interrupted.")
+	flagBufferSize := flagSet.Uint("bufferSize", 65536, "Largest SysEx message accepted, in bytes")
+
+	if err := flagSet.Parse(args); err != nil {
+		return err
+	}
+
+	if *flagIn == "" || *flagO == "" {
+		return fmt.Errorf("%v", sysexUsage)
+	}
+
+	midiIns, err := selectMIDIIns(midi.GetInPorts(), *flagIn)
+
+	if err != nil {
+		return err
+	}
+
+	midiIn := midiIns[0]
+
+	if err2 := midiIn.Open(); err2 != nil {
+		return err2
+	}
+
+	defer midiIn.Close()
+
+	f, err := os.Create(*flagO)
+
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	done := make(chan os.Signal, 1)
+	signal.Notify(done, os.Interrupt)
+	var count atomic.Int64
+
+	stop, err := octane.DumpSysEx(midiIn, f, uint32(*flagBufferSize), func(msg midi.Message) {
+		n := count.Add(1)
+		fmt.Printf("Captured SysEx message %v (%v bytes)\n", n, len(msg))
+
+		if *flagCount > 0 && n >= int64(*flagCount) {
+			select {
+			case done <- os.Interrupt:
+			default:
+			}
+		}
+	})
+
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Listening for SysEx on MIDI IN device: %v\n", midiIn)
+	<-done
+	stop()
+	fmt.Printf("Wrote %v SysEx messages to %v\n", count.Load(), *flagO)
+	return f.Sync()
+}
+
+// sysexSend transmits .syx files.
+func sysexSend(args []string) error {
+	flagSet := flag.NewFlagSet("sysex send", flag.ExitOnError)
+	flagOut := flagSet.String("out", "", "Select MIDI OUT device by name")
+	flagDelay := flagSet.Duration("delay", octane.DefaultSysExDelay, "Pause between messages")
+
+	if err := flagSet.Parse(args); err != nil {
+		return err
+	}
+
+	if *flagOut == "" || flagSet.NArg() == 0 {
+		return fmt.Errorf("%v", sysexUsage)
+	}
+
+	midiOuts, err := selectMIDIOuts(midi.GetOutPorts(), *flagOut)
+
+	if err != nil {
+		return err
+	}
+
+	midiOut := midiOuts[0]
+
+	if err2 := midiOut.Open(); err2 != nil {
+		return err2
+	}
+
+	defer midiOut.Close()
+
+	// Send all files as one sequence, so that the delay also paces the gaps between files.
+	var msgs []midi.Message
+
+	for _, pth := range flagSet.Args() {
+		fileMsgs, err2 := octane.ReadSysExFile(pth)
+
+		if err2 != nil {
+			return err2
+		}
+
+		fmt.Printf("Sending %v SysEx messages from %v\n", len(fileMsgs), pth)
+		msgs = append(msgs, fileMsgs...)
+	}
+
+	return octane.SendSysEx(midiOut, msgs, *flagDelay)
+}
+
+// sysexMain dispatches sysex subcommands.
+func sysexMain(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("%v", sysexUsage)
+	}
+
+	defer midi.CloseDriver()
+
+	switch args[0] {
+	case "dump":
+		return sysexDump(args[1:])
+	case "send":
+		return sysexSend(args[1:])
+	default:
+		return fmt.Errorf("%v", sysexUsage)
+	}
+}
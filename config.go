@@ -0,0 +1,307 @@
+package octane
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"gitlab.com/gomidi/midi/v2"
+)
+
+// Config models octane settings.
+type Config struct {
+	// Out restricts routing to the named MIDI OUT devices.
+	// Empty routes to all MIDI OUT devices.
+	Out []string `json:"out,omitempty"`
+
+	// Filters collects message filters, applied in order.
+	// The first matching filter decides a message's fate.
+	Filters []Filter `json:"filters,omitempty"`
+
+	// Script names a script file, transforming messages ahead of filters.
+	Script string `json:"script,omitempty"`
+
+	// Helper configures an external process transforming messages ahead of scripts.
+	Helper *Helper `json:"helper,omitempty"`
+
+	// Echo configures note repeats, following filters and transformations.
+	Echo *Echo `json:"echo,omitempty"`
+
+	// Ratchet configures note repeats synced to incoming timing clock.
+	Ratchet *Ratchet `json:"ratchet,omitempty"`
+
+	// TransposeNote denotes a signed note offset.
+	TransposeNote int `json:"transposeNote,omitempty"`
+
+	// MapCC collects control change mappings.
+	MapCC []CCMapping `json:"mapCC,omitempty"`
+
+	// BendRange collects pitch bend range conversions.
+	BendRange []BendRange `json:"bendRange,omitempty"`
+
+	// BendToCC collects pitch bend to control change conversions.
+	BendToCC []BendToCC `json:"bendToCC,omitempty"`
+
+	// CCToBend collects control change to pitch bend conversions.
+	CCToBend []CCToBend `json:"ccToBend,omitempty"`
+
+	// Aftertouch collects aftertouch conversions.
+	Aftertouch []Aftertouch `json:"aftertouch,omitempty"`
+
+	// Parameters enables NRPN, RPN, and 14-bit CC assembly and translation.
+	Parameters *Parameters `json:"parameters,omitempty"`
+
+	// MapProgram collects program change mappings.
+	MapProgram []ProgramMapping `json:"mapProgram,omitempty"`
+
+	// SysEx enables SysEx forwarding.
+	SysEx *SysEx `json:"sysex,omitempty"`
+
+	// Control enables runtime control via incoming MIDI.
+	Control *Control `json:"control,omitempty"`
+
+	// OSC collects OSC pseudo-ports.
+	OSC []OSCEndpoint `json:"osc,omitempty"`
+
+	// RTPMIDI collects RTP-MIDI network session pseudo-ports.
+	RTPMIDI []RTPMIDISession `json:"rtpMIDI,omitempty"`
+
+	// Sockets collects raw MIDI socket pseudo-ports.
+	Sockets []SocketEndpoint `json:"sockets,omitempty"`
+
+	// Serial collects serial tty pseudo-ports.
+	Serial []SerialEndpoint `json:"serial,omitempty"`
+
+	// Presets collects named routing and transformation graphs.
+	Presets []Preset `json:"presets,omitempty"`
+
+	// Preset names the initially active preset.
+	// Blank selects the top level routing and transformations.
+	Preset string `json:"preset,omitempty"`
+}
+
+// LoadConfig reads a JSON configuration file.
+func LoadConfig(pth string) (*Config, error) {
+	bs, err := os.ReadFile(pth)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var config Config
+	decoder := json.NewDecoder(bytes.NewReader(bs))
+	decoder.DisallowUnknownFields()
+
+	if err2 := decoder.Decode(&config); err2 != nil {
+		return nil, err2
+	}
+
+	if err2 := config.Validate(); err2 != nil {
+		return nil, err2
+	}
+
+	return &config, nil
+}
+
+// Validate checks the configuration for errors.
+func (o Config) Validate() error {
+	if o.Helper != nil {
+		if err := o.Helper.Validate(); err != nil {
+			return err
+		}
+	}
+
+	for _, filter := range o.Filters {
+		if err := filter.Validate(); err != nil {
+			return err
+		}
+	}
+
+	if o.Echo != nil {
+		if err := o.Echo.Validate(); err != nil {
+			return err
+		}
+	}
+
+	if o.Ratchet != nil {
+		if err := o.Ratchet.Validate(); err != nil {
+			return err
+		}
+	}
+
+	for _, mapping := range o.MapCC {
+		if err := mapping.Validate(); err != nil {
+			return err
+		}
+	}
+
+	if o.Parameters != nil {
+		if err := o.Parameters.Validate(); err != nil {
+			return err
+		}
+	}
+
+	for _, mapping := range o.MapProgram {
+		if err := mapping.Validate(); err != nil {
+			return err
+		}
+	}
+
+	if o.SysEx != nil {
+		if err := o.SysEx.Validate(); err != nil {
+			return err
+		}
+	}
+
+	if o.Control != nil {
+		if err := o.Control.Validate(); err != nil {
+			return err
+		}
+
+		for _, mapping := range o.Control.Map {
+			if mapping.Action != ActionPreset {
+				continue
+			}
+
+			if _, err := o.FindPreset(mapping.Preset); err != nil {
+				return err
+			}
+		}
+	}
+
+	for i, endpoint := range o.OSC {
+		if err := endpoint.Validate(); err != nil {
+			return err
+		}
+
+		for _, other := range o.OSC[:i] {
+			if other.Name == endpoint.Name {
+				return fmt.Errorf("duplicate OSC endpoint: %v", endpoint.Name)
+			}
+		}
+	}
+
+	for i, session := range o.RTPMIDI {
+		if err := session.Validate(); err != nil {
+			return err
+		}
+
+		for _, other := range o.RTPMIDI[:i] {
+			if other.Name == session.Name {
+				return fmt.Errorf("duplicate RTP-MIDI session: %v", session.Name)
+			}
+		}
+	}
+
+	for i, endpoint := range o.Sockets {
+		if err := endpoint.Validate(); err != nil {
+			return err
+		}
+
+		for _, other := range o.Sockets[:i] {
+			if other.Name == endpoint.Name {
+				return fmt.Errorf("duplicate socket endpoint: %v", endpoint.Name)
+			}
+		}
+	}
+
+	for i, endpoint := range o.Serial {
+		if err := endpoint.Validate(); err != nil {
+			return err
+		}
+
+		for _, other := range o.Serial[:i] {
+			if other.Name == endpoint.Name {
+				return fmt.Errorf("duplicate serial endpoint: %v", endpoint.Name)
+			}
+		}
+	}
+
+	for i, preset := range o.Presets {
+		if err := preset.Validate(); err != nil {
+			return err
+		}
+
+		for _, other := range o.Presets[:i] {
+			if other.Name == preset.Name {
+				return fmt.Errorf("duplicate preset: %v", preset.Name)
+			}
+		}
+	}
+
+	if o.Preset != "" {
+		if _, err := o.FindPreset(o.Preset); err != nil {
+			return err
+		}
+	}
+
+	for _, bendRange := range o.BendRange {
+		if err := bendRange.Validate(); err != nil {
+			return err
+		}
+	}
+
+	for _, bendToCC := range o.BendToCC {
+		if err := bendToCC.Validate(); err != nil {
+			return err
+		}
+	}
+
+	for _, ccToBend := range o.CCToBend {
+		if err := ccToBend.Validate(); err != nil {
+			return err
+		}
+	}
+
+	for _, aftertouch := range o.Aftertouch {
+		if err := aftertouch.Validate(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Transformer assembles the configured transformation chain
+// for the named MIDI OUT device.
+func (o Config) Transformer(out string) Transformer {
+	chain := Chain{Transpose{Offset: o.TransposeNote}}
+
+	if o.Parameters != nil {
+		chain = append(chain, o.Parameters.Transformer())
+	}
+
+	chain = append(chain, CCMap(o.MapCC), ProgramMap(o.MapProgram).ForOut(out))
+
+	for _, ccToBend := range o.CCToBend {
+		chain = append(chain, ccToBend.Transformer())
+	}
+
+	for _, bendRange := range o.BendRange {
+		chain = append(chain, bendRange)
+	}
+
+	for _, bendToCC := range o.BendToCC {
+		chain = append(chain, bendToCC)
+	}
+
+	for _, aftertouch := range o.Aftertouch {
+		chain = append(chain, aftertouch.Transformer())
+	}
+
+	if o.SysEx != nil {
+		chain = append(chain, o.SysEx.Transformer())
+	}
+
+	return chain
+}
+
+// Options generates the MIDI IN listening options.
+func (o Config) Options() []midi.Option {
+	if o.SysEx == nil {
+		return nil
+	}
+
+	return o.SysEx.Options()
+}
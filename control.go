@@ -0,0 +1,186 @@
+package octane
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"gitlab.com/gomidi/midi/v2"
+)
+
+// ControlNote triggers actions by note on.
+const ControlNote = "note"
+
+// ControlCC triggers actions by control change values of 64 and above.
+const ControlCC = "cc"
+
+// ControlProgram triggers actions by program change.
+const ControlProgram = "program"
+
+// ActionOctaveUp raises the runtime transposition by an octave.
+const ActionOctaveUp = "octaveUp"
+
+// ActionOctaveDown lowers the runtime transposition by an octave.
+const ActionOctaveDown = "octaveDown"
+
+// ActionTransposeUp raises the runtime transposition by a semitone.
+const ActionTransposeUp = "transposeUp"
+
+// ActionTransposeDown lowers the runtime transposition by a semitone.
+const ActionTransposeDown = "transposeDown"
+
+// ActionReset clears runtime transposition and bypass.
+const ActionReset = "reset"
+
+// ActionBypass toggles forwarding messages without transformations.
+const ActionBypass = "bypass"
+
+// ActionPreset selects a named preset.
+const ActionPreset = "preset"
+
+// ActionNextPreset selects the following preset, wrapping around.
+const ActionNextPreset = "nextPreset"
+
+// ActionPreviousPreset selects the preceding preset, wrapping around.
+const ActionPreviousPreset = "previousPreset"
+
+// Actions collects the supported control actions.
+var Actions = []string{
+	ActionOctaveUp,
+	ActionOctaveDown,
+	ActionTransposeUp,
+	ActionTransposeDown,
+	ActionReset,
+	ActionBypass,
+	ActionPreset,
+	ActionNextPreset,
+	ActionPreviousPreset,
+}
+
+// ParseControlMapping reads a "<type>:[<channel>/]<number>:<action>" control mapping.
+// The preset action takes the form "preset=<name>".
+func ParseControlMapping(s string) (ControlMapping, error) {
+	fields := strings.SplitN(s, ":", 3)
+
+	if len(fields) != 3 {
+		return ControlMapping{}, fmt.Errorf("invalid control mapping: %v", s)
+	}
+
+	channel, number, err := ParseChannelController(fields[1])
+
+	if err != nil {
+		return ControlMapping{}, fmt.Errorf("invalid control mapping: %v", s)
+	}
+
+	mapping := ControlMapping{Type: fields[0], Channel: channel, Number: number, Action: fields[2]}
+
+	if action, preset, found := strings.Cut(fields[2], "="); found {
+		mapping.Action = action
+		mapping.Preset = preset
+	}
+
+	return mapping, mapping.Validate()
+}
+
+// ControlMapping binds an incoming note, control change, or program change to an action.
+type ControlMapping struct {
+	// Type denotes ControlNote, ControlCC, or ControlProgram.
+	Type string `json:"type"`
+
+	// Channel selects the source channel (1-16).
+	// Zero matches any channel.
+	Channel uint8 `json:"channel,omitempty"`
+
+	// Number selects the key, controller, or program (0-127).
+	Number uint8 `json:"number"`
+
+	// Action names the action to perform.
+	Action string `json:"action"`
+
+	// Preset names the preset selected by ActionPreset.
+	Preset string `json:"preset,omitempty"`
+}
+
+// Validate checks the mapping for unsupported types and actions.
+func (o ControlMapping) Validate() error {
+	if o.Channel > 16 || o.Number > 127 {
+		return fmt.Errorf("control mapping %v:%v has out of range fields", o.Type, o.Number)
+	}
+
+	switch o.Type {
+	case ControlNote, ControlCC, ControlProgram:
+	default:
+		return fmt.Errorf("unsupported control type: %v", o.Type)
+	}
+
+	if o.Action == ActionPreset && o.Preset == "" {
+		return fmt.Errorf("control mapping %v:%v requires a preset name", o.Type, o.Number)
+	}
+
+	if !slices.Contains(Actions, o.Action) {
+		return fmt.Errorf("unsupported control action: %v", o.Action)
+	}
+
+	return nil
+}
+
+// Match reports whether msg belongs to the mapping,
+// and whether msg triggers the action.
+//
+// Note offs and control change values below 64 belong to the mapping,
+// without triggering the action.
+func (o ControlMapping) Match(msg midi.Message) (bool, bool) {
+	var channel uint8
+	var number uint8
+	var value uint8
+
+	switch o.Type {
+	case ControlNote:
+		switch {
+		case msg.GetNoteStart(&channel, &number, &value):
+			if number == o.Number && matchesChannel(o.Channel, channel) {
+				return true, true
+			}
+		case msg.GetNoteEnd(&channel, &number):
+			if number == o.Number && matchesChannel(o.Channel, channel) {
+				return true, false
+			}
+		}
+	case ControlCC:
+		if msg.GetControlChange(&channel, &number, &value) && number == o.Number && matchesChannel(o.Channel, channel) {
+			return true, value >= 64
+		}
+	case ControlProgram:
+		if msg.GetProgramChange(&channel, &number) && number == o.Number && matchesChannel(o.Channel, channel) {
+			return true, true
+		}
+	}
+
+	return false, false
+}
+
+// Control configures runtime control of transformations via incoming MIDI.
+type Control struct {
+	// In selects the control MIDI IN device by name.
+	// Blank applies control mappings to all MIDI IN devices.
+	In string `json:"in,omitempty"`
+
+	// Map collects control mappings.
+	// Matching messages are consumed rather than forwarded.
+	Map []ControlMapping `json:"map,omitempty"`
+
+	// ProgramPresets selects presets by index with any unmapped program change.
+	// Program 0 selects the first preset.
+	ProgramPresets bool `json:"programPresets,omitempty"`
+}
+
+// Validate checks the control mappings.
+func (o Control) Validate() error {
+	for _, mapping := range o.Map {
+		if err := mapping.Validate(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,60 @@
+package octane_test
+
+import (
+	"testing"
+
+	"github.com/mcandre/octane"
+	"gitlab.com/gomidi/midi/v2"
+)
+
+func TestParseControlMapping(t *testing.T) {
+	mapping, err := octane.ParseControlMapping("cc:10/64:bypass")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := octane.ControlMapping{Type: octane.ControlCC, Channel: 10, Number: 64, Action: octane.ActionBypass}
+
+	if mapping != expected {
+		t.Errorf("expected %v, got %v", expected, mapping)
+	}
+
+	if _, err2 := octane.ParseControlMapping("cc:64:explode"); err2 == nil {
+		t.Errorf("expected error for unsupported action")
+	}
+}
+
+func TestControlMappingMatch(t *testing.T) {
+	mapping := octane.ControlMapping{Type: octane.ControlCC, Number: 64, Action: octane.ActionBypass}
+
+	if matched, triggered := mapping.Match(midi.ControlChange(0, 64, 127)); !matched || !triggered {
+		t.Errorf("expected pedal down to trigger")
+	}
+
+	if matched, triggered := mapping.Match(midi.ControlChange(0, 64, 0)); !matched || triggered {
+		t.Errorf("expected pedal up to be consumed without triggering")
+	}
+
+	if matched, _ := mapping.Match(midi.ControlChange(0, 1, 127)); matched {
+		t.Errorf("expected other controllers not to match")
+	}
+}
+
+func TestParseControlMappingPreset(t *testing.T) {
+	mapping, err := octane.ParseControlMapping("program:1/5:preset=chorus")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := octane.ControlMapping{Type: octane.ControlProgram, Channel: 1, Number: 5, Action: octane.ActionPreset, Preset: "chorus"}
+
+	if mapping != expected {
+		t.Errorf("expected %v, got %v", expected, mapping)
+	}
+
+	if _, err2 := octane.ParseControlMapping("cc:80:preset"); err2 == nil {
+		t.Errorf("expected error for unnamed preset")
+	}
+}
@@ -0,0 +1,264 @@
+package octane
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"gitlab.com/gomidi/midi/v2"
+)
+
+// EchoMaxRepeats limits the repeats per note.
+const EchoMaxRepeats = 64
+
+// ParseEcho reads a "<delay>:<repeats>[:<decay>[:<transpose>]]" echo.
+// The delay takes the form of a duration like "250ms",
+// or a note division at a tempo like "1/8@120".
+func ParseEcho(s string) (Echo, error) {
+	fields := strings.Split(s, ":")
+
+	if len(fields) < 2 || len(fields) > 4 {
+		return Echo{}, fmt.Errorf("invalid echo: %v", s)
+	}
+
+	var echo Echo
+
+	if division, tempo, found := strings.Cut(fields[0], "@"); found {
+		bpm, err := strconv.ParseFloat(tempo, 64)
+
+		if err != nil {
+			return Echo{}, fmt.Errorf("invalid echo tempo: %v", tempo)
+		}
+
+		echo.Division = division
+		echo.Tempo = bpm
+	} else {
+		echo.Delay = fields[0]
+	}
+
+	repeats, err := strconv.Atoi(fields[1])
+
+	if err != nil {
+		return Echo{}, fmt.Errorf("invalid echo repeats: %v", fields[1])
+	}
+
+	echo.Repeats = repeats
+
+	if len(fields) > 2 {
+		decay, err2 := strconv.ParseFloat(fields[2], 64)
+
+		if err2 != nil {
+			return Echo{}, fmt.Errorf("invalid echo decay: %v", fields[2])
+		}
+
+		echo.Decay = decay
+	}
+
+	if len(fields) > 3 {
+		transpose, err2 := strconv.Atoi(fields[3])
+
+		if err2 != nil {
+			return Echo{}, fmt.Errorf("invalid echo transpose: %v", fields[3])
+		}
+
+		echo.Transpose = transpose
+	}
+
+	return echo, echo.Validate()
+}
+
+// Echo re-triggers notes after a delay, with feedback.
+// Each echoed note on receives a matching echoed note off,
+// the same delay after the original note off.
+type Echo struct {
+	// Delay denotes the time between repeats, as a duration like "250ms".
+	Delay string `json:"delay,omitempty"`
+
+	// Division denotes the time between repeats as a note division, like "1/8",
+	// with an optional "d" suffix for dotted or "t" for triplet notes.
+	// Requires Tempo.
+	Division string `json:"division,omitempty"`
+
+	// Tempo denotes the beats (quarter notes) per minute for Division.
+	Tempo float64 `json:"tempo,omitempty"`
+
+	// Repeats denotes the number of echoes per note.
+	Repeats int `json:"repeats"`
+
+	// Decay scales the velocity of each repeat, from 0 to 1.
+	// Zero defaults to 1, no decay. Echoes fading to zero velocity end early.
+	Decay float64 `json:"decay,omitempty"`
+
+	// Transpose denotes a signed note offset per repeat, for pitch-shifting echoes.
+	// Echoes leaving the key range are skipped.
+	Transpose int `json:"transpose,omitempty"`
+
+	// Outs names two MIDI OUT devices to alternate repeats between, for ping-pong echoes.
+	Outs []string `json:"outs,omitempty"`
+
+	// Channels denotes two channels (1-16) to alternate repeats between, for ping-pong echoes.
+	Channels []uint8 `json:"channels,omitempty"`
+}
+
+// Validate checks the echo for errors.
+func (o Echo) Validate() error {
+	if o.Repeats < 1 || o.Repeats > EchoMaxRepeats {
+		return fmt.Errorf("echo repeats out of range: %v", o.Repeats)
+	}
+
+	if o.Decay < 0 || o.Decay > 1 {
+		return fmt.Errorf("echo decay out of range: %v", o.Decay)
+	}
+
+	if len(o.Outs) != 0 && len(o.Outs) != 2 {
+		return fmt.Errorf("echo ping-pong requires two outputs")
+	}
+
+	if len(o.Channels) != 0 && len(o.Channels) != 2 {
+		return fmt.Errorf("echo ping-pong requires two channels")
+	}
+
+	for _, channel := range o.Channels {
+		if channel < 1 || channel > 16 {
+			return fmt.Errorf("echo channel out of range: %v", channel)
+		}
+	}
+
+	_, err := o.Interval()
+	return err
+}
+
+// Interval computes the time between repeats.
+func (o Echo) Interval() (time.Duration, error) {
+	if o.Delay != "" {
+		if o.Division != "" || o.Tempo != 0 {
+			return 0, fmt.Errorf("echo requires either a delay or a division and tempo")
+		}
+
+		delay, err := time.ParseDuration(o.Delay)
+
+		if err != nil || delay <= 0 {
+			return 0, fmt.Errorf("invalid echo delay: %v", o.Delay)
+		}
+
+		return delay, nil
+	}
+
+	if o.Tempo <= 0 {
+		return 0, fmt.Errorf("echo division requires a tempo: %v", o.Tempo)
+	}
+
+	beats, err := ParseDivision(o.Division)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return time.Duration(beats * float64(time.Minute) / o.Tempo), nil
+}
+
+// ParseDivision reads a note division like "1/8", "1/8d" (dotted), or "1/8t" (triplet),
+// reporting its length in beats (quarter notes).
+func ParseDivision(s string) (float64, error) {
+	scale := 1.0
+	fraction := s
+
+	switch {
+	case strings.HasSuffix(s, "d"):
+		scale = 1.5
+		fraction = strings.TrimSuffix(s, "d")
+	case strings.HasSuffix(s, "t"):
+		scale = 2.0 / 3.0
+		fraction = strings.TrimSuffix(s, "t")
+	}
+
+	numerator, denominator, found := strings.Cut(fraction, "/")
+	n, err := strconv.Atoi(numerator)
+	d, err2 := strconv.Atoi(denominator)
+
+	if !found || err != nil || err2 != nil || n < 1 || d < 1 {
+		return 0, fmt.Errorf("invalid note division: %v", s)
+	}
+
+	return 4 * float64(n) / float64(d) * scale, nil
+}
+
+// velocity computes the velocity of a repeat, where zero ends the echoes.
+func (o Echo) velocity(velocity uint8, repeat int) uint8 {
+	decay := o.Decay
+
+	if decay == 0 {
+		decay = 1
+	}
+
+	return uint8(min(127, math.Round(float64(velocity)*math.Pow(decay, float64(repeat)))))
+}
+
+// repeat computes the channel, key, and MIDI OUT device of a repeat,
+// reporting false for repeats leaving the key range.
+// Blank devices keep the original routing.
+func (o Echo) repeat(channel uint8, key uint8, out string, repeat int) (uint8, uint8, string, bool) {
+	k := int(key) + o.Transpose*repeat
+
+	if k < 0 || k > 127 {
+		return 0, 0, "", false
+	}
+
+	if len(o.Channels) == 2 {
+		channel = o.Channels[(repeat-1)%2] - 1
+	}
+
+	if len(o.Outs) == 2 {
+		out = o.Outs[(repeat-1)%2]
+	}
+
+	return channel, uint8(k), out, true
+}
+
+// echo schedules the repeats of a note on or note off
+// routed to the named MIDI OUT device, or blank for the active routing.
+func (o *Engine) echo(msg midi.Message, out string) {
+	if o.echoer == nil || o.bypass {
+		return
+	}
+
+	interval, _ := o.echoer.Interval()
+	var channel uint8
+	var key uint8
+	var velocity uint8
+
+	switch {
+	case msg.GetNoteStart(&channel, &key, &velocity):
+		id := noteID{channel, key}
+		o.echoes[id] = 0
+
+		for i := 1; i <= o.echoer.Repeats; i++ {
+			v := o.echoer.velocity(velocity, i)
+
+			if v == 0 {
+				break
+			}
+
+			o.echoes[id] = i
+			c, k, target, ok := o.echoer.repeat(channel, key, out, i)
+
+			if ok {
+				o.schedule(o.echoTimers, time.Duration(i)*interval, func() { o.send(midi.NoteOn(c, k, v), target) })
+			}
+		}
+	case msg.GetNoteEnd(&channel, &key):
+		id := noteID{channel, key}
+		repeats := o.echoes[id]
+		delete(o.echoes, id)
+
+		for i := 1; i <= repeats; i++ {
+			c, k, target, ok := o.echoer.repeat(channel, key, out, i)
+
+			if ok {
+				o.schedule(o.echoTimers, time.Duration(i)*interval, func() { o.send(midi.NoteOff(c, k), target) })
+			}
+		}
+	}
+}
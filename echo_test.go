@@ -0,0 +1,163 @@
+package octane_test
+
+import (
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/mcandre/octane"
+	"gitlab.com/gomidi/midi/v2"
+	"gitlab.com/gomidi/midi/v2/drivers"
+)
+
+func TestParseEcho(t *testing.T) {
+	echo, err := octane.ParseEcho("1/8d@120:4:0.5:12")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if interval, _ := echo.Interval(); interval != 375*time.Millisecond || echo.Repeats != 4 || echo.Decay != 0.5 || echo.Transpose != 12 {
+		t.Errorf("expected dotted eighth echoes at 120 BPM, got %v (%v)", echo, interval)
+	}
+
+	if echo, err = octane.ParseEcho("250ms:2"); err != nil || echo.Delay != "250ms" || echo.Repeats != 2 {
+		t.Errorf("expected 250ms echoes, got %v (%v)", echo, err)
+	}
+
+	if beats, err2 := octane.ParseDivision("1/4t"); err2 != nil || beats < 0.66 || beats > 0.67 {
+		t.Errorf("expected two thirds of a beat, got %v (%v)", beats, err2)
+	}
+
+	for _, s := range []string{"", "250ms", "250ms:0", "250ms:2:1.5", "250ms:2:0.5:up", "soon:2", "1/8:2", "1/0@120:2", "1/8@fast:2", "250ms:2:0.5:1:1"} {
+		if _, err2 := octane.ParseEcho(s); err2 == nil {
+			t.Errorf("expected error for %q", s)
+		}
+	}
+
+	for _, echo := range []octane.Echo{
+		{Delay: "250ms", Repeats: 1, Channels: []uint8{1}},
+		{Delay: "250ms", Repeats: 1, Channels: []uint8{1, 17}},
+		{Delay: "250ms", Repeats: 1, Outs: []string{"a", "b", "c"}},
+		{Delay: "250ms", Division: "1/8", Tempo: 120, Repeats: 1},
+	} {
+		if err2 := echo.Validate(); err2 == nil {
+			t.Errorf("expected error for %v", echo)
+		}
+	}
+}
+
+func TestEngineEcho(t *testing.T) {
+	out := &fakeOut{name: "synth"}
+	echo := octane.Echo{Delay: "20ms", Repeats: 3, Decay: 0.5, Transpose: 12, Channels: []uint8{2, 3}}
+	engine, err := octane.NewEngine(octane.Config{Echo: &echo}, []drivers.Out{out})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer engine.Close()
+	engine.Process(midi.NoteOn(0, 100, 100), false, true)
+	awaitSent(engine, 3)
+	engine.Process(midi.NoteOff(0, 100), false, true)
+
+	// The third repeat leaves the key range.
+	expected := []midi.Message{
+		midi.NoteOn(0, 100, 100),
+		midi.NoteOn(1, 112, 50),
+		midi.NoteOn(2, 124, 25),
+		midi.NoteOff(0, 100),
+		midi.NoteOff(1, 112),
+		midi.NoteOff(2, 124),
+	}
+
+	if sent := awaitSent(engine, uint64(len(expected))); sent != uint64(len(expected)) {
+		t.Errorf("expected %v, got %v", expected, sent)
+	}
+
+	time.Sleep(80 * time.Millisecond)
+	engine.Panic()
+
+	if !equalMessages(out.sent[:len(expected)], expected) {
+		t.Errorf("expected %v, got %v", expected, out.sent)
+	}
+}
+
+func TestEngineEchoPingPong(t *testing.T) {
+	a := &fakeOut{name: "a"}
+	b := &fakeOut{name: "b"}
+	echo := octane.Echo{Delay: "10ms", Repeats: 4, Outs: []string{"b", "a"}}
+	engine, err := octane.NewEngine(octane.Config{Out: []string{"a"}, Echo: &echo}, []drivers.Out{a, b})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer engine.Close()
+	engine.Process(midi.NoteOn(0, 60, 100), false, true)
+	engine.Process(midi.NoteOff(0, 60), false, true)
+	deadline := time.Now().Add(2 * time.Second)
+
+	for (engine.Status().Routes[0].Sent < 6 || engine.Status().Routes[1].Sent < 4) && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	status := engine.Status()
+
+	if status.Routes[0].Sent != 6 || status.Routes[1].Sent != 4 {
+		t.Errorf("expected repeats to alternate outputs, got %v and %v", a.sent, b.sent)
+	}
+
+	// Settings changes discard pending echoes.
+	engine.Process(midi.NoteOn(0, 62, 100), false, true)
+	engine.SetTransposition(12)
+	released := engine.Status().Routes[1].Sent
+	time.Sleep(60 * time.Millisecond)
+
+	if sent := engine.Status().Routes[1].Sent; sent != released {
+		t.Errorf("expected pending echoes to be discarded, got %v", b.sent)
+	}
+}
+
+func TestEngineEchoRelease(t *testing.T) {
+	pth := path.Join(t.TempDir(), "delay.star")
+
+	if err := os.WriteFile(pth, []byte(`
+def on_message(msg, port, time):
+    if msg.type == "control_change":
+        return after("30ms", control_change(1, 7, 100))
+
+    return msg
+`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	out := &fakeOut{name: "synth"}
+	echo := octane.Echo{Delay: "20ms", Repeats: 2}
+	engine, err := octane.NewEngine(octane.Config{Script: pth, Echo: &echo}, []drivers.Out{out})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer engine.Close()
+	engine.Process(midi.ControlChange(0, 1, 64), false, true)
+	engine.Process(midi.NoteOn(0, 60, 100), false, true)
+
+	// Settings changes discard pending echoes, but not scheduled script output.
+	engine.SetTransposition(0)
+	expected := []midi.Message{midi.NoteOn(0, 60, 100), midi.NoteOff(0, 60), midi.ControlChange(0, 7, 100)}
+	awaitSent(engine, uint64(len(expected)))
+	time.Sleep(60 * time.Millisecond)
+
+	if !equalMessages(out.sent, expected) {
+		t.Errorf("expected %v, got %v", expected, out.sent)
+	}
+
+	pingPong := octane.Echo{Delay: "20ms", Repeats: 2, Outs: []string{"synth", "drums"}}
+
+	if _, err2 := octane.NewEngine(octane.Config{Echo: &pingPong}, []drivers.Out{out}); err2 == nil {
+		t.Errorf("expected error for unknown echo device")
+	}
+}
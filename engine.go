@@ -0,0 +1,840 @@
+package octane
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"gitlab.com/gomidi/midi/v2"
+	"gitlab.com/gomidi/midi/v2/drivers"
+)
+
+// noteID identifies a note by zero-based channel and key.
+type noteID struct {
+	channel uint8
+	key     uint8
+}
+
+// route pairs a MIDI OUT device with its transformation,
+// tracking the notes sounding there.
+type route struct {
+	out drivers.Out
+
+	sender func(midi.Message) error
+
+	transformer Transformer
+
+	enabled bool
+
+	sounding map[noteID]int
+
+	sent uint64
+
+	notify func(midi.Message)
+}
+
+// emit sends a message, tracking sounding notes.
+func (o *route) emit(msg midi.Message) {
+	var channel uint8
+	var key uint8
+	var velocity uint8
+
+	switch {
+	case msg.GetNoteStart(&channel, &key, &velocity):
+		o.sounding[noteID{channel, key}]++
+	case msg.GetNoteEnd(&channel, &key):
+		id := noteID{channel, key}
+
+		if o.sounding[id] > 1 {
+			o.sounding[id]--
+		} else {
+			delete(o.sounding, id)
+		}
+	}
+
+	if err := o.sender(msg); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return
+	}
+
+	o.sent++
+
+	if o.notify != nil {
+		o.notify(msg)
+	}
+}
+
+// release silences the notes sounding on the route.
+// Note offs count and notify like any other sent message.
+func (o *route) release() {
+	for id := range o.sounding {
+		o.emit(midi.NoteOff(id.channel, id.key))
+	}
+
+	clear(o.sounding)
+}
+
+// filterStage pairs a filter with its compiled expression.
+type filterStage struct {
+	Filter
+
+	expression Expression
+}
+
+// Engine routes MIDI IN devices to MIDI OUT devices,
+// with transformations adjustable at runtime.
+//
+// Messages are processed one at a time,
+// so that settings never change partway through a message.
+type Engine struct {
+	mutex sync.Mutex
+
+	config Config
+
+	routes []*route
+
+	filters []filterStage
+
+	script *Script
+
+	helper *helperProcess
+
+	echoer *Echo
+
+	echoes map[noteID]int
+
+	ratchet *ratchetStage
+
+	// timers tracks scheduled script output.
+	timers map[*time.Timer]bool
+
+	// echoTimers tracks scheduled echo repeats, discarded as settings change.
+	echoTimers map[*time.Timer]bool
+
+	preset string
+
+	transpose int
+
+	bypass bool
+
+	// held tracks where each held note was routed: a MIDI OUT device, or blank for the enabled routes.
+	held map[noteID]string
+
+	orphaned map[noteID]bool
+
+	received uint64
+
+	consumed uint64
+
+	monitors map[int]func(MonitorEvent, midi.Message)
+
+	monitorID int
+}
+
+// NewEngine prepares an Engine for MIDI OUT devices.
+func NewEngine(config Config, midiOuts []drivers.Out) (*Engine, error) {
+	o := &Engine{
+		config:     config,
+		held:       map[noteID]string{},
+		orphaned:   map[noteID]bool{},
+		echoes:     map[noteID]int{},
+		monitors:   map[int]func(MonitorEvent, midi.Message){},
+		timers:     map[*time.Timer]bool{},
+		echoTimers: map[*time.Timer]bool{},
+	}
+
+	if config.Script != "" {
+		script, err := LoadScript(config.Script)
+
+		if err != nil {
+			return nil, err
+		}
+
+		o.script = script
+	}
+
+	o.mutex.Lock()
+	helper, err := o.launchHelper(config.Helper)
+	o.helper = helper
+	o.mutex.Unlock()
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, midiOut := range midiOuts {
+		sender, err := midi.SendTo(midiOut)
+
+		if err != nil {
+			return nil, err
+		}
+
+		name := midiOut.String()
+
+		o.routes = append(o.routes, &route{
+			out:      midiOut,
+			sender:   sender,
+			sounding: map[noteID]int{},
+			notify:   func(msg midi.Message) { o.notify(DirectionOut, name, msg) },
+		})
+	}
+
+	if err := o.checkOuts(config); err != nil {
+		return nil, err
+	}
+
+	if err := o.setPreset(config.Preset); err != nil {
+		return nil, err
+	}
+
+	return o, nil
+}
+
+// checkOuts reports routing settings naming MIDI OUT devices missing from the engine,
+// across the top level settings and every preset.
+func (o *Engine) checkOuts(config Config) error {
+	configs := []Config{config}
+
+	for _, preset := range config.Presets {
+		configs = append(configs, preset.Config)
+	}
+
+	for _, c := range configs {
+		for _, name := range c.Out {
+			if o.findRoute(name) == nil {
+				return fmt.Errorf("unknown MIDI OUT device: %v", name)
+			}
+		}
+
+		if c.Echo != nil {
+			for _, name := range c.Echo.Outs {
+				if o.findRoute(name) == nil {
+					return fmt.Errorf("echo alternates to unknown MIDI OUT device: %v", name)
+				}
+			}
+		}
+
+		for _, filter := range c.Filters {
+			if filter.Action == FilterDivert && o.findRoute(filter.Out) == nil {
+				return fmt.Errorf("filter %q diverts to unknown MIDI OUT device: %v", filter.Match, filter.Out)
+			}
+		}
+	}
+
+	return nil
+}
+
+// findRoute looks up the route to the named MIDI OUT device.
+func (o *Engine) findRoute(name string) *route {
+	for _, r := range o.routes {
+		if r.out.String() == name {
+			return r
+		}
+	}
+
+	return nil
+}
+
+// Listen begins routing messages from a MIDI IN device.
+// Control mappings apply when the device is the control device.
+//
+// Returns a function to stop listening.
+func (o *Engine) Listen(midiIn drivers.In) (func(), error) {
+	return o.listen(midiIn, true)
+}
+
+// ListenControl begins applying control mappings to messages from a MIDI IN device,
+// without routing the remaining messages.
+//
+// Returns a function to stop listening.
+func (o *Engine) ListenControl(midiIn drivers.In) (func(), error) {
+	return o.listen(midiIn, false)
+}
+
+// listen begins processing messages from a MIDI IN device.
+//
+// The control device is looked up per message, so that reloaded settings apply.
+func (o *Engine) listen(midiIn drivers.In, routed bool) (func(), error) {
+	name := midiIn.String()
+
+	react := func(msg midi.Message, _ int32) {
+		o.mutex.Lock()
+		defer o.mutex.Unlock()
+		o.process(name, msg, o.controls(name), routed)
+	}
+
+	o.mutex.Lock()
+	options := o.config.Options()
+	o.mutex.Unlock()
+	return midi.ListenTo(midiIn, react, options...)
+}
+
+// controls reports whether control mappings apply to the named MIDI IN device.
+func (o *Engine) controls(in string) bool {
+	return o.config.Control != nil && (o.config.Control.In == "" || o.config.Control.In == in)
+}
+
+// Process handles an incoming message.
+//
+// When control is true, control mappings may consume the message.
+// When routed is true, remaining messages are transformed and sent to each MIDI OUT device.
+func (o *Engine) Process(msg midi.Message, control bool, routed bool) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	o.process("", msg, control, routed)
+}
+
+// Inject handles a message as if it arrived on the named MIDI IN device.
+func (o *Engine) Inject(in string, msg midi.Message) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	o.process(in, msg, o.controls(in), true)
+}
+
+// process handles an incoming message from the named MIDI IN device.
+func (o *Engine) process(in string, msg midi.Message, control bool, routed bool) {
+	o.received++
+	o.notify(DirectionIn, in, msg)
+
+	if control && o.control(msg) {
+		o.consumed++
+		return
+	}
+
+	if !routed {
+		return
+	}
+
+	if o.helper == nil {
+		o.forward(in, msg)
+		return
+	}
+
+	if !o.helper.submit(in, msg) && o.helper.config.Fallback != HelperDrop {
+		o.forward(in, msg)
+	}
+}
+
+// launchHelper starts a helper process, if configured,
+// routing its replies onward until another helper replaces it.
+//
+// The caller holds the lock, and assigns the helper before releasing it,
+// so that replies never see a partially launched helper.
+func (o *Engine) launchHelper(config *Helper) (*helperProcess, error) {
+	if config == nil {
+		return nil, nil
+	}
+
+	var helper *helperProcess
+
+	helper, err := startHelper(*config, func(in string, msg midi.Message) {
+		o.mutex.Lock()
+		defer o.mutex.Unlock()
+
+		if o.helper == helper {
+			o.forward(in, msg)
+		}
+	})
+
+	return helper, err
+}
+
+// forward runs a message through the script, if any, then routes the results.
+func (o *Engine) forward(in string, msg midi.Message) {
+	if o.script == nil {
+		o.route(msg)
+		return
+	}
+
+	outputs, err := o.script.Run(in, msg, time.Now())
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Script dropped message: %v\n", err)
+		return
+	}
+
+	for _, output := range outputs {
+		if output.Delay > 0 {
+			msg := output.Message
+			o.schedule(o.timers, output.Delay, func() { o.route(msg) })
+			continue
+		}
+
+		o.route(output.Message)
+	}
+}
+
+// schedule calls f with the lock held, after a delay,
+// tracking the timer in timers.
+func (o *Engine) schedule(timers map[*time.Timer]bool, delay time.Duration, f func()) {
+	var timer *time.Timer
+
+	// The lock held while scheduling keeps the callback from running before timer is assigned.
+	timer = time.AfterFunc(delay, func() {
+		o.mutex.Lock()
+		defer o.mutex.Unlock()
+
+		if !timers[timer] {
+			return
+		}
+
+		delete(timers, timer)
+		f()
+	})
+
+	timers[timer] = true
+}
+
+// cancel discards the messages scheduled by timers.
+func (o *Engine) cancel(timers map[*time.Timer]bool) {
+	for timer := range timers {
+		timer.Stop()
+	}
+
+	clear(timers)
+}
+
+// route filters, transforms, echoes, ratchets, and sends a message to each MIDI OUT device.
+func (o *Engine) route(msg midi.Message) {
+	// Timing clock drives ratchets, whether or not filters pass it onward.
+	if o.ratchet != nil && !o.bypass {
+		switch msg.Type() {
+		case midi.StartMsg:
+			o.ratchet.clock = 0
+		case midi.TimingClockMsg:
+			o.tick()
+		}
+	}
+
+	var channel uint8
+	var key uint8
+	var velocity uint8
+	noteStart := msg.GetNoteStart(&channel, &key, &velocity)
+	noteEnd := msg.GetNoteEnd(&channel, &key)
+	id := noteID{channel, key}
+
+	// Settings changed while the note was held, and the note was already released.
+	// Note ons and note offs settle any orphan for their key, whatever the filters.
+	if noteStart || noteEnd {
+		orphaned := o.orphaned[id]
+		delete(o.orphaned, id)
+
+		if orphaned && noteEnd {
+			return
+		}
+	}
+
+	action, divert := o.filter(msg)
+
+	if action != FilterDivert {
+		divert = ""
+	}
+
+	// Note offs follow their note ons, whatever the filters.
+	if noteEnd {
+		if out, ok := o.held[id]; ok {
+			action, divert = FilterPass, out
+		}
+	}
+
+	switch action {
+	case FilterDrop:
+		return
+	case "":
+		switch msg.Type() {
+		case midi.NoteOnMsg, midi.NoteOffMsg, midi.ControlChangeMsg, midi.PitchBendMsg, midi.AfterTouchMsg, midi.PolyAfterTouchMsg, midi.ProgramChangeMsg, midi.SysExMsg:
+		default:
+			return
+		}
+	}
+
+	// Rate control changes that filters drop or divert never reach the ratchet.
+	if o.ratchet != nil && !o.bypass && divert == "" && o.ratchet.control(msg) {
+		return
+	}
+
+	switch {
+	case noteStart:
+		o.held[id] = divert
+	case noteEnd:
+		delete(o.held, id)
+	}
+
+	o.send(msg, divert)
+	o.echo(msg, divert)
+
+	if o.ratchet != nil && !o.bypass {
+		o.ratchet.track(msg, divert)
+	}
+}
+
+// send transforms and sends a message to the named MIDI OUT device,
+// or blank for each enabled MIDI OUT device.
+func (o *Engine) send(msg midi.Message, out string) {
+	for _, r := range o.routes {
+		if out != "" {
+			if r.out.String() != out {
+				continue
+			}
+		} else if !r.enabled {
+			continue
+		}
+
+		if o.bypass {
+			r.emit(msg)
+			continue
+		}
+
+		Chain{Transpose{Offset: o.transpose}, r.transformer}.Transform(msg, r.emit)
+	}
+}
+
+// filter reports the action of the first filter matching msg, if any,
+// along with the MIDI OUT device receiving diverted messages.
+func (o *Engine) filter(msg midi.Message) (string, string) {
+	for _, stage := range o.filters {
+		if stage.expression.Match(msg) {
+			return stage.Action, stage.Out
+		}
+	}
+
+	return "", ""
+}
+
+// control applies the first control mapping matching msg,
+// reporting whether msg was consumed.
+func (o *Engine) control(msg midi.Message) bool {
+	for _, mapping := range o.config.Control.Map {
+		matched, triggered := mapping.Match(msg)
+
+		if !matched {
+			continue
+		}
+
+		if triggered {
+			var err error
+
+			if mapping.Action == ActionPreset {
+				err = o.setPreset(mapping.Preset)
+			} else {
+				err = o.act(mapping.Action)
+			}
+
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+			}
+		}
+
+		return true
+	}
+
+	var channel uint8
+	var program uint8
+
+	if o.config.Control.ProgramPresets && msg.GetProgramChange(&channel, &program) {
+		if int(program) < len(o.config.Presets) {
+			if err := o.setPreset(o.config.Presets[program].Name); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+			}
+		}
+
+		return true
+	}
+
+	return false
+}
+
+// setPreset swaps in the routing and transformations of the named preset.
+// Blank selects the top level routing and transformations.
+func (o *Engine) setPreset(name string) error {
+	active := o.config
+
+	if name != "" {
+		preset, err := o.config.FindPreset(name)
+
+		if err != nil {
+			return err
+		}
+
+		active = preset.Config
+		active.SysEx = o.config.SysEx
+	}
+
+	var filters []filterStage
+
+	for _, filter := range active.Filters {
+		expression, err := ParseExpression(filter.Match)
+
+		if err != nil {
+			return err
+		}
+
+		filters = append(filters, filterStage{Filter: filter, expression: expression})
+	}
+
+	var ratchet *ratchetStage
+
+	if active.Ratchet != nil {
+		stage, err := newRatchetStage(*active.Ratchet)
+
+		if err != nil {
+			return err
+		}
+
+		ratchet = stage
+
+		// Keep repeats on the running clock grid.
+		if o.ratchet != nil {
+			ratchet.clock = o.ratchet.clock
+		}
+	}
+
+	o.release()
+
+	for _, r := range o.routes {
+		r.transformer = active.Transformer(r.out.String())
+		r.enabled = active.RoutesTo(r.out.String())
+	}
+
+	o.filters = filters
+	o.echoer = active.Echo
+	o.ratchet = ratchet
+	o.preset = name
+	return nil
+}
+
+// stepPreset selects the preset offset places from the active preset, wrapping around.
+func (o *Engine) stepPreset(offset int) error {
+	count := len(o.config.Presets)
+
+	if count == 0 {
+		return fmt.Errorf("no presets configured")
+	}
+
+	i := -1
+
+	for j, preset := range o.config.Presets {
+		if preset.Name == o.preset {
+			i = j
+		}
+	}
+
+	if i < 0 && offset < 0 {
+		i = 0
+	}
+
+	i = ((i+offset)%count + count) % count
+	return o.setPreset(o.config.Presets[i].Name)
+}
+
+// release silences sounding notes ahead of a settings change, discarding echo repeats.
+// Notes still held are orphaned, so that their eventual note offs are dropped.
+func (o *Engine) release() {
+	o.cancel(o.echoTimers)
+	clear(o.echoes)
+
+	if o.ratchet != nil {
+		clear(o.ratchet.held)
+	}
+
+	for _, r := range o.routes {
+		r.release()
+	}
+
+	for id := range o.held {
+		o.orphaned[id] = true
+	}
+
+	clear(o.held)
+}
+
+// act performs a control action.
+func (o *Engine) act(action string) error {
+	o.release()
+
+	switch action {
+	case ActionOctaveUp:
+		o.transpose += 12
+	case ActionOctaveDown:
+		o.transpose -= 12
+	case ActionTransposeUp:
+		o.transpose++
+	case ActionTransposeDown:
+		o.transpose--
+	case ActionReset:
+		o.transpose = 0
+		o.bypass = false
+	case ActionBypass:
+		o.bypass = !o.bypass
+	case ActionNextPreset:
+		return o.stepPreset(1)
+	case ActionPreviousPreset:
+		return o.stepPreset(-1)
+	default:
+		return fmt.Errorf("unsupported control action: %v", action)
+	}
+
+	return nil
+}
+
+// Act performs a control action.
+func (o *Engine) Act(action string) error {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	return o.act(action)
+}
+
+// Reload swaps in new settings, releasing sounding notes.
+// MIDI devices stay connected.
+//
+// The active preset carries over when the new settings still define it.
+// Scripts reload from disk, discarding scheduled messages and script variables.
+// Helper processes restart.
+// Settings changing pseudo-ports, SysEx listening, or the control device are rejected,
+// as are settings routing to MIDI OUT devices missing from the engine.
+func (o *Engine) Reload(config Config) error {
+	if err := config.Validate(); err != nil {
+		return err
+	}
+
+	var script *Script
+
+	if config.Script != "" {
+		s, err := LoadScript(config.Script)
+
+		if err != nil {
+			return err
+		}
+
+		script = s
+	}
+
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	if err := o.config.CheckReload(config); err != nil {
+		return err
+	}
+
+	if err := o.checkOuts(config); err != nil {
+		return err
+	}
+
+	helper, err := o.launchHelper(config.Helper)
+
+	if err != nil {
+		return err
+	}
+
+	if o.helper != nil {
+		o.helper.stop()
+	}
+
+	o.helper = helper
+	o.cancel(o.timers)
+	o.script = script
+
+	preset := config.Preset
+
+	if _, err := config.FindPreset(o.preset); err == nil {
+		preset = o.preset
+	}
+
+	o.config = config
+	return o.setPreset(preset)
+}
+
+// Close lets the helper process, if any, finish outstanding messages within its latency budget,
+// then stops it, discarding scheduled messages.
+func (o *Engine) Close() {
+	o.mutex.Lock()
+	helper := o.helper
+	o.mutex.Unlock()
+
+	// Replies need the lock, so wait without it.
+	if helper != nil {
+		helper.close()
+	}
+
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	o.cancel(o.timers)
+	o.cancel(o.echoTimers)
+	o.helper = nil
+}
+
+// SetPreset swaps in the routing and transformations of the named preset,
+// releasing sounding notes.
+// Blank selects the top level routing and transformations.
+func (o *Engine) SetPreset(name string) error {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	return o.setPreset(name)
+}
+
+// Preset names the active preset.
+// Blank denotes the top level routing and transformations.
+func (o *Engine) Preset() string {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	return o.preset
+}
+
+// Command performs a textual command: a control action name,
+// or "preset <name>" to select a preset.
+func (o *Engine) Command(line string) error {
+	action, argument, _ := strings.Cut(strings.TrimSpace(line), " ")
+
+	if action == ActionPreset {
+		return o.SetPreset(strings.TrimSpace(argument))
+	}
+
+	return o.Act(action)
+}
+
+// SetTransposition sets the runtime note offset, releasing sounding notes.
+func (o *Engine) SetTransposition(offset int) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	o.release()
+	o.transpose = offset
+}
+
+// SetBypass sets whether messages are forwarded without transformations, releasing sounding notes.
+func (o *Engine) SetBypass(bypass bool) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	o.release()
+	o.bypass = bypass
+}
+
+// Panic discards scheduled messages, releases sounding notes,
+// then sends All Notes Off on every channel of every MIDI OUT device.
+func (o *Engine) Panic() {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	o.cancel(o.timers)
+	o.release()
+
+	for _, r := range o.routes {
+		for channel := uint8(0); channel < 16; channel++ {
+			r.emit(midi.ControlChange(channel, midi.AllNotesOff, 0))
+		}
+	}
+}
+
+// Transposition reports the runtime note offset, in addition to any configured transposition.
+func (o *Engine) Transposition() int {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	return o.transpose
+}
+
+// Bypassed reports whether messages are forwarded without transformations.
+func (o *Engine) Bypassed() bool {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	return o.bypass
+}
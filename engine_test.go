@@ -0,0 +1,86 @@
+package octane_test
+
+import (
+	"testing"
+
+	"github.com/mcandre/octane"
+	"gitlab.com/gomidi/midi/v2"
+	"gitlab.com/gomidi/midi/v2/drivers"
+)
+
+// fakeOut records sent messages.
+type fakeOut struct {
+	name string
+	open bool
+	sent []midi.Message
+}
+
+func (o *fakeOut) Open() error             { o.open = true; return nil }
+func (o *fakeOut) Close() error            { o.open = false; return nil }
+func (o *fakeOut) IsOpen() bool            { return o.open }
+func (o *fakeOut) Number() int             { return 0 }
+func (o *fakeOut) String() string          { return o.name }
+func (o *fakeOut) Underlying() interface{} { return nil }
+
+func (o *fakeOut) Send(data []byte) error {
+	o.sent = append(o.sent, midi.Message(append([]byte{}, data...)))
+	return nil
+}
+
+func TestEngineControlReleasesNotes(t *testing.T) {
+	out := &fakeOut{name: "synth"}
+	config := octane.Config{
+		Control: &octane.Control{Map: []octane.ControlMapping{{Type: octane.ControlNote, Number: 36, Action: octane.ActionOctaveUp}}},
+	}
+
+	engine, err := octane.NewEngine(config, []drivers.Out{out})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	engine.Process(midi.NoteOn(0, 60, 100), true, true)
+	engine.Process(midi.NoteOn(0, 36, 100), true, true)
+	engine.Process(midi.NoteOff(0, 36), true, true)
+	engine.Process(midi.NoteOff(0, 60), true, true)
+	engine.Process(midi.NoteOn(0, 60, 100), true, true)
+
+	expected := []midi.Message{
+		midi.NoteOn(0, 60, 100),
+		midi.NoteOff(0, 60),
+		midi.NoteOn(0, 72, 100),
+	}
+
+	if len(out.sent) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, out.sent)
+	}
+
+	for i, msg := range expected {
+		if out.sent[i].String() != msg.String() {
+			t.Errorf("expected %v, got %v", msg, out.sent[i])
+		}
+	}
+
+	if engine.Transposition() != 12 {
+		t.Errorf("expected runtime transposition 12, got %v", engine.Transposition())
+	}
+}
+
+func TestEngineBypass(t *testing.T) {
+	out := &fakeOut{name: "synth"}
+	engine, err := octane.NewEngine(octane.Config{TransposeNote: 5}, []drivers.Out{out})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err2 := engine.Act(octane.ActionBypass); err2 != nil {
+		t.Error(err2)
+	}
+
+	engine.Process(midi.NoteOn(0, 60, 100), false, true)
+
+	if len(out.sent) != 1 || out.sent[0].String() != midi.NoteOn(0, 60, 100).String() {
+		t.Errorf("expected untransposed note, got %v", out.sent)
+	}
+}
@@ -0,0 +1,432 @@
+package octane
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"gitlab.com/gomidi/midi/v2"
+)
+
+// FilterDrop discards matching messages.
+const FilterDrop = "drop"
+
+// FilterPass routes matching messages as usual,
+// including message types that are otherwise discarded, such as timing clock.
+const FilterPass = "pass"
+
+// FilterDivert routes matching messages only to another MIDI OUT device.
+const FilterDivert = "divert"
+
+// FilterActions collects the supported filter actions.
+var FilterActions = []string{FilterDrop, FilterPass, FilterDivert}
+
+// FilterFields collects the message fields available to filter expressions.
+var FilterFields = []string{"type", "channel", "key", "velocity", "controller", "value", "program", "pressure", "bend"}
+
+// ParseFilter reads a "<action>:<expression>" filter.
+// The divert action takes the form "divert=<device>".
+// Device names may contain colons, as expressions never do.
+func ParseFilter(s string) (Filter, error) {
+	i := strings.LastIndex(s, ":")
+
+	if i < 0 {
+		return Filter{}, fmt.Errorf("invalid filter: %v", s)
+	}
+
+	filter := Filter{Match: strings.TrimSpace(s[i+1:]), Action: s[:i]}
+
+	if action, out, found := strings.Cut(s[:i], "="); found {
+		filter.Action = action
+		filter.Out = out
+	}
+
+	return filter, filter.Validate()
+}
+
+// Filter applies an action to messages matching an expression.
+type Filter struct {
+	// Match denotes an expression like
+	// "type == noteon && channel in [1, 2] && key >= C3 && velocity > 20".
+	Match string `json:"match"`
+
+	// Action denotes FilterDrop, FilterPass, or FilterDivert.
+	Action string `json:"action"`
+
+	// Out names the MIDI OUT device receiving FilterDivert messages.
+	Out string `json:"out,omitempty"`
+}
+
+// Validate checks the filter for unsupported actions and malformed expressions.
+func (o Filter) Validate() error {
+	if !slices.Contains(FilterActions, o.Action) {
+		return fmt.Errorf("unsupported filter action: %v", o.Action)
+	}
+
+	if o.Action == FilterDivert && o.Out == "" {
+		return fmt.Errorf("filter %q requires a divert device", o.Match)
+	}
+
+	_, err := ParseExpression(o.Match)
+	return err
+}
+
+// Expression matches messages by their fields.
+//
+// Comparisons take the form "<field> <op> <value>", with operators ==, !=, <, <=, >, and >=,
+// or "<field> in [<value>, ...]". Comparisons combine with &&, ||, !, and parentheses.
+//
+// Fields absent from a message, such as velocity for a control change, never match.
+// Types follow the text format names, with or without underscores, such as noteon or control_change.
+// Channels range 1-16. Keys accept note names like C3.
+type Expression struct {
+	source string
+
+	node expressionNode
+}
+
+// ParseExpression compiles a filter expression.
+func ParseExpression(s string) (Expression, error) {
+	p := expressionParser{tokens: tokenizeExpression(s)}
+
+	if len(p.tokens) == 0 {
+		return Expression{}, fmt.Errorf("empty filter expression")
+	}
+
+	node, err := p.or()
+
+	if err == nil && p.pos < len(p.tokens) {
+		err = fmt.Errorf("unexpected %q", p.tokens[p.pos])
+	}
+
+	if err != nil {
+		return Expression{}, fmt.Errorf("invalid filter expression %q: %v", s, err)
+	}
+
+	return Expression{source: s, node: node}, nil
+}
+
+// Match reports whether msg satisfies the expression.
+func (o Expression) Match(msg midi.Message) bool {
+	return o.node != nil && o.node.eval(messageFields(msg))
+}
+
+// String renders the expression source.
+func (o Expression) String() string {
+	return o.source
+}
+
+// messageFields extracts the filterable fields of a message.
+// Note ons with zero velocity count as note offs.
+func messageFields(msg midi.Message) map[string]int {
+	var channel, key, value uint8
+	var relative int16
+	var absolute uint16
+	fields := map[string]int{"type": int(msg.Type())}
+
+	switch {
+	case msg.GetNoteStart(&channel, &key, &value):
+		fields["key"], fields["velocity"] = int(key), int(value)
+	case msg.GetNoteOff(&channel, &key, &value):
+		fields["type"], fields["key"], fields["velocity"] = int(midi.NoteOffMsg), int(key), int(value)
+	case msg.GetNoteOn(&channel, &key, &value):
+		fields["type"], fields["key"], fields["velocity"] = int(midi.NoteOffMsg), int(key), 0
+	case msg.GetPolyAfterTouch(&channel, &key, &value):
+		fields["key"], fields["pressure"] = int(key), int(value)
+	case msg.GetControlChange(&channel, &key, &value):
+		fields["controller"], fields["value"] = int(key), int(value)
+	case msg.GetAfterTouch(&channel, &value):
+		fields["pressure"] = int(value)
+	case msg.GetProgramChange(&channel, &value):
+		fields["program"] = int(value)
+	case msg.GetPitchBend(&channel, &relative, &absolute):
+		fields["bend"] = int(relative)
+	default:
+		return fields
+	}
+
+	fields["channel"] = int(channel) + 1
+	return fields
+}
+
+// expressionNode evaluates part of an expression.
+type expressionNode interface {
+	eval(fields map[string]int) bool
+}
+
+// andNode requires both operands.
+type andNode struct{ left, right expressionNode }
+
+func (o andNode) eval(fields map[string]int) bool {
+	return o.left.eval(fields) && o.right.eval(fields)
+}
+
+// orNode requires either operand.
+type orNode struct{ left, right expressionNode }
+
+func (o orNode) eval(fields map[string]int) bool {
+	return o.left.eval(fields) || o.right.eval(fields)
+}
+
+// notNode negates its operand.
+type notNode struct{ node expressionNode }
+
+func (o notNode) eval(fields map[string]int) bool {
+	return !o.node.eval(fields)
+}
+
+// compareNode compares a field to a value.
+type compareNode struct {
+	field string
+
+	op string
+
+	value int
+}
+
+func (o compareNode) eval(fields map[string]int) bool {
+	v, ok := fields[o.field]
+
+	if !ok {
+		return false
+	}
+
+	switch o.op {
+	case "==":
+		return v == o.value
+	case "!=":
+		return v != o.value
+	case "<":
+		return v < o.value
+	case "<=":
+		return v <= o.value
+	case ">":
+		return v > o.value
+	default:
+		return v >= o.value
+	}
+}
+
+// inNode tests a field for membership in a list of values.
+type inNode struct {
+	field string
+
+	values []int
+}
+
+func (o inNode) eval(fields map[string]int) bool {
+	v, ok := fields[o.field]
+	return ok && slices.Contains(o.values, v)
+}
+
+// tokenizeExpression splits an expression into operators, brackets, and words.
+func tokenizeExpression(s string) []string {
+	var tokens []string
+
+	for i := 0; i < len(s); {
+		c := s[i]
+
+		switch {
+		case c == ' ' || c == '\t':
+			i++
+		case strings.ContainsRune("()[],", rune(c)):
+			tokens = append(tokens, s[i:i+1])
+			i++
+		case strings.ContainsRune("=!<>&|", rune(c)):
+			j := i + 1
+
+			if j < len(s) && strings.ContainsRune("=&|", rune(s[j])) {
+				j++
+			}
+
+			tokens = append(tokens, s[i:j])
+			i = j
+		default:
+			j := i
+
+			for j < len(s) && !strings.ContainsRune(" \t()[],=!<>&|", rune(s[j])) {
+				j++
+			}
+
+			tokens = append(tokens, s[i:j])
+			i = j
+		}
+	}
+
+	return tokens
+}
+
+// expressionParser reads expressions by recursive descent.
+type expressionParser struct {
+	tokens []string
+
+	pos int
+}
+
+// peek reports the next token, if any.
+func (o *expressionParser) peek() string {
+	if o.pos < len(o.tokens) {
+		return o.tokens[o.pos]
+	}
+
+	return ""
+}
+
+// next consumes the next token.
+func (o *expressionParser) next() (string, error) {
+	if o.pos >= len(o.tokens) {
+		return "", fmt.Errorf("unexpected end")
+	}
+
+	o.pos++
+	return o.tokens[o.pos-1], nil
+}
+
+// expect consumes a specific token.
+func (o *expressionParser) expect(token string) error {
+	t, err := o.next()
+
+	if err == nil && t != token {
+		err = fmt.Errorf("expected %q, got %q", token, t)
+	}
+
+	return err
+}
+
+func (o *expressionParser) or() (expressionNode, error) {
+	left, err := o.and()
+
+	for err == nil && o.peek() == "||" {
+		o.pos++
+		var right expressionNode
+		right, err = o.and()
+		left = orNode{left, right}
+	}
+
+	return left, err
+}
+
+func (o *expressionParser) and() (expressionNode, error) {
+	left, err := o.unary()
+
+	for err == nil && o.peek() == "&&" {
+		o.pos++
+		var right expressionNode
+		right, err = o.unary()
+		left = andNode{left, right}
+	}
+
+	return left, err
+}
+
+func (o *expressionParser) unary() (expressionNode, error) {
+	switch o.peek() {
+	case "!":
+		o.pos++
+		node, err := o.unary()
+		return notNode{node}, err
+	case "(":
+		o.pos++
+		node, err := o.or()
+
+		if err != nil {
+			return nil, err
+		}
+
+		return node, o.expect(")")
+	}
+
+	return o.comparison()
+}
+
+func (o *expressionParser) comparison() (expressionNode, error) {
+	field, err := o.next()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !slices.Contains(FilterFields, field) {
+		return nil, fmt.Errorf("unknown field: %v", field)
+	}
+
+	op, err := o.next()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if op == "in" {
+		if err2 := o.expect("["); err2 != nil {
+			return nil, err2
+		}
+
+		node := inNode{field: field}
+
+		for {
+			value, err2 := o.value(field)
+
+			if err2 != nil {
+				return nil, err2
+			}
+
+			node.values = append(node.values, value)
+			separator, err2 := o.next()
+
+			if err2 != nil {
+				return nil, err2
+			}
+
+			if separator == "]" {
+				return node, nil
+			}
+
+			if separator != "," {
+				return nil, fmt.Errorf("expected \",\" or \"]\", got %q", separator)
+			}
+		}
+	}
+
+	switch op {
+	case "==", "!=", "<", "<=", ">", ">=":
+	default:
+		return nil, fmt.Errorf("unsupported operator: %v", op)
+	}
+
+	value, err := o.value(field)
+	return compareNode{field: field, op: op, value: value}, err
+}
+
+// value reads a literal for a field: a number, a message type name, or a note name.
+func (o *expressionParser) value(field string) (int, error) {
+	token, err := o.next()
+
+	if err != nil {
+		return 0, err
+	}
+
+	if n, err2 := strconv.Atoi(token); err2 == nil {
+		return n, nil
+	}
+
+	switch field {
+	case "type":
+		for typ, name := range textTypes {
+			if token == name || token == strings.ReplaceAll(name, "_", "") {
+				return int(typ), nil
+			}
+		}
+
+		if token == "cc" {
+			return int(midi.ControlChangeMsg), nil
+		}
+
+		return 0, fmt.Errorf("unknown message type: %v", token)
+	case "key":
+		key, err2 := ParseNote(token)
+		return int(key), err2
+	}
+
+	return 0, fmt.Errorf("invalid value for %v: %v", field, token)
+}
@@ -0,0 +1,182 @@
+package octane_test
+
+import (
+	"testing"
+
+	"github.com/mcandre/octane"
+	"gitlab.com/gomidi/midi/v2"
+	"gitlab.com/gomidi/midi/v2/drivers"
+)
+
+func TestExpressionMatch(t *testing.T) {
+	cases := []struct {
+		expression string
+		msg        midi.Message
+		match      bool
+	}{
+		{"type == noteon && channel in [1,2] && key >= C3 && velocity > 20", midi.NoteOn(0, 36, 100), true},
+		{"type == noteon && channel in [1,2] && key >= C3 && velocity > 20", midi.NoteOn(1, 127, 21), true},
+		{"type == noteon && channel in [1,2] && key >= C3 && velocity > 20", midi.NoteOn(2, 36, 100), false},
+		{"type == noteon && channel in [1,2] && key >= C3 && velocity > 20", midi.NoteOn(0, 35, 100), false},
+		{"type == noteon && channel in [1,2] && key >= C3 && velocity > 20", midi.NoteOn(0, 36, 20), false},
+		{"type == noteon && channel in [1,2] && key >= C3 && velocity > 20", midi.NoteOff(0, 36), false},
+		{"type == noteon && channel in [1,2] && key >= C3 && velocity > 20", midi.ControlChange(0, 74, 100), false},
+		{"type == note_off", midi.NoteOn(0, 60, 0), true},
+		{"type == cc && controller == 1", midi.ControlChange(0, 1, 0), true},
+		{"!(type == cc) || value < 64", midi.ControlChange(0, 1, 64), false},
+		{"!(type == cc) || value < 64", midi.NoteOn(0, 60, 100), true},
+		{"bend <= -4096", midi.Pitchbend(0, -8192), true},
+		{"velocity != 0", midi.ControlChange(0, 1, 64), false},
+		{"type == timingclock", midi.TimingClock(), true},
+		{"channel == 10 || channel == 11 && key == C#3", midi.NoteOn(10, 37, 1), true},
+		{"channel == 10 || channel == 11 && key == C#3", midi.NoteOn(10, 38, 1), false},
+		{"pressure > 0 && type in [aftertouch, polyaftertouch]", midi.AfterTouch(0, 1), true},
+		{"program in [0, 1]", midi.ProgramChange(15, 1), true},
+	}
+
+	for _, c := range cases {
+		expression, err := octane.ParseExpression(c.expression)
+
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+
+		if expression.Match(c.msg) != c.match {
+			t.Errorf("expected %v for %v against %v", c.match, c.expression, c.msg)
+		}
+	}
+
+	for _, s := range []string{
+		"",
+		"type",
+		"type ==",
+		"type == bogus",
+		"colour == 1",
+		"key == H3",
+		"channel =< 1",
+		"channel in [1, 2",
+		"channel in 1",
+		"(channel == 1",
+		"channel == 1)",
+		"channel == 1 &&",
+		"velocity > C3",
+	} {
+		if _, err := octane.ParseExpression(s); err == nil {
+			t.Errorf("expected error for %q", s)
+		}
+	}
+}
+
+func TestParseFilter(t *testing.T) {
+	filter, err := octane.ParseFilter("divert=mio:mio MIDI 1 24:0:channel == 10")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := octane.Filter{Match: "channel == 10", Action: octane.FilterDivert, Out: "mio:mio MIDI 1 24:0"}
+
+	if filter != expected {
+		t.Errorf("expected %v, got %v", expected, filter)
+	}
+
+	for _, s := range []string{"drop", "keep:channel == 1", "divert:channel == 1", "drop:channel"} {
+		if _, err2 := octane.ParseFilter(s); err2 == nil {
+			t.Errorf("expected error for %v", s)
+		}
+	}
+}
+
+func TestEngineFilters(t *testing.T) {
+	synth := &fakeOut{name: "synth"}
+	drums := &fakeOut{name: "drums"}
+	config := octane.Config{
+		Out: []string{"synth"},
+		Filters: []octane.Filter{
+			{Match: "type == cc && controller == 1", Action: octane.FilterDrop},
+			{Match: "type == timingclock", Action: octane.FilterPass},
+			{Match: "channel == 10", Action: octane.FilterDivert, Out: "drums"},
+		},
+	}
+
+	engine, err := octane.NewEngine(config, []drivers.Out{synth, drums})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	engine.Process(midi.ControlChange(0, 1, 64), false, true)
+	engine.Process(midi.ControlChange(0, 2, 64), false, true)
+	engine.Process(midi.TimingClock(), false, true)
+	engine.Process(midi.Start(), false, true)
+	engine.Process(midi.NoteOn(9, 36, 100), false, true)
+
+	if expected := []midi.Message{midi.ControlChange(0, 2, 64), midi.TimingClock()}; !equalMessages(synth.sent, expected) {
+		t.Errorf("expected %v, got %v", expected, synth.sent)
+	}
+
+	if expected := []midi.Message{midi.NoteOn(9, 36, 100)}; !equalMessages(drums.sent, expected) {
+		t.Errorf("expected %v, got %v", expected, drums.sent)
+	}
+
+	if err2 := (octane.Config{Filters: []octane.Filter{{Match: "channel", Action: octane.FilterDrop}}}).Validate(); err2 == nil {
+		t.Errorf("expected error for malformed filter expression")
+	}
+
+	for _, c := range []octane.Config{
+		{Filters: []octane.Filter{{Match: "channel == 10", Action: octane.FilterDivert, Out: "tr8"}}},
+		{Presets: []octane.Preset{{Name: "kit", Config: octane.Config{Filters: []octane.Filter{{Match: "channel == 10", Action: octane.FilterDivert, Out: "tr8"}}}}}},
+	} {
+		if _, err2 := octane.NewEngine(c, []drivers.Out{synth, drums}); err2 == nil {
+			t.Errorf("expected error for unknown divert device in %v", c)
+		}
+	}
+}
+
+func TestEngineFiltersNoteOff(t *testing.T) {
+	synth := &fakeOut{name: "synth"}
+	drums := &fakeOut{name: "drums"}
+	config := octane.Config{
+		Out: []string{"synth"},
+		Filters: []octane.Filter{
+			{Match: "type == noteon && velocity > 100", Action: octane.FilterDivert, Out: "drums"},
+			{Match: "type == noteoff && key == 60", Action: octane.FilterDivert, Out: "drums"},
+		},
+	}
+
+	engine, err := octane.NewEngine(config, []drivers.Out{synth, drums})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Note offs follow their note ons, whatever the filters.
+	engine.Process(midi.NoteOn(0, 36, 120), false, true)
+	engine.Process(midi.NoteOff(0, 36), false, true)
+	engine.Process(midi.NoteOn(0, 60, 80), false, true)
+	engine.Process(midi.NoteOff(0, 60), false, true)
+
+	if expected := []midi.Message{midi.NoteOn(0, 60, 80), midi.NoteOff(0, 60)}; !equalMessages(synth.sent, expected) {
+		t.Errorf("expected %v, got %v", expected, synth.sent)
+	}
+
+	if expected := []midi.Message{midi.NoteOn(0, 36, 120), midi.NoteOff(0, 36)}; !equalMessages(drums.sent, expected) {
+		t.Errorf("expected %v, got %v", expected, drums.sent)
+	}
+}
+
+// equalMessages compares message sequences.
+func equalMessages(a []midi.Message, b []midi.Message) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i].String() != b[i].String() {
+			return false
+		}
+	}
+
+	return true
+}
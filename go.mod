@@ -6,6 +6,8 @@ require (
 	github.com/magefile/mage v1.17.2
 	github.com/mcandre/mx v0.0.47
 	gitlab.com/gomidi/midi/v2 v2.3.23
+	go.starlark.net v0.0.0-20231121155337-90ade8b19d09
+	golang.org/x/sys v0.41.0
 )
 
 tool (
@@ -45,7 +47,6 @@ require (
 	golang.org/x/exp/typeparams v0.0.0-20250408133849-7e4ce0ab07d0 // indirect
 	golang.org/x/mod v0.33.0 // indirect
 	golang.org/x/sync v0.19.0 // indirect
-	golang.org/x/sys v0.41.0 // indirect
 	golang.org/x/term v0.40.0 // indirect
 	golang.org/x/tools v0.42.0 // indirect
 	honnef.co/go/tools v0.6.1 // indirect
@@ -0,0 +1,462 @@
+package octane
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"slices"
+	"sync"
+	"time"
+
+	"gitlab.com/gomidi/midi/v2"
+	"gitlab.com/gomidi/midi/v2/drivers"
+)
+
+// HelperBypass routes messages untransformed when the helper misses its latency budget.
+const HelperBypass = "bypass"
+
+// HelperDrop discards messages when the helper misses its latency budget.
+const HelperDrop = "drop"
+
+// DefaultHelperBudget denotes the default helper latency budget.
+const DefaultHelperBudget = 10 * time.Millisecond
+
+// HelperQueueSize denotes how many messages queue for the helper before the fallback applies.
+const HelperQueueSize = 1024
+
+// Helper configures an external process transforming messages over stdin and stdout.
+//
+// In the json format, octane writes one JSON object per line,
+// like {"direction": "in", "port": "KeyStep", "message": "...", "bytes": "90 3C 64"}.
+// The helper answers each line, in order, with a JSON array of zero or more objects,
+// like [{"bytes": "90 48 64"}].
+//
+// In the raw format, octane writes MIDI bytes,
+// and the helper writes MIDI bytes whenever it likes.
+// Replies are not matched to requests, so the budget covers only delivery to the helper.
+type Helper struct {
+	// Command denotes the program and its arguments.
+	Command []string `json:"command"`
+
+	// Format denotes StdioJSON (default) or StdioRaw.
+	Format string `json:"format,omitempty"`
+
+	// Budget denotes the latency budget, as a duration like "5ms".
+	// Default DefaultHelperBudget.
+	Budget string `json:"budget,omitempty"`
+
+	// Fallback denotes HelperBypass (default) or HelperDrop.
+	Fallback string `json:"fallback,omitempty"`
+}
+
+// Validate checks the helper for errors.
+func (o Helper) Validate() error {
+	if len(o.Command) == 0 || o.Command[0] == "" {
+		return fmt.Errorf("helper requires a command")
+	}
+
+	if o.Format != "" && o.Format != StdioJSON && o.Format != StdioRaw {
+		return fmt.Errorf("unsupported helper format: %v", o.Format)
+	}
+
+	if o.Fallback != "" && o.Fallback != HelperBypass && o.Fallback != HelperDrop {
+		return fmt.Errorf("unsupported helper fallback: %v", o.Fallback)
+	}
+
+	_, err := o.budget()
+	return err
+}
+
+// budget parses the latency budget.
+func (o Helper) budget() (time.Duration, error) {
+	if o.Budget == "" {
+		return DefaultHelperBudget, nil
+	}
+
+	budget, err := time.ParseDuration(o.Budget)
+
+	if err != nil || budget <= 0 {
+		return 0, fmt.Errorf("invalid helper budget: %v", o.Budget)
+	}
+
+	return budget, nil
+}
+
+// helperRequest tracks a message handed to the helper.
+type helperRequest struct {
+	in string
+
+	msg midi.Message
+
+	timer *time.Timer
+
+	// settled marks requests answered or expired.
+	settled bool
+}
+
+// helperProcess exchanges messages with a running helper.
+//
+// Requests never block the caller. Replies, and fallbacks for late or failed requests,
+// arrive via deliver from other goroutines.
+type helperProcess struct {
+	mutex sync.Mutex
+
+	config Helper
+
+	budget time.Duration
+
+	cmd *exec.Cmd
+
+	stdin io.WriteCloser
+
+	queue chan *helperRequest
+
+	done chan struct{}
+
+	exited chan struct{}
+
+	pending []*helperRequest
+
+	outstanding int
+
+	idle *sync.Cond
+
+	dead bool
+
+	deliver func(in string, msg midi.Message)
+
+	listener streamListener
+}
+
+// startHelper launches a helper process.
+func startHelper(config Helper, deliver func(in string, msg midi.Message)) (*helperProcess, error) {
+	budget, err := config.budget()
+
+	if err != nil {
+		return nil, err
+	}
+
+	cmd := exec.Command(config.Command[0], config.Command[1:]...)
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+
+	if err != nil {
+		return nil, err
+	}
+
+	stdout, err := cmd.StdoutPipe()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err2 := cmd.Start(); err2 != nil {
+		return nil, fmt.Errorf("helper: %v", err2)
+	}
+
+	o := &helperProcess{
+		config:  config,
+		budget:  budget,
+		cmd:     cmd,
+		stdin:   stdin,
+		queue:   make(chan *helperRequest, HelperQueueSize),
+		done:    make(chan struct{}),
+		exited:  make(chan struct{}),
+		deliver: deliver,
+	}
+
+	o.idle = sync.NewCond(&o.mutex)
+
+	go o.write()
+
+	go func() {
+		if config.Format == StdioRaw {
+			o.listener.listen(func(bs []byte, _ int32) { o.deliver("", midi.Message(bs)) }, drivers.ListenConfig{SysEx: true})
+			o.listener.receive(stdout)
+		} else {
+			o.read(stdout)
+		}
+
+		// Reap the helper once it closes its output, reporting unexpected exits.
+		err2 := cmd.Wait()
+
+		select {
+		case <-o.done:
+		default:
+			if err2 != nil {
+				fmt.Fprintf(os.Stderr, "helper: %v\n", err2)
+			} else {
+				fmt.Fprintln(os.Stderr, "helper: exited")
+			}
+		}
+
+		o.fail()
+		close(o.exited)
+	}()
+
+	return o, nil
+}
+
+// submit hands a message to the helper without blocking,
+// reporting false when the helper has failed or fallen too far behind.
+func (o *helperProcess) submit(in string, msg midi.Message) bool {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	if o.dead {
+		return false
+	}
+
+	request := &helperRequest{in: in, msg: msg}
+
+	select {
+	case o.queue <- request:
+	default:
+		return false
+	}
+
+	o.outstanding++
+	request.timer = time.AfterFunc(o.budget, func() { o.expire(request) })
+	return true
+}
+
+// finish counts a request as fully handled, once any replies or fallback are delivered.
+func (o *helperProcess) finish() {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	o.outstanding--
+
+	if o.outstanding == 0 {
+		o.idle.Broadcast()
+	}
+}
+
+// fallback applies the fallback policy to a message.
+func (o *helperProcess) fallback(request *helperRequest) {
+	if o.config.Fallback != HelperDrop {
+		o.deliver(request.in, request.msg)
+	}
+}
+
+// expire applies the fallback to a request outlasting the budget.
+// Late replies are discarded.
+func (o *helperProcess) expire(request *helperRequest) {
+	o.mutex.Lock()
+
+	if request.settled {
+		o.mutex.Unlock()
+		return
+	}
+
+	request.settled = true
+	o.mutex.Unlock()
+	o.fallback(request)
+	o.finish()
+}
+
+// write feeds queued requests to the helper.
+// Requests expiring while queued are skipped.
+func (o *helperProcess) write() {
+	for {
+		var request *helperRequest
+
+		select {
+		case <-o.done:
+			return
+		case request = <-o.queue:
+		}
+
+		o.mutex.Lock()
+
+		if request.settled {
+			o.mutex.Unlock()
+			continue
+		}
+
+		var bs []byte
+
+		if o.config.Format == StdioRaw {
+			bs = request.msg
+		} else {
+			o.pending = append(o.pending, request)
+			line, err := json.Marshal(NewMonitorEvent(DirectionIn, request.in, request.msg))
+
+			if err != nil {
+				o.mutex.Unlock()
+				continue
+			}
+
+			bs = append(line, '\n')
+		}
+
+		o.mutex.Unlock()
+
+		if _, err := o.stdin.Write(bs); err != nil {
+			o.stop()
+			return
+		}
+
+		if o.config.Format == StdioRaw {
+			o.mutex.Lock()
+			settled := request.settled
+			request.settled = true
+			request.timer.Stop()
+			o.mutex.Unlock()
+
+			if !settled {
+				o.finish()
+			}
+		}
+	}
+}
+
+// read matches JSON reply lines to requests, in order.
+// Malformed replies apply the fallback.
+func (o *helperProcess) read(r io.Reader) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1<<20)
+
+	for scanner.Scan() {
+		var replies []MonitorEvent
+		err := json.Unmarshal(scanner.Bytes(), &replies)
+
+		o.mutex.Lock()
+
+		if len(o.pending) == 0 {
+			o.mutex.Unlock()
+			continue
+		}
+
+		request := o.pending[0]
+		o.pending = o.pending[1:]
+		settled := request.settled
+		request.settled = true
+		request.timer.Stop()
+		o.mutex.Unlock()
+
+		if settled {
+			continue
+		}
+
+		var msgs []midi.Message
+
+		for _, reply := range replies {
+			bs, _, err2 := ParseHexBytes(reply.Bytes, false)
+
+			if err2 != nil || len(bs) == 0 {
+				err = fmt.Errorf("invalid helper reply: %v", reply.Bytes)
+				break
+			}
+
+			msgs = append(msgs, midi.Message(bs))
+		}
+
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "helper: %v\n", err)
+			o.fallback(request)
+		} else {
+			for _, msg := range msgs {
+				o.deliver(request.in, msg)
+			}
+		}
+
+		o.finish()
+	}
+}
+
+// fail marks the helper dead, applying the fallback to outstanding requests.
+func (o *helperProcess) fail() {
+	o.mutex.Lock()
+
+	if o.dead {
+		o.mutex.Unlock()
+		return
+	}
+
+	o.dead = true
+	var outstanding []*helperRequest
+
+	for _, request := range slices.Concat(o.pending, o.drain()) {
+		if !request.settled {
+			request.settled = true
+			request.timer.Stop()
+			outstanding = append(outstanding, request)
+		}
+	}
+
+	o.pending = nil
+	o.mutex.Unlock()
+
+	for _, request := range outstanding {
+		o.fallback(request)
+		o.finish()
+	}
+}
+
+// drain empties the queue.
+func (o *helperProcess) drain() []*helperRequest {
+	var requests []*helperRequest
+
+	for {
+		select {
+		case request := <-o.queue:
+			requests = append(requests, request)
+		default:
+			return requests
+		}
+	}
+}
+
+// close lets the helper finish outstanding requests, then closes its stdin,
+// allowing it the latency budget to exit before stopping it.
+func (o *helperProcess) close() {
+	o.mutex.Lock()
+
+	for o.outstanding > 0 {
+		o.idle.Wait()
+	}
+
+	o.mutex.Unlock()
+	o.quit()
+
+	if err := o.stdin.Close(); err != nil && !errors.Is(err, os.ErrClosed) {
+		fmt.Fprintf(os.Stderr, "helper: %v\n", err)
+	}
+
+	select {
+	case <-o.exited:
+	case <-time.After(o.budget):
+	}
+
+	o.stop()
+}
+
+// quit marks the helper as stopping, so that its exit goes unreported.
+func (o *helperProcess) quit() {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	select {
+	case <-o.done:
+	default:
+		close(o.done)
+	}
+}
+
+// stop terminates the helper. Outstanding requests apply the fallback.
+func (o *helperProcess) stop() {
+	o.quit()
+
+	// Waiting on the helper closes stdin first, when the helper exits on its own.
+	if err := o.stdin.Close(); err != nil && !errors.Is(err, os.ErrClosed) {
+		fmt.Fprintf(os.Stderr, "helper: %v\n", err)
+	}
+
+	if err := o.cmd.Process.Kill(); err != nil && err != os.ErrProcessDone {
+		fmt.Fprintf(os.Stderr, "helper: %v\n", err)
+	}
+}
@@ -0,0 +1,115 @@
+package octane_test
+
+import (
+	"os/exec"
+	"testing"
+	"time"
+
+	"github.com/mcandre/octane"
+	"gitlab.com/gomidi/midi/v2"
+	"gitlab.com/gomidi/midi/v2/drivers"
+)
+
+// awaitSent waits for a route to send count messages, briefly.
+func awaitSent(engine *octane.Engine, count uint64) uint64 {
+	deadline := time.Now().Add(2 * time.Second)
+
+	for engine.Status().Routes[0].Sent < count && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	return engine.Status().Routes[0].Sent
+}
+
+func TestEngineHelper(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("requires sh")
+	}
+
+	// Shell helpers read a message before stalling or exiting.
+	cases := []struct {
+		name     string
+		helper   octane.Helper
+		expected []midi.Message
+	}{
+		{
+			"echo json",
+			octane.Helper{Command: []string{"sed", "-u", `s/.*"bytes":"\([^"]*\)".*/[{"bytes":"\1"},{"bytes":"80 3C 00"}]/`}, Budget: "1s"},
+			[]midi.Message{midi.NoteOn(0, 60, 100), midi.NoteOff(0, 60)},
+		},
+		{
+			"echo raw",
+			octane.Helper{Command: []string{"cat"}, Format: octane.StdioRaw},
+			[]midi.Message{midi.NoteOn(0, 60, 100)},
+		},
+		{
+			"stall bypass",
+			octane.Helper{Command: []string{"sh", "-c", "read line; exec sleep 5"}, Budget: "20ms"},
+			[]midi.Message{midi.NoteOn(0, 60, 100)},
+		},
+		{
+			"exit bypass",
+			octane.Helper{Command: []string{"sh", "-c", "read line"}, Budget: "1s"},
+			[]midi.Message{midi.NoteOn(0, 60, 100)},
+		},
+	}
+
+	for _, c := range cases {
+		out := &fakeOut{name: "synth"}
+		engine, err := octane.NewEngine(octane.Config{Helper: &c.helper}, []drivers.Out{out})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		start := time.Now()
+		engine.Process(midi.NoteOn(0, 60, 100), false, true)
+
+		if sent := awaitSent(engine, uint64(len(c.expected))); sent != uint64(len(c.expected)) || !equalMessages(out.sent, c.expected) {
+			t.Errorf("%v: expected %v, got %v", c.name, c.expected, out.sent)
+		}
+
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("%v: expected prompt delivery, took %v", c.name, elapsed)
+		}
+
+		engine.Close()
+	}
+}
+
+func TestEngineHelperDrop(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("requires sh")
+	}
+
+	for _, command := range [][]string{{"sed", "-u", "s/.*/[]/"}, {"sh", "-c", "read line; exec sleep 5"}, {"true"}} {
+		out := &fakeOut{name: "synth"}
+		helper := octane.Helper{Command: command, Budget: "20ms", Fallback: octane.HelperDrop}
+		engine, err := octane.NewEngine(octane.Config{Helper: &helper}, []drivers.Out{out})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		engine.Process(midi.NoteOn(0, 60, 100), false, true)
+		time.Sleep(100 * time.Millisecond)
+
+		if sent := engine.Status().Routes[0].Sent; sent != 0 {
+			t.Errorf("%v: expected drop, got %v messages", command, sent)
+		}
+
+		engine.Close()
+	}
+
+	for _, helper := range []octane.Helper{
+		{},
+		{Command: []string{"cat"}, Format: "hex"},
+		{Command: []string{"cat"}, Budget: "soon"},
+		{Command: []string{"cat"}, Budget: "-1ms"},
+		{Command: []string{"cat"}, Fallback: "retry"},
+	} {
+		if err := helper.Validate(); err == nil {
+			t.Errorf("expected error for %v", helper)
+		}
+	}
+}
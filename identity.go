@@ -0,0 +1,212 @@
+package octane
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"gitlab.com/gomidi/midi/v2"
+	"gitlab.com/gomidi/midi/v2/drivers"
+)
+
+// DirectionIn labels MIDI IN devices.
+const DirectionIn = "in"
+
+// DirectionOut labels MIDI OUT devices.
+const DirectionOut = "out"
+
+// DefaultProbeTimeout denotes the default wait for Identity Reply messages.
+const DefaultProbeTimeout = 500 * time.Millisecond
+
+// IdentityRequest denotes a Universal Device Inquiry addressed to all devices.
+var IdentityRequest = midi.Message{0xF0, 0x7E, 0x7F, 0x06, 0x01, 0xF7}
+
+// Manufacturers names common SysEx manufacturer IDs, keyed by hex bytes.
+var Manufacturers = map[string]string{
+	"01":       "Sequential",
+	"04":       "Moog",
+	"06":       "Lexicon",
+	"07":       "Kurzweil",
+	"0F":       "Ensoniq",
+	"10":       "Oberheim",
+	"18":       "E-mu",
+	"40":       "Kawai",
+	"41":       "Roland",
+	"42":       "Korg",
+	"43":       "Yamaha",
+	"44":       "Casio",
+	"47":       "Akai",
+	"00 00 0E": "Alesis",
+	"00 00 66": "Mackie",
+	"00 01 05": "M-Audio",
+	"00 20 29": "Novation",
+	"00 20 32": "Behringer",
+	"00 20 33": "Access",
+	"00 20 3C": "Elektron",
+	"00 20 6B": "Arturia",
+	"00 20 76": "Teenage Engineering",
+	"00 21 09": "Native Instruments",
+}
+
+// Identity models a MIDI Identity Reply.
+type Identity struct {
+	// DeviceID denotes the SysEx channel of the replying device.
+	DeviceID uint8 `json:"deviceID"`
+
+	// ManufacturerID denotes the manufacturer's SysEx ID, as hex bytes.
+	ManufacturerID string `json:"manufacturerID"`
+
+	// Manufacturer names the manufacturer, when known.
+	Manufacturer string `json:"manufacturer,omitempty"`
+
+	// Family denotes the device family code.
+	Family uint16 `json:"family"`
+
+	// Model denotes the device family member code.
+	Model uint16 `json:"model"`
+
+	// Firmware denotes the software revision level, as hex bytes.
+	Firmware string `json:"firmware"`
+}
+
+// String summarizes the identity.
+func (o Identity) String() string {
+	manufacturer := o.Manufacturer
+
+	if manufacturer == "" {
+		manufacturer = o.ManufacturerID
+	}
+
+	return fmt.Sprintf("%v family 0x%04X model 0x%04X firmware %v", manufacturer, o.Family, o.Model, o.Firmware)
+}
+
+// ParseIdentityReply extracts an Identity from an Identity Reply message:
+//
+// F0 7E <device> 06 02 <manufacturer (1 or 3 bytes)> <family (2 bytes)> <model (2 bytes)> <firmware (4 bytes)> F7
+func ParseIdentityReply(msg midi.Message) (Identity, bool) {
+	if len(msg) < 5 || msg[0] != 0xF0 || msg[1] != 0x7E || msg[3] != 0x06 || msg[4] != 0x02 {
+		return Identity{}, false
+	}
+
+	body := msg[5:]
+	idLength := 1
+
+	if len(body) > 0 && body[0] == 0x00 {
+		idLength = 3
+	}
+
+	if len(body) < idLength+8+1 || body[idLength+8] != 0xF7 {
+		return Identity{}, false
+	}
+
+	manufacturerID := fmt.Sprintf("% X", []byte(body[:idLength]))
+	fields := body[idLength:]
+
+	return Identity{
+		DeviceID:       msg[2],
+		ManufacturerID: manufacturerID,
+		Manufacturer:   Manufacturers[manufacturerID],
+		Family:         uint16(fields[0]) | uint16(fields[1])<<7,
+		Model:          uint16(fields[2]) | uint16(fields[3])<<7,
+		Firmware:       fmt.Sprintf("% X", []byte(fields[4:8])),
+	}, true
+}
+
+// Probe describes a MIDI device, along with the identities that answered through it.
+type Probe struct {
+	// Number denotes the port number, unique per direction and kind.
+	Number int `json:"number"`
+
+	// Kind denotes PortDriver or a pseudo-port kind, like PortOSC.
+	Kind string `json:"kind"`
+
+	// Name denotes the full device name.
+	Name string `json:"name"`
+
+	// Direction denotes DirectionIn or DirectionOut.
+	Direction string `json:"direction"`
+
+	// Open reports whether the device is currently open.
+	Open bool `json:"open"`
+
+	// Identities collects Identity Reply messages.
+	Identities []Identity `json:"identities"`
+}
+
+// NewProbe describes a MIDI device.
+func NewProbe(port drivers.Port, direction string) Probe {
+	return Probe{
+		Number:     port.Number(),
+		Kind:       PortKind(port),
+		Name:       port.String(),
+		Direction:  direction,
+		Open:       port.IsOpen(),
+		Identities: []Identity{},
+	}
+}
+
+// ProbeIdentities sends an Identity Request to each MIDI OUT device in turn,
+// attributing Identity Reply messages arriving on any MIDI IN device within timeout
+// to both the MIDI OUT device and the receiving MIDI IN device.
+func ProbeIdentities(midiIns []drivers.In, midiOuts []drivers.Out, timeout time.Duration) []Probe {
+	var mutex sync.Mutex
+	var round []Identity
+	inProbes := make([]Probe, len(midiIns))
+	outProbes := make([]Probe, len(midiOuts))
+
+	for i, midiIn := range midiIns {
+		inProbes[i] = NewProbe(midiIn, DirectionIn)
+
+		react := func(msg midi.Message, _ int32) {
+			identity, ok := ParseIdentityReply(msg)
+
+			if !ok {
+				return
+			}
+
+			mutex.Lock()
+			defer mutex.Unlock()
+			round = append(round, identity)
+			inProbes[i].Identities = append(inProbes[i].Identities, identity)
+		}
+
+		stop, err := midi.ListenTo(midiIn, react, SysEx{}.Options()...)
+
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			continue
+		}
+
+		defer stop()
+	}
+
+	for i, midiOut := range midiOuts {
+		outProbes[i] = NewProbe(midiOut, DirectionOut)
+		sender, err := midi.SendTo(midiOut)
+
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			continue
+		}
+
+		mutex.Lock()
+		round = nil
+		mutex.Unlock()
+
+		if err2 := sender(IdentityRequest); err2 != nil {
+			fmt.Fprintln(os.Stderr, err2)
+			continue
+		}
+
+		time.Sleep(timeout)
+
+		mutex.Lock()
+		outProbes[i].Identities = append(outProbes[i].Identities, round...)
+		mutex.Unlock()
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	return append(inProbes, outProbes...)
+}
@@ -0,0 +1,55 @@
+package octane_test
+
+import (
+	"testing"
+
+	"github.com/mcandre/octane"
+	"gitlab.com/gomidi/midi/v2"
+	"gitlab.com/gomidi/midi/v2/drivers"
+)
+
+func TestParseIdentityReply(t *testing.T) {
+	reply := midi.Message{0xF0, 0x7E, 0x10, 0x06, 0x02, 0x43, 0x00, 0x41, 0x12, 0x01, 0x01, 0x00, 0x02, 0x00, 0xF7}
+	identity, ok := octane.ParseIdentityReply(reply)
+
+	if !ok {
+		t.Fatalf("expected identity reply")
+	}
+
+	expected := octane.Identity{
+		DeviceID:       0x10,
+		ManufacturerID: "43",
+		Manufacturer:   "Yamaha",
+		Family:         0x41 << 7,
+		Model:          0x12 | 0x01<<7,
+		Firmware:       "01 00 02 00",
+	}
+
+	if identity != expected {
+		t.Errorf("expected %v, got %v", expected, identity)
+	}
+
+	if _, ok2 := octane.ParseIdentityReply(octane.IdentityRequest); ok2 {
+		t.Errorf("expected identity request to be rejected")
+	}
+}
+
+func TestParseIdentityReplyExtendedManufacturer(t *testing.T) {
+	reply := midi.Message{0xF0, 0x7E, 0x7F, 0x06, 0x02, 0x00, 0x20, 0x6B, 0x02, 0x00, 0x04, 0x00, 0x01, 0x02, 0x03, 0x04, 0xF7}
+	identity, ok := octane.ParseIdentityReply(reply)
+
+	if !ok || identity.Manufacturer != "Arturia" || identity.Model != 4 {
+		t.Errorf("expected Arturia model 4, got %v", identity)
+	}
+}
+
+func TestNewProbeKind(t *testing.T) {
+	osc := octane.NewOSCPort(octane.OSCEndpoint{Name: "touchosc", Send: "127.0.0.1:9000"}, 0)
+	serial := octane.NewSerialPort(octane.SerialEndpoint{Name: "din", Device: "/dev/null"}, 0)
+
+	for port, kind := range map[drivers.Port]string{osc: octane.PortOSC, serial: octane.PortSerial, &fakeOut{name: "synth"}: octane.PortDriver} {
+		if probe := octane.NewProbe(port, octane.DirectionOut); probe.Kind != kind {
+			t.Errorf("expected %v kind %v, got %v", port, kind, probe.Kind)
+		}
+	}
+}
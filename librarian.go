@@ -0,0 +1,102 @@
+package octane
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"gitlab.com/gomidi/midi/v2"
+	"gitlab.com/gomidi/midi/v2/drivers"
+)
+
+// DefaultSysExDelay denotes the default pause between sent SysEx messages.
+const DefaultSysExDelay = 50 * time.Millisecond
+
+// SplitSysEx separates a .syx byte stream into F0 ... F7 SysEx messages.
+// Bytes outside of a complete message are ignored.
+func SplitSysEx(bs []byte) []midi.Message {
+	var msgs []midi.Message
+	start := -1
+
+	for i, b := range bs {
+		switch {
+		case b == 0xF0:
+			start = i
+		case b == 0xF7 && start >= 0:
+			msgs = append(msgs, midi.Message(bs[start:i+1]))
+			start = -1
+		}
+	}
+
+	return msgs
+}
+
+// ReadSysExFile loads SysEx messages from a .syx file.
+func ReadSysExFile(pth string) ([]midi.Message, error) {
+	bs, err := os.ReadFile(pth)
+
+	if err != nil {
+		return nil, err
+	}
+
+	msgs := SplitSysEx(bs)
+
+	if len(msgs) == 0 {
+		return nil, fmt.Errorf("no SysEx messages found in: %v", pth)
+	}
+
+	return msgs, nil
+}
+
+// DumpSysEx captures SysEx messages from a MIDI IN device,
+// writing each message to w as it arrives.
+//
+// onMessage is optional, and reports each captured message.
+// Returns a function to stop capturing.
+func DumpSysEx(midiIn drivers.In, w io.Writer, bufferSize uint32, onMessage func(midi.Message)) (func(), error) {
+	var mutex sync.Mutex
+
+	react := func(msg midi.Message, _ int32) {
+		if !msg.Is(midi.SysExMsg) {
+			return
+		}
+
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		if _, err := w.Write(msg); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return
+		}
+
+		if onMessage != nil {
+			onMessage(msg)
+		}
+	}
+
+	return midi.ListenTo(midiIn, react, SysEx{BufferSize: bufferSize}.Options()...)
+}
+
+// SendSysEx transmits SysEx messages to a MIDI OUT device,
+// pausing between messages so that slow devices do not overflow.
+func SendSysEx(midiOut drivers.Out, msgs []midi.Message, delay time.Duration) error {
+	sender, err := midi.SendTo(midiOut)
+
+	if err != nil {
+		return err
+	}
+
+	for i, msg := range msgs {
+		if i > 0 {
+			time.Sleep(delay)
+		}
+
+		if err2 := sender(msg); err2 != nil {
+			return err2
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,21 @@
+package octane_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/mcandre/octane"
+)
+
+func TestSplitSysEx(t *testing.T) {
+	bs := []byte{0x00, 0xF0, 0x43, 0x10, 0xF7, 0xF0, 0x41, 0xF7, 0xF0, 0x7E}
+	msgs := octane.SplitSysEx(bs)
+
+	if len(msgs) != 2 {
+		t.Fatalf("expected 2 messages, got %v", len(msgs))
+	}
+
+	if !bytes.Equal(msgs[0], []byte{0xF0, 0x43, 0x10, 0xF7}) || !bytes.Equal(msgs[1], []byte{0xF0, 0x41, 0xF7}) {
+		t.Errorf("expected complete SysEx messages, got % X", msgs)
+	}
+}
@@ -0,0 +1,139 @@
+package octane
+
+import (
+	"fmt"
+
+	"gitlab.com/gomidi/midi/v2"
+)
+
+// MonitorEvent describes a message passing through an Engine.
+type MonitorEvent struct {
+	// Direction denotes DirectionIn for received messages, or DirectionOut for sent messages.
+	Direction string `json:"direction"`
+
+	// Port names the MIDI device, when known.
+	Port string `json:"port,omitempty"`
+
+	// Message summarizes the message.
+	Message string `json:"message"`
+
+	// Bytes denotes the raw message, as hex bytes.
+	Bytes string `json:"bytes"`
+}
+
+// NewMonitorEvent describes a message.
+func NewMonitorEvent(direction string, port string, msg midi.Message) MonitorEvent {
+	return MonitorEvent{
+		Direction: direction,
+		Port:      port,
+		Message:   msg.String(),
+		Bytes:     fmt.Sprintf("% X", msg.Bytes()),
+	}
+}
+
+// RouteStatus describes a MIDI OUT device route.
+type RouteStatus struct {
+	// Out names the MIDI OUT device.
+	Out string `json:"out"`
+
+	// Enabled reports whether the active settings route messages to the device.
+	Enabled bool `json:"enabled"`
+
+	// Sounding counts the notes currently sounding on the device.
+	Sounding int `json:"sounding"`
+
+	// Sent counts the messages sent to the device.
+	Sent uint64 `json:"sent"`
+}
+
+// Status summarizes an Engine's runtime state.
+type Status struct {
+	// Preset names the active preset.
+	Preset string `json:"preset"`
+
+	// Presets names the configured presets.
+	Presets []string `json:"presets"`
+
+	// Transpose denotes the runtime note offset.
+	Transpose int `json:"transpose"`
+
+	// Bypass reports whether messages are forwarded without transformations.
+	Bypass bool `json:"bypass"`
+
+	// Routes describes each MIDI OUT device route.
+	Routes []RouteStatus `json:"routes"`
+
+	// Received counts incoming messages.
+	Received uint64 `json:"received"`
+
+	// Consumed counts incoming messages consumed by control mappings.
+	Consumed uint64 `json:"consumed"`
+}
+
+// notify reports a message to monitors.
+func (o *Engine) notify(direction string, port string, msg midi.Message) {
+	if len(o.monitors) == 0 {
+		return
+	}
+
+	event := NewMonitorEvent(direction, port, msg)
+
+	for _, monitor := range o.monitors {
+		monitor(event, msg)
+	}
+}
+
+// Monitor registers a callback for messages received and sent.
+// The callback runs while messages are processed, and so must not block.
+//
+// Returns a function to stop monitoring.
+func (o *Engine) Monitor(monitor func(MonitorEvent)) func() {
+	return o.monitor(func(event MonitorEvent, _ midi.Message) { monitor(event) })
+}
+
+// monitor registers a callback for messages received and sent,
+// along with the raw message.
+func (o *Engine) monitor(monitor func(MonitorEvent, midi.Message)) func() {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	o.monitorID++
+	id := o.monitorID
+	o.monitors[id] = monitor
+
+	return func() {
+		o.mutex.Lock()
+		defer o.mutex.Unlock()
+		delete(o.monitors, id)
+	}
+}
+
+// Status summarizes the runtime state.
+func (o *Engine) Status() Status {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	status := Status{
+		Preset:    o.preset,
+		Presets:   []string{},
+		Transpose: o.transpose,
+		Bypass:    o.bypass,
+		Routes:    []RouteStatus{},
+		Received:  o.received,
+		Consumed:  o.consumed,
+	}
+
+	for _, preset := range o.config.Presets {
+		status.Presets = append(status.Presets, preset.Name)
+	}
+
+	for _, r := range o.routes {
+		status.Routes = append(status.Routes, RouteStatus{
+			Out:      r.out.String(),
+			Enabled:  r.enabled,
+			Sounding: len(r.sounding),
+			Sent:     r.sent,
+		})
+	}
+
+	return status
+}
@@ -0,0 +1,397 @@
+package octane
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+
+	"gitlab.com/gomidi/midi/v2"
+)
+
+// ParameterNRPN denotes a non-registered parameter number (CC 99/98/6/38).
+const ParameterNRPN = "nrpn"
+
+// ParameterRPN denotes a registered parameter number (CC 101/100/6/38).
+const ParameterRPN = "rpn"
+
+// ParameterCC14 denotes a 14-bit control change MSB/LSB pair (CC n and n+32).
+const ParameterCC14 = "cc14"
+
+// ParameterCC denotes a plain 7-bit control change.
+const ParameterCC = "cc"
+
+// RPNNull denotes the RPN null selection (CC 101/100 = 127/127), deselecting any parameter.
+// Null parameters carry no value.
+const RPNNull uint16 = 0x3FFF
+
+// Parameter models a logical 14-bit controller event.
+type Parameter struct {
+	// Kind denotes ParameterNRPN, ParameterRPN, ParameterCC14, or ParameterCC.
+	Kind string
+
+	// Channel denotes a zero-based MIDI channel.
+	Channel uint8
+
+	// Number denotes the parameter number,
+	// or the MSB controller for 14-bit control changes.
+	Number uint16
+
+	// Value denotes a 14-bit value.
+	Value uint16
+}
+
+// ValidateParameterNumber checks a parameter number against its kind.
+func ValidateParameterNumber(kind string, number uint16) error {
+	var limit uint16
+
+	switch kind {
+	case ParameterNRPN, ParameterRPN:
+		limit = 16383
+	case ParameterCC14:
+		limit = 31
+	case ParameterCC:
+		limit = 127
+	default:
+		return fmt.Errorf("unsupported parameter kind: %v", kind)
+	}
+
+	if number > limit {
+		return fmt.Errorf("invalid %v parameter number: %v", kind, number)
+	}
+
+	return nil
+}
+
+// parameterSelection tracks the currently selected (N)RPN.
+type parameterSelection struct {
+	kind string
+	msb  uint8
+	lsb  uint8
+}
+
+// ParameterDecoder assembles control change sequences into parameters.
+type ParameterDecoder struct {
+	// CC14 lists MSB controllers (0-31) to pair with their LSB controllers (32-63).
+	CC14 []uint8
+
+	// CC lists 7-bit controllers to treat as parameters.
+	CC []uint8
+
+	selections [16]parameterSelection
+
+	dataMSBs [16]uint8
+
+	dataLSBs [16]uint8
+
+	cc14MSBs [16][32]uint8
+}
+
+// Decode consumes control changes belonging to parameters, emitting assembled parameters.
+// Per the MIDI specification, an MSB update resets the fine value,
+// and selecting a parameter resets the data value.
+// Data increments and decrements (CC 96/97) step the selected parameter's value by one.
+// The RPN null selection emits an RPNNull parameter.
+//
+// Returns false for messages that should pass through unchanged.
+func (o *ParameterDecoder) Decode(msg midi.Message, emit func(Parameter)) bool {
+	var channel uint8
+	var controller uint8
+	var value uint8
+
+	if !msg.GetControlChange(&channel, &controller, &value) {
+		return false
+	}
+
+	selection := &o.selections[channel]
+
+	switch {
+	case controller == midi.NonRegisteredParameterMSB || controller == midi.RegisteredParameterMSB || controller == midi.NonRegisteredParameterLSB || controller == midi.RegisteredParameterLSB:
+		kind := ParameterNRPN
+
+		if controller == midi.RegisteredParameterMSB || controller == midi.RegisteredParameterLSB {
+			kind = ParameterRPN
+		}
+
+		if selection.kind != kind {
+			*selection = parameterSelection{kind: kind}
+		}
+
+		if controller == midi.NonRegisteredParameterMSB || controller == midi.RegisteredParameterMSB {
+			selection.msb = value
+		} else {
+			selection.lsb = value
+		}
+
+		o.dataMSBs[channel] = 0
+		o.dataLSBs[channel] = 0
+
+		if kind == ParameterRPN && selection.msb == 127 && selection.lsb == 127 {
+			*selection = parameterSelection{}
+			emit(Parameter{Kind: ParameterRPN, Channel: channel, Number: RPNNull})
+		}
+
+		return true
+	case (controller == midi.DataEntryMSB || controller == midi.DataEntryLSB) && selection.kind != "":
+		if controller == midi.DataEntryMSB {
+			o.dataMSBs[channel] = value
+			o.dataLSBs[channel] = 0
+		} else {
+			o.dataLSBs[channel] = value
+		}
+
+		o.emitData(channel, emit)
+		return true
+	case (controller == midi.DataButtonIncrement || controller == midi.DataButtonDecrement) && selection.kind != "":
+		data := int(o.dataMSBs[channel])<<7 | int(o.dataLSBs[channel])
+
+		if controller == midi.DataButtonIncrement {
+			data = min(data+1, 16383)
+		} else {
+			data = max(data-1, 0)
+		}
+
+		o.dataMSBs[channel] = uint8(data >> 7)
+		o.dataLSBs[channel] = uint8(data & 0x7F)
+		o.emitData(channel, emit)
+		return true
+	case controller < 32 && slices.Contains(o.CC14, controller):
+		o.cc14MSBs[channel][controller] = value
+		emit(Parameter{Kind: ParameterCC14, Channel: channel, Number: uint16(controller), Value: uint16(value) << 7})
+		return true
+	case controller >= 32 && controller < 64 && slices.Contains(o.CC14, controller-32):
+		msb := o.cc14MSBs[channel][controller-32]
+		emit(Parameter{Kind: ParameterCC14, Channel: channel, Number: uint16(controller - 32), Value: uint16(msb)<<7 | uint16(value)})
+		return true
+	case slices.Contains(o.CC, controller):
+		emit(Parameter{Kind: ParameterCC, Channel: channel, Number: uint16(controller), Value: uint16(value) << 7})
+		return true
+	default:
+		return false
+	}
+}
+
+// emitData emits the selected parameter with its current data value.
+func (o *ParameterDecoder) emitData(channel uint8, emit func(Parameter)) {
+	selection := o.selections[channel]
+
+	emit(Parameter{
+		Kind:    selection.kind,
+		Channel: channel,
+		Number:  uint16(selection.msb)<<7 | uint16(selection.lsb),
+		Value:   uint16(o.dataMSBs[channel])<<7 | uint16(o.dataLSBs[channel]),
+	})
+}
+
+// ParameterEncoder serializes parameters into control change sequences.
+type ParameterEncoder struct {
+	// RunningParameter omits parameter number selection
+	// when the parameter is already selected on the output.
+	RunningParameter bool
+
+	selections [16]parameterSelection
+
+	dataMSBs [16]uint8
+
+	dataKnown [16]bool
+
+	cc14MSBs [16][32]uint8
+
+	cc14Known [16][32]bool
+}
+
+// Encode emits the control changes for a parameter.
+// MSB updates are omitted when the receiver already holds the same coarse value.
+// RPNNull parameters emit the null selection alone.
+func (o *ParameterEncoder) Encode(p Parameter, emit func(midi.Message)) {
+	channel := p.Channel
+	msb := uint8(p.Value >> 7 & 0x7F)
+	lsb := uint8(p.Value & 0x7F)
+
+	if p.Kind == ParameterRPN && p.Number == RPNNull {
+		emit(midi.ControlChange(channel, midi.RegisteredParameterMSB, 127))
+		emit(midi.ControlChange(channel, midi.RegisteredParameterLSB, 127))
+		o.selections[channel] = parameterSelection{}
+		o.dataKnown[channel] = false
+		return
+	}
+
+	switch p.Kind {
+	case ParameterNRPN, ParameterRPN:
+		selection := parameterSelection{kind: p.Kind, msb: uint8(p.Number >> 7 & 0x7F), lsb: uint8(p.Number & 0x7F)}
+
+		if !o.RunningParameter || o.selections[channel] != selection {
+			numberMSB, numberLSB := midi.NonRegisteredParameterMSB, midi.NonRegisteredParameterLSB
+
+			if p.Kind == ParameterRPN {
+				numberMSB, numberLSB = midi.RegisteredParameterMSB, midi.RegisteredParameterLSB
+			}
+
+			emit(midi.ControlChange(channel, numberMSB, selection.msb))
+			emit(midi.ControlChange(channel, numberLSB, selection.lsb))
+			o.selections[channel] = selection
+			o.dataKnown[channel] = false
+		}
+
+		if !o.dataKnown[channel] || o.dataMSBs[channel] != msb {
+			emit(midi.ControlChange(channel, midi.DataEntryMSB, msb))
+			o.dataMSBs[channel] = msb
+			o.dataKnown[channel] = true
+
+			if lsb == 0 {
+				return
+			}
+		}
+
+		emit(midi.ControlChange(channel, midi.DataEntryLSB, lsb))
+	case ParameterCC14:
+		controller := uint8(p.Number & 0x1F)
+
+		if !o.cc14Known[channel][controller] || o.cc14MSBs[channel][controller] != msb {
+			emit(midi.ControlChange(channel, controller, msb))
+			o.cc14MSBs[channel][controller] = msb
+			o.cc14Known[channel][controller] = true
+
+			if lsb == 0 {
+				return
+			}
+		}
+
+		emit(midi.ControlChange(channel, controller+32, lsb))
+	case ParameterCC:
+		emit(midi.ControlChange(channel, uint8(p.Number&0x7F), msb))
+	}
+}
+
+// ParameterMapping translates one parameter into another.
+type ParameterMapping struct {
+	// InKind denotes the source parameter kind.
+	InKind string `json:"inKind"`
+
+	// InChannel selects the source channel (1-16).
+	// Zero matches any channel.
+	InChannel uint8 `json:"inChannel,omitempty"`
+
+	// InNumber selects the source parameter number.
+	InNumber uint16 `json:"inNumber"`
+
+	// OutKind denotes the target parameter kind.
+	OutKind string `json:"outKind"`
+
+	// OutChannel selects the target channel (1-16).
+	// Zero preserves the source channel.
+	OutChannel uint8 `json:"outChannel,omitempty"`
+
+	// OutNumber selects the target parameter number.
+	OutNumber uint16 `json:"outNumber"`
+}
+
+// Validate checks the mapping for unsupported kinds and out of range fields.
+func (o ParameterMapping) Validate() error {
+	if o.InChannel > 16 || o.OutChannel > 16 {
+		return fmt.Errorf("parameter mapping has invalid MIDI channel")
+	}
+
+	if err := ValidateParameterNumber(o.InKind, o.InNumber); err != nil {
+		return err
+	}
+
+	return ValidateParameterNumber(o.OutKind, o.OutNumber)
+}
+
+// Parameters assembles, translates, and re-serializes NRPN, RPN, and 14-bit CC parameters.
+type Parameters struct {
+	// CC14 lists MSB controllers (0-31) to pair with their LSB controllers (32-63).
+	CC14 []uint8 `json:"cc14,omitempty"`
+
+	// Map collects parameter translations.
+	// Unmapped parameters are re-serialized as is.
+	Map []ParameterMapping `json:"map,omitempty"`
+
+	// RunningParameter omits parameter number selection
+	// when the parameter is already selected on the output.
+	RunningParameter bool `json:"runningParameter,omitempty"`
+}
+
+// Validate checks the stage for out of range fields.
+func (o Parameters) Validate() error {
+	for _, controller := range o.CC14 {
+		if controller > 31 {
+			return fmt.Errorf("invalid 14-bit MSB controller: %v", controller)
+		}
+	}
+
+	for _, mapping := range o.Map {
+		if err := mapping.Validate(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Transformer prepares a stateful parameter stage.
+func (o Parameters) Transformer() Transformer {
+	decoder := ParameterDecoder{CC14: o.CC14}
+
+	for _, mapping := range o.Map {
+		if mapping.InKind == ParameterCC {
+			decoder.CC = append(decoder.CC, uint8(mapping.InNumber))
+		}
+	}
+
+	return &parameters{
+		Parameters: o,
+		decoder:    decoder,
+		encoder:    ParameterEncoder{RunningParameter: o.RunningParameter},
+	}
+}
+
+// parameters tracks parameter assembly and serialization state.
+type parameters struct {
+	Parameters
+
+	mutex sync.Mutex
+
+	decoder ParameterDecoder
+
+	encoder ParameterEncoder
+}
+
+// translate applies the first matching mapping.
+// The RPN null selection passes through untranslated.
+func (o *parameters) translate(p Parameter) Parameter {
+	if p.Kind == ParameterRPN && p.Number == RPNNull {
+		return p
+	}
+
+	for _, mapping := range o.Map {
+		if mapping.InKind != p.Kind || mapping.InNumber != p.Number || !matchesChannel(mapping.InChannel, p.Channel) {
+			continue
+		}
+
+		p.Kind = mapping.OutKind
+		p.Number = mapping.OutNumber
+
+		if mapping.OutChannel != 0 {
+			p.Channel = mapping.OutChannel - 1
+		}
+
+		break
+	}
+
+	return p
+}
+
+// Transform assembles parameters, translates them, and re-serializes them.
+func (o *parameters) Transform(msg midi.Message, emit func(midi.Message)) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	consumed := o.decoder.Decode(msg, func(p Parameter) {
+		o.encoder.Encode(o.translate(p), emit)
+	})
+
+	if !consumed {
+		emit(msg)
+	}
+}
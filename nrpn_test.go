@@ -0,0 +1,178 @@
+package octane_test
+
+import (
+	"testing"
+
+	"github.com/mcandre/octane"
+	"gitlab.com/gomidi/midi/v2"
+)
+
+func TestParameterDecoderNRPN(t *testing.T) {
+	var decoder octane.ParameterDecoder
+	var got []octane.Parameter
+	emit := func(p octane.Parameter) { got = append(got, p) }
+
+	for _, msg := range []midi.Message{
+		midi.ControlChange(0, 99, 9),
+		midi.ControlChange(0, 98, 82),
+		midi.ControlChange(0, 6, 1),
+		midi.ControlChange(0, 38, 2),
+	} {
+		if !decoder.Decode(msg, emit) {
+			t.Errorf("expected %v to be consumed", msg)
+		}
+	}
+
+	expected := octane.Parameter{Kind: octane.ParameterNRPN, Number: 9<<7 | 82, Value: 1<<7 | 2}
+
+	if len(got) != 2 || got[1] != expected {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+
+	if decoder.Decode(midi.ControlChange(0, 74, 1), emit) {
+		t.Errorf("expected unrelated CC to pass through")
+	}
+}
+
+func TestParameterDecoderIncrement(t *testing.T) {
+	var decoder octane.ParameterDecoder
+	var got []octane.Parameter
+	emit := func(p octane.Parameter) { got = append(got, p) }
+
+	for _, msg := range []midi.Message{
+		midi.ControlChange(0, 101, 0),
+		midi.ControlChange(0, 100, 0),
+		midi.ControlChange(0, 6, 2),
+		midi.ControlChange(0, 38, 127),
+		midi.ControlChange(0, 96, 0),
+		midi.ControlChange(0, 97, 0),
+		midi.ControlChange(0, 97, 0),
+	} {
+		if !decoder.Decode(msg, emit) {
+			t.Errorf("expected %v to be consumed", msg)
+		}
+	}
+
+	expected := []uint16{2 << 7, 2<<7 | 127, 3 << 7, 2<<7 | 127, 2<<7 | 126}
+
+	if len(got) != len(expected) {
+		t.Fatalf("expected values %v, got %v", expected, got)
+	}
+
+	for i, value := range expected {
+		if got[i].Kind != octane.ParameterRPN || got[i].Number != 0 || got[i].Value != value {
+			t.Errorf("expected RPN 0 value %v, got %v", value, got[i])
+		}
+	}
+}
+
+func TestParameterDecoderSelection(t *testing.T) {
+	var decoder octane.ParameterDecoder
+	var got []octane.Parameter
+	emit := func(p octane.Parameter) { got = append(got, p) }
+
+	// A fresh selection forgets the previous parameter's data MSB.
+	for _, msg := range []midi.Message{
+		midi.ControlChange(0, 99, 1),
+		midi.ControlChange(0, 98, 2),
+		midi.ControlChange(0, 6, 100),
+		midi.ControlChange(0, 99, 1),
+		midi.ControlChange(0, 98, 3),
+		midi.ControlChange(0, 38, 5),
+	} {
+		decoder.Decode(msg, emit)
+	}
+
+	if expected := (octane.Parameter{Kind: octane.ParameterNRPN, Number: 1<<7 | 3, Value: 5}); len(got) != 2 || got[1] != expected {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+
+	got = nil
+	decoder.Decode(midi.ControlChange(0, 101, 127), emit)
+	decoder.Decode(midi.ControlChange(0, 100, 127), emit)
+
+	if expected := (octane.Parameter{Kind: octane.ParameterRPN, Number: octane.RPNNull}); len(got) != 1 || got[0] != expected {
+		t.Errorf("expected RPN null, got %v", got)
+	}
+
+	if decoder.Decode(midi.ControlChange(0, 6, 1), emit) || decoder.Decode(midi.ControlChange(0, 96, 0), emit) {
+		t.Errorf("expected data entry to pass through after RPN null")
+	}
+}
+
+func TestParametersRPNNull(t *testing.T) {
+	parameters := octane.Parameters{RunningParameter: true}.Transformer()
+	var got []midi.Message
+	emit := func(msg midi.Message) { got = append(got, msg) }
+
+	for _, msg := range []midi.Message{
+		midi.ControlChange(0, 101, 0),
+		midi.ControlChange(0, 100, 0),
+		midi.ControlChange(0, 6, 2),
+		midi.ControlChange(0, 101, 127),
+		midi.ControlChange(0, 100, 127),
+		midi.ControlChange(0, 101, 0),
+		midi.ControlChange(0, 100, 0),
+		midi.ControlChange(0, 6, 2),
+	} {
+		parameters.Transform(msg, emit)
+	}
+
+	// The null selection passes through, so that the selection repeats afterward.
+	expected := []midi.Message{
+		midi.ControlChange(0, 101, 0),
+		midi.ControlChange(0, 100, 0),
+		midi.ControlChange(0, 6, 2),
+		midi.ControlChange(0, 101, 127),
+		midi.ControlChange(0, 100, 127),
+		midi.ControlChange(0, 101, 0),
+		midi.ControlChange(0, 100, 0),
+		midi.ControlChange(0, 6, 2),
+	}
+
+	if len(got) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, got)
+	}
+
+	for i, msg := range expected {
+		if got[i].String() != msg.String() {
+			t.Errorf("expected %v, got %v", msg, got[i])
+		}
+	}
+}
+
+func TestParameterEncoderRunningParameter(t *testing.T) {
+	encoder := octane.ParameterEncoder{RunningParameter: true}
+	var got []midi.Message
+	emit := func(msg midi.Message) { got = append(got, msg) }
+
+	encoder.Encode(octane.Parameter{Kind: octane.ParameterRPN, Number: 0, Value: 2 << 7}, emit)
+
+	if len(got) != 3 {
+		t.Errorf("expected selection and data entry MSB, got %v", got)
+	}
+
+	got = nil
+	encoder.Encode(octane.Parameter{Kind: octane.ParameterRPN, Number: 0, Value: 2<<7 | 5}, emit)
+
+	if len(got) != 1 || got[0].String() != midi.ControlChange(0, 38, 5).String() {
+		t.Errorf("expected lone data entry LSB, got %v", got)
+	}
+}
+
+func TestParametersTranslate(t *testing.T) {
+	parameters := octane.Parameters{
+		CC14: []uint8{1},
+		Map:  []octane.ParameterMapping{{InKind: octane.ParameterCC14, InNumber: 1, OutKind: octane.ParameterCC14, OutNumber: 11}},
+	}.Transformer()
+
+	var got []midi.Message
+	emit := func(msg midi.Message) { got = append(got, msg) }
+
+	parameters.Transform(midi.ControlChange(0, 1, 3), emit)
+	parameters.Transform(midi.ControlChange(0, 33, 4), emit)
+
+	if len(got) != 2 || got[0].String() != midi.ControlChange(0, 11, 3).String() || got[1].String() != midi.ControlChange(0, 43, 4).String() {
+		t.Errorf("expected CC 11/43 pair, got %v", got)
+	}
+}
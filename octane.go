@@ -14,44 +14,115 @@ func TransposeKey(key uint8, offset int) uint8 {
 	return uint8((int(key) + offset) % 128)
 }
 
+// Transformer rewrites MIDI messages.
+type Transformer interface {
+	// Transform emits zero or more messages in response to msg.
+	Transform(msg midi.Message, emit func(midi.Message))
+}
+
+// Chain applies transformers in sequence.
+type Chain []Transformer
+
+// Transform feeds msg through each transformer in turn.
+func (o Chain) Transform(msg midi.Message, emit func(midi.Message)) {
+	if len(o) == 0 {
+		emit(msg)
+		return
+	}
+
+	rest := o[1:]
+
+	o[0].Transform(msg, func(m midi.Message) {
+		rest.Transform(m, emit)
+	})
+}
+
+// Transpose shifts note keys by an offset.
+type Transpose struct {
+	// Offset denotes a signed note offset.
+	Offset int
+}
+
+// Transform applies the note offset.
+func (o Transpose) Transform(msg midi.Message, emit func(midi.Message)) {
+	var channel uint8
+	var key uint8
+	var velocity uint8
+
+	switch {
+	case msg.GetNoteStart(&channel, &key, &velocity):
+		emit(midi.NoteOn(channel, TransposeKey(key, o.Offset), velocity))
+	case msg.GetNoteEnd(&channel, &key):
+		emit(midi.NoteOff(channel, TransposeKey(key, o.Offset)))
+	default:
+		emit(msg)
+	}
+}
+
+// Route pairs a MIDI OUT device with its own transformation.
+//
+// Deprecated: Use Config and NewEngine.
+type Route struct {
+	// Out denotes a MIDI OUT device.
+	Out drivers.Out
+
+	// Transformer rewrites messages bound for Out.
+	Transformer Transformer
+}
+
 // Stream begins copying data between MIDI IN devices,
 // with an optional note transposition.
+//
+// Deprecated: Use NewEngine and Engine.Listen, which add runtime control, presets, and filters.
 func Stream(midiIn drivers.In, midiOuts []drivers.Out, offset int) {
-	var senders []func(msg midi.Message) error
+	var routes []Route
 
 	for _, midiOut := range midiOuts {
-		sender, err := midi.SendTo(midiOut)
+		routes = append(routes, Route{Out: midiOut, Transformer: Transpose{Offset: offset}})
+	}
 
-		if err != nil {
-			fmt.Fprintln(os.Stderr, err)
-			break
-		}
+	//lint:ignore SA1019 Stream wraps StreamRoutes.
+	StreamRoutes(midiIn, routes)
+}
+
+// StreamRoutes begins copying data between MIDI IN devices
+// and each routed MIDI OUT device, with optional transformations.
+//
+// SysEx messages pass through when enabled by the listening options.
+//
+// Deprecated: Use NewEngine and Engine.Listen, which add runtime control, presets, and filters.
+func StreamRoutes(midiIn drivers.In, routes []Route, opts ...midi.Option) {
+	var midiOuts []drivers.Out
 
-		senders = append(senders, sender)
+	for _, route := range routes {
+		midiOuts = append(midiOuts, route.Out)
 	}
 
-	var channel uint8
-	var key uint8
-	var velocity uint8
+	engine, err := NewEngine(Config{}, midiOuts)
 
-	react := func(msg midi.Message, _ int32) {
-		switch {
-		case msg.GetNoteStart(&channel, &key, &velocity):
-			for _, sender := range senders {
-				if err := sender(midi.NoteOn(channel, TransposeKey(key, offset), velocity)); err != nil {
-					fmt.Fprintln(os.Stderr, err)
-				}
-			}
-		case msg.GetNoteEnd(&channel, &key):
-			for _, sender := range senders {
-				if err := sender(midi.NoteOff(channel, TransposeKey(key, offset))); err != nil {
-					fmt.Fprintln(os.Stderr, err)
-				}
-			}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return
+	}
+
+	engine.mutex.Lock()
+
+	for i, route := range routes {
+		engine.routes[i].transformer = route.Transformer
+
+		if route.Transformer == nil {
+			engine.routes[i].transformer = Chain{}
 		}
 	}
 
-	if _, err := midi.ListenTo(midiIn, react); err != nil {
+	engine.mutex.Unlock()
+	name := midiIn.String()
+
+	react := func(msg midi.Message, _ int32) {
+		engine.Inject(name, msg)
+	}
+
+	if _, err := midi.ListenTo(midiIn, react, opts...); err != nil {
 		fmt.Fprintln(os.Stderr, err)
 	}
 }
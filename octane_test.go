@@ -1,9 +1,12 @@
 package octane_test
 
 import (
+	"bytes"
+	"strings"
 	"testing"
 
 	"github.com/mcandre/octane"
+	"gitlab.com/gomidi/midi/v2/drivers"
 )
 
 func TestTransposeKeySymmetric(t *testing.T) {
@@ -15,3 +18,30 @@ func TestTransposeKeySymmetric(t *testing.T) {
 		}
 	}
 }
+
+func TestStream(t *testing.T) {
+	for _, stream := range []func(drivers.In, drivers.Out){
+		func(in drivers.In, out drivers.Out) {
+			//lint:ignore SA1019 Stream remains for downstream callers.
+			octane.Stream(in, []drivers.Out{out}, 12)
+		},
+		func(in drivers.In, out drivers.Out) {
+			//lint:ignore SA1019 StreamRoutes remains for downstream callers.
+			octane.StreamRoutes(in, []octane.Route{{Out: out, Transformer: octane.Transpose{Offset: 12}}})
+		},
+	} {
+		var stdout bytes.Buffer
+		port, err := octane.NewStdioPort(octane.StdioName, strings.NewReader("90 3C 64\n"), &stdout, octane.StdioHex)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		stream(port, port)
+		<-port.Done()
+
+		if output := stdout.String(); output != "90 48 64\n" {
+			t.Errorf("expected transposed note, got %q", output)
+		}
+	}
+}
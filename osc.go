@@ -0,0 +1,590 @@
+package octane
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+
+	"gitlab.com/gomidi/midi/v2"
+	"gitlab.com/gomidi/midi/v2/drivers"
+)
+
+// OSCBend converts pitch bend to and from OSC.
+const OSCBend = "bend"
+
+// OSCMaxPacket denotes the largest OSC packet accepted, in bytes.
+const OSCMaxPacket = 65535
+
+// OSCMessage models an Open Sound Control message.
+type OSCMessage struct {
+	// Address denotes the OSC address, such as "/synth/1/cutoff".
+	Address string
+
+	// Args collects int32, float32, and string arguments.
+	Args []any
+}
+
+// appendOSCString writes a null terminated string, padded to four bytes.
+func appendOSCString(bs []byte, s string) []byte {
+	bs = append(bs, s...)
+	return append(bs, make([]byte, 4-len(s)%4)...)
+}
+
+// readOSCString reads a padded OSC string, returning the remaining bytes.
+func readOSCString(bs []byte) (string, []byte, error) {
+	end := bytes.IndexByte(bs, 0)
+
+	if end < 0 {
+		return "", nil, fmt.Errorf("unterminated OSC string")
+	}
+
+	padded := (end/4 + 1) * 4
+
+	if padded > len(bs) {
+		return "", nil, fmt.Errorf("truncated OSC string")
+	}
+
+	return string(bs[:end]), bs[padded:], nil
+}
+
+// Encode serializes the message.
+func (o OSCMessage) Encode() ([]byte, error) {
+	tags := ","
+	var args []byte
+
+	for _, arg := range o.Args {
+		switch v := arg.(type) {
+		case int32:
+			tags += "i"
+			args = binary.BigEndian.AppendUint32(args, uint32(v))
+		case float32:
+			tags += "f"
+			args = binary.BigEndian.AppendUint32(args, math.Float32bits(v))
+		case string:
+			tags += "s"
+			args = appendOSCString(args, v)
+		default:
+			return nil, fmt.Errorf("unsupported OSC argument: %v", arg)
+		}
+	}
+
+	bs := appendOSCString(nil, o.Address)
+	bs = appendOSCString(bs, tags)
+	return append(bs, args...), nil
+}
+
+// DecodeOSC parses an OSC packet, flattening bundles into their messages.
+func DecodeOSC(bs []byte) ([]OSCMessage, error) {
+	if bytes.HasPrefix(bs, []byte("#bundle\x00")) {
+		if len(bs) < 16 {
+			return nil, fmt.Errorf("truncated OSC bundle")
+		}
+
+		var msgs []OSCMessage
+		rest := bs[16:]
+
+		for len(rest) > 0 {
+			if len(rest) < 4 {
+				return nil, fmt.Errorf("truncated OSC bundle element")
+			}
+
+			size := int(binary.BigEndian.Uint32(rest))
+			rest = rest[4:]
+
+			if size > len(rest) {
+				return nil, fmt.Errorf("truncated OSC bundle element")
+			}
+
+			elements, err := DecodeOSC(rest[:size])
+
+			if err != nil {
+				return nil, err
+			}
+
+			msgs = append(msgs, elements...)
+			rest = rest[size:]
+		}
+
+		return msgs, nil
+	}
+
+	address, rest, err := readOSCString(bs)
+
+	if err != nil {
+		return nil, err
+	}
+
+	msg := OSCMessage{Address: address}
+
+	if len(rest) == 0 {
+		return []OSCMessage{msg}, nil
+	}
+
+	tags, rest, err := readOSCString(rest)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !strings.HasPrefix(tags, ",") {
+		return nil, fmt.Errorf("invalid OSC type tags: %v", tags)
+	}
+
+	for _, tag := range tags[1:] {
+		switch tag {
+		case 'i', 'f':
+			if len(rest) < 4 {
+				return nil, fmt.Errorf("truncated OSC argument")
+			}
+
+			bits := binary.BigEndian.Uint32(rest)
+			rest = rest[4:]
+
+			if tag == 'i' {
+				msg.Args = append(msg.Args, int32(bits))
+			} else {
+				msg.Args = append(msg.Args, math.Float32frombits(bits))
+			}
+		case 's':
+			var s string
+
+			if s, rest, err = readOSCString(rest); err != nil {
+				return nil, err
+			}
+
+			msg.Args = append(msg.Args, s)
+		case 'T':
+			msg.Args = append(msg.Args, int32(1))
+		case 'F', 'N', 'I':
+			msg.Args = append(msg.Args, int32(0))
+		default:
+			return nil, fmt.Errorf("unsupported OSC type tag: %c", tag)
+		}
+	}
+
+	return []OSCMessage{msg}, nil
+}
+
+// OSCMapping converts between a MIDI message type and an OSC address.
+//
+// Addresses may include {channel} (1-16) and {number} (key or controller) placeholders,
+// as whole address segments.
+// Each OSC message carries a single float argument,
+// scaled between Min and Max.
+type OSCMapping struct {
+	// Type denotes ControlNote, ControlCC, or OSCBend.
+	Type string `json:"type"`
+
+	// Channel selects the channel (1-16).
+	// Zero matches any channel, and defaults incoming OSC messages to channel 1.
+	Channel uint8 `json:"channel,omitempty"`
+
+	// Number selects the key or controller (0-127).
+	// Omitted matches any key or controller.
+	Number *uint8 `json:"number,omitempty"`
+
+	// Address denotes the OSC address pattern.
+	Address string `json:"address"`
+
+	// Min denotes the OSC argument for the lowest MIDI value.
+	Min float64 `json:"min,omitempty"`
+
+	// Max denotes the OSC argument for the highest MIDI value.
+	// When both Min and Max are zero, the range defaults to 0-1.
+	Max float64 `json:"max,omitempty"`
+}
+
+// Validate checks the mapping for errors.
+func (o OSCMapping) Validate() error {
+	switch o.Type {
+	case ControlNote, ControlCC, OSCBend:
+	default:
+		return fmt.Errorf("unsupported OSC mapping type: %v", o.Type)
+	}
+
+	if o.Channel > 16 || (o.Number != nil && *o.Number > 127) {
+		return fmt.Errorf("OSC mapping %v has out of range fields", o.Address)
+	}
+
+	if !strings.HasPrefix(o.Address, "/") {
+		return fmt.Errorf("OSC address must begin with a slash: %v", o.Address)
+	}
+
+	if o.Type != OSCBend && o.Number == nil && !strings.Contains(o.Address, "{number}") {
+		return fmt.Errorf("OSC mapping %v requires a number or {number} placeholder", o.Address)
+	}
+
+	return nil
+}
+
+// bounds reports the OSC argument range.
+func (o OSCMapping) bounds() (float64, float64) {
+	if o.Min == 0 && o.Max == 0 {
+		return 0, 1
+	}
+
+	return o.Min, o.Max
+}
+
+// ToOSC converts a matching MIDI message.
+// Note offs carry the minimum argument.
+func (o OSCMapping) ToOSC(msg midi.Message) (OSCMessage, bool) {
+	var channel uint8
+	var number uint8
+	var value uint8
+	var fraction float64
+
+	switch {
+	case o.Type == ControlNote && msg.GetNoteStart(&channel, &number, &value):
+		fraction = float64(value) / 127
+	case o.Type == ControlNote && msg.GetNoteEnd(&channel, &number):
+	case o.Type == ControlCC && msg.GetControlChange(&channel, &number, &value):
+		fraction = float64(value) / 127
+	case o.Type == OSCBend:
+		var relative int16
+		var absolute uint16
+
+		if !msg.GetPitchBend(&channel, &relative, &absolute) {
+			return OSCMessage{}, false
+		}
+
+		fraction = float64(absolute) / 16383
+	default:
+		return OSCMessage{}, false
+	}
+
+	if !matchesChannel(o.Channel, channel) || (o.Type != OSCBend && o.Number != nil && *o.Number != number) {
+		return OSCMessage{}, false
+	}
+
+	address := strings.ReplaceAll(o.Address, "{channel}", strconv.Itoa(int(channel)+1))
+	address = strings.ReplaceAll(address, "{number}", strconv.Itoa(int(number)))
+	low, high := o.bounds()
+	return OSCMessage{Address: address, Args: []any{float32(low + fraction*(high-low))}}, true
+}
+
+// FromOSC converts a matching OSC message.
+// Note arguments at or below the minimum become note offs.
+func (o OSCMapping) FromOSC(msg OSCMessage) (midi.Message, bool) {
+	pattern := strings.Split(o.Address, "/")
+	segments := strings.Split(msg.Address, "/")
+
+	if len(pattern) != len(segments) || len(msg.Args) == 0 {
+		return nil, false
+	}
+
+	channel := max(o.Channel, 1)
+	var number uint8
+
+	if o.Number != nil {
+		number = *o.Number
+	}
+
+	for i, segment := range pattern {
+		switch segment {
+		case "{channel}":
+			n, err := strconv.ParseUint(segments[i], 10, 8)
+
+			if err != nil || n < 1 || n > 16 || (o.Channel != 0 && uint8(n) != o.Channel) {
+				return nil, false
+			}
+
+			channel = uint8(n)
+		case "{number}":
+			n, err := strconv.ParseUint(segments[i], 10, 8)
+
+			if err != nil || n > 127 || (o.Number != nil && uint8(n) != *o.Number) {
+				return nil, false
+			}
+
+			number = uint8(n)
+		default:
+			if segment != segments[i] {
+				return nil, false
+			}
+		}
+	}
+
+	var argument float64
+
+	switch v := msg.Args[0].(type) {
+	case int32:
+		argument = float64(v)
+	case float32:
+		argument = float64(v)
+	default:
+		return nil, false
+	}
+
+	low, high := o.bounds()
+	fraction := 0.0
+
+	if high != low {
+		fraction = min(max((argument-low)/(high-low), 0), 1)
+	}
+
+	switch o.Type {
+	case ControlNote:
+		velocity := uint8(math.Round(fraction * 127))
+
+		if velocity == 0 {
+			return midi.NoteOff(channel-1, number), true
+		}
+
+		return midi.NoteOn(channel-1, number, velocity), true
+	case ControlCC:
+		return midi.ControlChange(channel-1, number, uint8(math.Round(fraction*127))), true
+	default:
+		return midi.Pitchbend(channel-1, int16(math.Round(fraction*16383))-8192), true
+	}
+}
+
+// OSCEndpoint declares an OSC pseudo-port.
+type OSCEndpoint struct {
+	// Name identifies the pseudo-port, for selection as a MIDI IN or MIDI OUT device.
+	Name string `json:"name"`
+
+	// Listen denotes a local UDP address to receive OSC messages,
+	// making the endpoint a MIDI IN device.
+	Listen string `json:"listen,omitempty"`
+
+	// Send denotes a remote UDP address to send OSC messages,
+	// making the endpoint a MIDI OUT device.
+	Send string `json:"send,omitempty"`
+
+	// Map collects conversions. The first matching mapping applies.
+	Map []OSCMapping `json:"map"`
+}
+
+// Validate checks the endpoint for errors.
+func (o OSCEndpoint) Validate() error {
+	if o.Name == "" {
+		return fmt.Errorf("OSC endpoint requires a name")
+	}
+
+	if o.Listen == "" && o.Send == "" {
+		return fmt.Errorf("OSC endpoint %v requires a listen or send address", o.Name)
+	}
+
+	for _, mapping := range o.Map {
+		if err := mapping.Validate(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// OSCPort presents an OSC endpoint as a MIDI device.
+// OSCPort implements drivers.In when listening, and drivers.Out when sending.
+type OSCPort struct {
+	mutex sync.Mutex
+
+	endpoint OSCEndpoint
+
+	number int
+
+	conn *net.UDPConn
+
+	remote *net.UDPAddr
+
+	onMsg func([]byte, int32)
+}
+
+// NewOSCPort prepares an OSC pseudo-port.
+// number distinguishes the port from other pseudo-ports.
+func NewOSCPort(endpoint OSCEndpoint, number int) *OSCPort {
+	return &OSCPort{endpoint: endpoint, number: number}
+}
+
+// Open binds the UDP socket.
+func (o *OSCPort) Open() error {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	if o.conn != nil {
+		return nil
+	}
+
+	var local *net.UDPAddr
+
+	if o.endpoint.Listen != "" {
+		addr, err := net.ResolveUDPAddr("udp", o.endpoint.Listen)
+
+		if err != nil {
+			return err
+		}
+
+		local = addr
+	}
+
+	if o.endpoint.Send != "" {
+		addr, err := net.ResolveUDPAddr("udp", o.endpoint.Send)
+
+		if err != nil {
+			return err
+		}
+
+		o.remote = addr
+	}
+
+	conn, err := net.ListenUDP("udp", local)
+
+	if err != nil {
+		return err
+	}
+
+	o.conn = conn
+
+	if o.endpoint.Listen != "" {
+		go o.receive(conn)
+	}
+
+	return nil
+}
+
+// receive converts incoming OSC packets until the socket closes.
+func (o *OSCPort) receive(conn *net.UDPConn) {
+	packet := make([]byte, OSCMaxPacket)
+
+	for {
+		n, _, err := conn.ReadFromUDP(packet)
+
+		if err != nil {
+			return
+		}
+
+		msgs, err := DecodeOSC(packet[:n])
+
+		if err != nil {
+			continue
+		}
+
+		o.mutex.Lock()
+		onMsg := o.onMsg
+		o.mutex.Unlock()
+
+		if onMsg == nil {
+			continue
+		}
+
+		for _, msg := range msgs {
+			for _, mapping := range o.endpoint.Map {
+				if m, ok := mapping.FromOSC(msg); ok {
+					onMsg(m, 0)
+					break
+				}
+			}
+		}
+	}
+}
+
+// Close releases the UDP socket.
+func (o *OSCPort) Close() error {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	if o.conn == nil {
+		return nil
+	}
+
+	err := o.conn.Close()
+	o.conn = nil
+	return err
+}
+
+// IsOpen reports whether the UDP socket is bound.
+func (o *OSCPort) IsOpen() bool {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	return o.conn != nil
+}
+
+// Number distinguishes the port from other pseudo-ports.
+func (o *OSCPort) Number() int { return o.number }
+
+// String names the port.
+func (o *OSCPort) String() string { return o.endpoint.Name }
+
+// Underlying exposes the endpoint settings.
+func (o *OSCPort) Underlying() interface{} { return o.endpoint }
+
+// Listen begins converting incoming OSC messages to MIDI.
+func (o *OSCPort) Listen(onMsg func([]byte, int32), _ drivers.ListenConfig) (func(), error) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	if o.conn == nil {
+		return nil, drivers.ErrPortClosed
+	}
+
+	o.onMsg = onMsg
+
+	return func() {
+		o.mutex.Lock()
+		defer o.mutex.Unlock()
+		o.onMsg = nil
+	}, nil
+}
+
+// Send converts a MIDI message to OSC, per the first matching mapping.
+// Unmapped messages are dropped.
+func (o *OSCPort) Send(data []byte) error {
+	o.mutex.Lock()
+	conn := o.conn
+	remote := o.remote
+	o.mutex.Unlock()
+
+	if conn == nil {
+		return drivers.ErrPortClosed
+	}
+
+	if remote == nil {
+		return nil
+	}
+
+	for _, mapping := range o.endpoint.Map {
+		msg, ok := mapping.ToOSC(midi.Message(data))
+
+		if !ok {
+			continue
+		}
+
+		bs, err := msg.Encode()
+
+		if err != nil {
+			return err
+		}
+
+		_, err = conn.WriteToUDP(bs, remote)
+		return err
+	}
+
+	return nil
+}
+
+// OSCPorts prepares pseudo-ports for the configured OSC endpoints.
+// Listening endpoints serve as MIDI IN devices, and sending endpoints as MIDI OUT devices.
+func (o Config) OSCPorts() ([]drivers.In, []drivers.Out) {
+	var ins []drivers.In
+	var outs []drivers.Out
+
+	for i, endpoint := range o.OSC {
+		port := NewOSCPort(endpoint, i)
+
+		if endpoint.Listen != "" {
+			ins = append(ins, port)
+		}
+
+		if endpoint.Send != "" {
+			outs = append(outs, port)
+		}
+	}
+
+	return ins, outs
+}
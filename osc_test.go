@@ -0,0 +1,151 @@
+package octane_test
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/mcandre/octane"
+	"gitlab.com/gomidi/midi/v2"
+)
+
+func TestOSCMessageEncode(t *testing.T) {
+	msg := octane.OSCMessage{Address: "/synth/1", Args: []any{int32(7), float32(0.5), "saw"}}
+	bs, err := msg.Encode()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(bs)%4 != 0 {
+		t.Errorf("expected 4 byte alignment, got %v bytes", len(bs))
+	}
+
+	msgs, err := octane.DecodeOSC(bs)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(msgs) != 1 || msgs[0].Address != msg.Address || len(msgs[0].Args) != 3 {
+		t.Fatalf("expected %v, got %v", msg, msgs)
+	}
+
+	for i, arg := range msg.Args {
+		if msgs[0].Args[i] != arg {
+			t.Errorf("expected %v, got %v", arg, msgs[0].Args[i])
+		}
+	}
+
+	if _, err2 := octane.DecodeOSC([]byte("/bad")); err2 == nil {
+		t.Errorf("expected error for unterminated address")
+	}
+}
+
+func TestOSCMapping(t *testing.T) {
+	cutoff := uint8(74)
+	mappings := []octane.OSCMapping{
+		{Type: octane.ControlNote, Address: "/note/{channel}/{number}"},
+		{Type: octane.ControlCC, Channel: 2, Number: &cutoff, Address: "/cutoff", Min: 20, Max: 20000},
+		{Type: octane.OSCBend, Address: "/bend/{channel}", Min: -1, Max: 1},
+	}
+
+	cases := []struct {
+		mapping octane.OSCMapping
+		msg     midi.Message
+		address string
+		arg     float32
+	}{
+		{mappings[0], midi.NoteOn(0, 60, 127), "/note/1/60", 1},
+		{mappings[0], midi.NoteOff(3, 62), "/note/4/62", 0},
+		{mappings[1], midi.ControlChange(1, 74, 0), "/cutoff", 20},
+		{mappings[2], midi.Pitchbend(0, 8191), "/bend/1", 1},
+	}
+
+	for _, c := range cases {
+		osc, ok := c.mapping.ToOSC(c.msg)
+
+		if !ok || osc.Address != c.address || len(osc.Args) != 1 || osc.Args[0] != c.arg {
+			t.Errorf("expected %v %v for %v, got %v", c.address, c.arg, c.msg, osc)
+			continue
+		}
+
+		msg, ok := c.mapping.FromOSC(osc)
+
+		if !ok || msg.String() != c.msg.String() {
+			t.Errorf("expected %v for %v, got %v", c.msg, osc, msg)
+		}
+	}
+
+	if _, ok := mappings[1].ToOSC(midi.ControlChange(0, 74, 0)); ok {
+		t.Errorf("expected channel mismatch")
+	}
+
+	if _, ok := mappings[0].FromOSC(octane.OSCMessage{Address: "/note/17/60", Args: []any{float32(1)}}); ok {
+		t.Errorf("expected out of range channel to not match")
+	}
+}
+
+func TestOSCPort(t *testing.T) {
+	probe, err := net.ListenPacket("udp", "127.0.0.1:0")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	address := probe.LocalAddr().String()
+
+	if err2 := probe.Close(); err2 != nil {
+		t.Fatal(err2)
+	}
+
+	mappings := []octane.OSCMapping{{Type: octane.ControlNote, Address: "/note/{channel}/{number}"}}
+	config := octane.Config{
+		OSC: []octane.OSCEndpoint{
+			{Name: "receiver", Listen: address, Map: mappings},
+			{Name: "sender", Send: address, Map: mappings},
+		},
+	}
+
+	if err2 := config.Validate(); err2 != nil {
+		t.Fatal(err2)
+	}
+
+	ins, outs := config.OSCPorts()
+
+	if len(ins) != 1 || len(outs) != 1 {
+		t.Fatalf("expected one OSC IN and one OSC OUT, got %v and %v", ins, outs)
+	}
+
+	received := make(chan midi.Message, 1)
+
+	stop, err := midi.ListenTo(ins[0], func(msg midi.Message, _ int32) {
+		received <- msg
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer ins[0].Close()
+	defer stop()
+
+	if err2 := outs[0].Open(); err2 != nil {
+		t.Fatal(err2)
+	}
+
+	defer outs[0].Close()
+
+	if err2 := outs[0].Send(midi.NoteOn(2, 64, 127)); err2 != nil {
+		t.Fatal(err2)
+	}
+
+	select {
+	case msg := <-received:
+		if msg.String() != midi.NoteOn(2, 64, 127).String() {
+			t.Errorf("expected %v, got %v", midi.NoteOn(2, 64, 127), msg)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("expected OSC message")
+	}
+}
@@ -0,0 +1,199 @@
+package octane
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"gitlab.com/gomidi/midi/v2"
+)
+
+// ParseBendRange reads a "<in semitones>:<out semitones>" pitch bend range conversion.
+func ParseBendRange(s string) (BendRange, error) {
+	before, after, found := strings.Cut(s, ":")
+
+	if !found {
+		return BendRange{}, fmt.Errorf("invalid pitch bend range: %v", s)
+	}
+
+	inRange, err := strconv.ParseUint(before, 10, 8)
+
+	if err != nil {
+		return BendRange{}, fmt.Errorf("invalid pitch bend range: %v", s)
+	}
+
+	outRange, err := strconv.ParseUint(after, 10, 8)
+
+	if err != nil {
+		return BendRange{}, fmt.Errorf("invalid pitch bend range: %v", s)
+	}
+
+	bendRange := BendRange{InRange: uint8(inRange), OutRange: uint8(outRange)}
+	return bendRange, bendRange.Validate()
+}
+
+// BendRange rescales pitch bend between devices with different bend ranges.
+type BendRange struct {
+	// Channel selects the source channel (1-16).
+	// Zero matches any channel.
+	Channel uint8 `json:"channel,omitempty"`
+
+	// InRange denotes the sending device's bend range, in semitones.
+	InRange uint8 `json:"inRange"`
+
+	// OutRange denotes the receiving device's bend range, in semitones.
+	OutRange uint8 `json:"outRange"`
+}
+
+// Validate checks the conversion for out of range fields.
+func (o BendRange) Validate() error {
+	if o.Channel > 16 {
+		return fmt.Errorf("pitch bend range has invalid MIDI channel: %v", o.Channel)
+	}
+
+	if o.InRange == 0 || o.OutRange == 0 {
+		return fmt.Errorf("pitch bend range requires nonzero semitones: %v:%v", o.InRange, o.OutRange)
+	}
+
+	return nil
+}
+
+// Bend rescales a relative pitch bend value, clamping at the output limits.
+func (o BendRange) Bend(value int16) int16 {
+	return clampBend(int(value) * int(o.InRange) / int(o.OutRange))
+}
+
+// Transform rescales matching pitch bends.
+func (o BendRange) Transform(msg midi.Message, emit func(midi.Message)) {
+	var channel uint8
+	var value int16
+
+	if !msg.GetPitchBend(&channel, &value, nil) || !matchesChannel(o.Channel, channel) {
+		emit(msg)
+		return
+	}
+
+	emit(midi.Pitchbend(channel, o.Bend(value)))
+}
+
+// BendToCC converts pitch bend into a control change, or an MSB/LSB pair of control changes.
+type BendToCC struct {
+	// Channel selects the source channel (1-16).
+	// Zero matches any channel.
+	Channel uint8 `json:"channel,omitempty"`
+
+	// MSB selects the controller receiving the coarse value.
+	MSB uint8 `json:"msb"`
+
+	// LSB optionally selects a controller receiving the fine value.
+	LSB *uint8 `json:"lsb,omitempty"`
+}
+
+// Validate checks the conversion for out of range fields.
+func (o BendToCC) Validate() error {
+	if o.Channel > 16 {
+		return fmt.Errorf("pitch bend to CC has invalid MIDI channel: %v", o.Channel)
+	}
+
+	if o.MSB > 127 || (o.LSB != nil && *o.LSB > 127) {
+		return fmt.Errorf("pitch bend to CC has invalid MIDI controller")
+	}
+
+	return nil
+}
+
+// Transform replaces matching pitch bends with control changes.
+func (o BendToCC) Transform(msg midi.Message, emit func(midi.Message)) {
+	var channel uint8
+	var value uint16
+
+	if !msg.GetPitchBend(&channel, nil, &value) || !matchesChannel(o.Channel, channel) {
+		emit(msg)
+		return
+	}
+
+	emit(midi.ControlChange(channel, o.MSB, uint8(value>>7)))
+
+	if o.LSB != nil {
+		emit(midi.ControlChange(channel, *o.LSB, uint8(value&0x7F)))
+	}
+}
+
+// CCToBend converts a control change, or an MSB/LSB pair of control changes, into pitch bend.
+type CCToBend struct {
+	// Channel selects the source channel (1-16).
+	// Zero matches any channel.
+	Channel uint8 `json:"channel,omitempty"`
+
+	// MSB selects the controller carrying the coarse value.
+	MSB uint8 `json:"msb"`
+
+	// LSB optionally selects a controller carrying the fine value.
+	LSB *uint8 `json:"lsb,omitempty"`
+}
+
+// Validate checks the conversion for out of range fields.
+func (o CCToBend) Validate() error {
+	if o.Channel > 16 {
+		return fmt.Errorf("CC to pitch bend has invalid MIDI channel: %v", o.Channel)
+	}
+
+	if o.MSB > 127 || (o.LSB != nil && *o.LSB > 127) {
+		return fmt.Errorf("CC to pitch bend has invalid MIDI controller")
+	}
+
+	return nil
+}
+
+// Transformer prepares a stateful conversion.
+func (o CCToBend) Transformer() Transformer {
+	return &ccToBend{CCToBend: o}
+}
+
+// ccToBend tracks coarse values per channel.
+type ccToBend struct {
+	CCToBend
+
+	mutex sync.Mutex
+
+	msbs [16]uint8
+}
+
+// Transform replaces matching control changes with pitch bends.
+//
+// Per the MIDI specification, an MSB update resets the fine value.
+func (o *ccToBend) Transform(msg midi.Message, emit func(midi.Message)) {
+	var channel uint8
+	var controller uint8
+	var value uint8
+
+	if !msg.GetControlChange(&channel, &controller, &value) || !matchesChannel(o.Channel, channel) {
+		emit(msg)
+		return
+	}
+
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	switch {
+	case controller == o.MSB:
+		o.msbs[channel] = value
+		emit(midi.Pitchbend(channel, int16(int(value)<<7-8192)))
+	case o.LSB != nil && controller == *o.LSB:
+		emit(midi.Pitchbend(channel, int16((int(o.msbs[channel])<<7|int(value))-8192)))
+	default:
+		emit(msg)
+	}
+}
+
+// matchesChannel reports whether a zero-based channel satisfies a one-based selector,
+// where zero selects any channel.
+func matchesChannel(selector uint8, channel uint8) bool {
+	return selector == 0 || selector == channel+1
+}
+
+// clampBend limits a relative pitch bend value to the valid range.
+func clampBend(value int) int16 {
+	return int16(min(max(value, midi.PitchLowest), midi.PitchHighest))
+}
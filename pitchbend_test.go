@@ -0,0 +1,48 @@
+package octane_test
+
+import (
+	"testing"
+
+	"github.com/mcandre/octane"
+	"gitlab.com/gomidi/midi/v2"
+)
+
+func TestBendRange(t *testing.T) {
+	bendRange := octane.BendRange{InRange: 2, OutRange: 12}
+
+	if v := bendRange.Bend(6000); v != 1000 {
+		t.Errorf("expected 1000, got %v", v)
+	}
+
+	narrowing := octane.BendRange{InRange: 12, OutRange: 2}
+
+	if v := narrowing.Bend(-4096); v != midi.PitchLowest {
+		t.Errorf("expected clamping to %v, got %v", midi.PitchLowest, v)
+	}
+
+	if _, err := octane.ParseBendRange("2:0"); err == nil {
+		t.Errorf("expected error for zero range")
+	}
+}
+
+func TestBendToCCRoundTrip(t *testing.T) {
+	lsb := uint8(33)
+	bendToCC := octane.BendToCC{MSB: 1, LSB: &lsb}
+	ccToBend := octane.CCToBend{MSB: 1, LSB: &lsb}.Transformer()
+	var got []midi.Message
+
+	bendToCC.Transform(midi.Pitchbend(4, 1234), func(msg midi.Message) {
+		ccToBend.Transform(msg, func(m midi.Message) { got = append(got, m) })
+	})
+
+	if len(got) != 2 {
+		t.Fatalf("expected 2 messages, got %v", len(got))
+	}
+
+	var channel uint8
+	var value int16
+
+	if !got[1].GetPitchBend(&channel, &value, nil) || channel != 4 || value != 1234 {
+		t.Errorf("expected pitch bend channel 4 value 1234, got %v", got[1])
+	}
+}
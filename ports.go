@@ -0,0 +1,54 @@
+package octane
+
+import (
+	"slices"
+
+	"gitlab.com/gomidi/midi/v2/drivers"
+)
+
+// PortDriver denotes a MIDI device provided by the system MIDI driver.
+const PortDriver = "driver"
+
+// PortOSC denotes an OSC pseudo-port.
+const PortOSC = "osc"
+
+// PortRTPMIDI denotes an RTP-MIDI pseudo-port.
+const PortRTPMIDI = "rtpmidi"
+
+// PortSocket denotes a socket pseudo-port.
+const PortSocket = "socket"
+
+// PortSerial denotes a serial pseudo-port.
+const PortSerial = "serial"
+
+// PortStdio denotes the stdio pseudo-port.
+const PortStdio = "stdio"
+
+// PortKind reports the kind of a MIDI device.
+// Port numbers are unique per direction only within a kind.
+func PortKind(port drivers.Port) string {
+	switch port.(type) {
+	case *OSCPort:
+		return PortOSC
+	case *RTPMIDIPort:
+		return PortRTPMIDI
+	case *SocketPort:
+		return PortSocket
+	case *SerialPort:
+		return PortSerial
+	case *StdioPort:
+		return PortStdio
+	default:
+		return PortDriver
+	}
+}
+
+// PseudoPorts prepares the configured network pseudo-ports,
+// for selection alongside MIDI devices.
+func (o Config) PseudoPorts() ([]drivers.In, []drivers.Out) {
+	oscIns, oscOuts := o.OSCPorts()
+	rtpMIDIIns, rtpMIDIOuts := o.RTPMIDIPorts()
+	socketIns, socketOuts := o.SocketPorts()
+	serialIns, serialOuts := o.SerialPorts()
+	return slices.Concat(oscIns, rtpMIDIIns, socketIns, serialIns), slices.Concat(oscOuts, rtpMIDIOuts, socketOuts, serialOuts)
+}
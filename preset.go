@@ -0,0 +1,46 @@
+package octane
+
+import (
+	"fmt"
+	"slices"
+)
+
+// Preset names an alternative routing and transformation graph.
+type Preset struct {
+	// Name identifies the preset.
+	Name string `json:"name"`
+
+	// Config denotes the preset's routing and transformations,
+	// replacing the top level routing and transformations while active.
+	Config
+}
+
+// Validate checks the preset for errors.
+// Presets cannot nest presets, nor carry script, helper, listening, control, or pseudo-port settings.
+func (o Preset) Validate() error {
+	if o.Name == "" {
+		return fmt.Errorf("preset requires a name")
+	}
+
+	if len(o.Presets) != 0 || o.Preset != "" || o.Script != "" || o.Helper != nil || o.SysEx != nil || o.Control != nil || len(o.OSC) != 0 || len(o.RTPMIDI) != 0 || len(o.Sockets) != 0 || len(o.Serial) != 0 {
+		return fmt.Errorf("preset %v may only configure routing and transformations", o.Name)
+	}
+
+	return o.Config.Validate()
+}
+
+// RoutesTo reports whether the configuration routes messages to the named MIDI OUT device.
+func (o Config) RoutesTo(out string) bool {
+	return len(o.Out) == 0 || slices.Contains(o.Out, out)
+}
+
+// FindPreset looks up a preset by name.
+func (o Config) FindPreset(name string) (Preset, error) {
+	for _, preset := range o.Presets {
+		if preset.Name == name {
+			return preset, nil
+		}
+	}
+
+	return Preset{}, fmt.Errorf("unknown preset: %v", name)
+}
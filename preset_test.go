@@ -0,0 +1,147 @@
+package octane_test
+
+import (
+	"testing"
+
+	"github.com/mcandre/octane"
+	"gitlab.com/gomidi/midi/v2"
+	"gitlab.com/gomidi/midi/v2/drivers"
+)
+
+func TestConfigValidatePresets(t *testing.T) {
+	valid := octane.Config{
+		Presets: []octane.Preset{{Name: "verse"}, {Name: "chorus"}},
+		Preset:  "verse",
+		Control: &octane.Control{Map: []octane.ControlMapping{{Type: octane.ControlCC, Number: 80, Action: octane.ActionPreset, Preset: "chorus"}}},
+	}
+
+	if err := valid.Validate(); err != nil {
+		t.Error(err)
+	}
+
+	invalids := []octane.Config{
+		{Presets: []octane.Preset{{Name: "verse"}, {Name: "verse"}}},
+		{Presets: []octane.Preset{{}}},
+		{Presets: []octane.Preset{{Name: "verse"}}, Preset: "bridge"},
+		{Presets: []octane.Preset{{Name: "verse", Config: octane.Config{Preset: "verse"}}}},
+		{Control: &octane.Control{Map: []octane.ControlMapping{{Type: octane.ControlCC, Number: 80, Action: octane.ActionPreset, Preset: "bridge"}}}},
+	}
+
+	for _, config := range invalids {
+		if err := config.Validate(); err == nil {
+			t.Errorf("expected error for %v", config)
+		}
+	}
+}
+
+func TestEnginePresets(t *testing.T) {
+	bass := &fakeOut{name: "bass"}
+	lead := &fakeOut{name: "lead"}
+	config := octane.Config{
+		Presets: []octane.Preset{
+			{Name: "split", Config: octane.Config{Out: []string{"bass"}, TransposeNote: -12}},
+			{Name: "lead", Config: octane.Config{Out: []string{"lead"}}},
+		},
+		Preset: "split",
+		Control: &octane.Control{
+			Map:            []octane.ControlMapping{{Type: octane.ControlCC, Number: 80, Action: octane.ActionNextPreset}},
+			ProgramPresets: true,
+		},
+	}
+
+	engine, err := octane.NewEngine(config, []drivers.Out{bass, lead})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	engine.Process(midi.NoteOn(0, 60, 100), true, true)
+	engine.Process(midi.ControlChange(0, 80, 127), true, true)
+	engine.Process(midi.NoteOff(0, 60), true, true)
+	engine.Process(midi.NoteOn(0, 62, 100), true, true)
+
+	if engine.Preset() != "lead" {
+		t.Errorf("expected preset lead, got %v", engine.Preset())
+	}
+
+	expectedBass := []midi.Message{midi.NoteOn(0, 48, 100), midi.NoteOff(0, 48)}
+	expectedLead := []midi.Message{midi.NoteOn(0, 62, 100)}
+
+	for _, c := range []struct {
+		out      *fakeOut
+		expected []midi.Message
+	}{{bass, expectedBass}, {lead, expectedLead}} {
+		if len(c.out.sent) != len(c.expected) {
+			t.Fatalf("expected %v, got %v", c.expected, c.out.sent)
+		}
+
+		for i, msg := range c.expected {
+			if c.out.sent[i].String() != msg.String() {
+				t.Errorf("expected %v, got %v", msg, c.out.sent[i])
+			}
+		}
+	}
+
+	engine.Process(midi.ProgramChange(0, 0), true, true)
+
+	if engine.Preset() != "split" {
+		t.Errorf("expected preset split, got %v", engine.Preset())
+	}
+
+	if err2 := engine.Command("preset lead"); err2 != nil {
+		t.Error(err2)
+	}
+
+	if engine.Preset() != "lead" {
+		t.Errorf("expected preset lead, got %v", engine.Preset())
+	}
+
+	if err2 := engine.Command("preset missing"); err2 == nil {
+		t.Errorf("expected error for unknown preset")
+	}
+}
+
+func TestEnginePresetsDropReleasedNote(t *testing.T) {
+	out := &fakeOut{name: "synth"}
+	config := octane.Config{
+		Presets: []octane.Preset{
+			{Name: "a"},
+			{Name: "b", Config: octane.Config{Filters: []octane.Filter{{Match: "channel == 10", Action: octane.FilterDrop}}}},
+		},
+		Preset: "a",
+	}
+
+	engine, err := octane.NewEngine(config, []drivers.Out{out})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The switch releases the held note, and preset b drops its note off.
+	engine.Process(midi.NoteOn(9, 36, 100), false, true)
+
+	if err2 := engine.Command("preset b"); err2 != nil {
+		t.Fatal(err2)
+	}
+
+	engine.Process(midi.NoteOff(9, 36), false, true)
+
+	if err2 := engine.Command("preset a"); err2 != nil {
+		t.Fatal(err2)
+	}
+
+	// The key plays normally afterward.
+	engine.Process(midi.NoteOn(9, 36, 100), false, true)
+	engine.Process(midi.NoteOff(9, 36), false, true)
+
+	expected := []midi.Message{
+		midi.NoteOn(9, 36, 100),
+		midi.NoteOff(9, 36),
+		midi.NoteOn(9, 36, 100),
+		midi.NoteOff(9, 36),
+	}
+
+	if !equalMessages(out.sent, expected) {
+		t.Errorf("expected %v, got %v", expected, out.sent)
+	}
+}
@@ -0,0 +1,138 @@
+package octane
+
+import (
+	"fmt"
+	"strings"
+
+	"gitlab.com/gomidi/midi/v2"
+)
+
+// ParseProgramMapping reads a "[<channel>/]<program>:[<channel>/]<program>" mapping.
+func ParseProgramMapping(s string) (ProgramMapping, error) {
+	before, after, found := strings.Cut(s, ":")
+
+	if !found {
+		return ProgramMapping{}, fmt.Errorf("invalid program mapping: %v", s)
+	}
+
+	inChannel, inProgram, err := ParseChannelController(before)
+
+	if err != nil {
+		return ProgramMapping{}, fmt.Errorf("invalid program mapping: %v", s)
+	}
+
+	outChannel, outProgram, err := ParseChannelController(after)
+
+	if err != nil {
+		return ProgramMapping{}, fmt.Errorf("invalid program mapping: %v", s)
+	}
+
+	return ProgramMapping{
+		InChannel:  inChannel,
+		InProgram:  inProgram,
+		OutChannel: outChannel,
+		OutProgram: outProgram,
+	}, nil
+}
+
+// ProgramMapping translates a program change, optionally preceded by bank select.
+type ProgramMapping struct {
+	// Out selects a MIDI OUT device by name.
+	// Blank matches all outputs.
+	Out string `json:"out,omitempty"`
+
+	// InChannel selects the source channel (1-16).
+	// Zero matches any channel.
+	InChannel uint8 `json:"inChannel,omitempty"`
+
+	// InProgram selects the source program (0-127).
+	InProgram uint8 `json:"inProgram"`
+
+	// OutChannel selects the target channel (1-16).
+	// Zero preserves the source channel.
+	OutChannel uint8 `json:"outChannel,omitempty"`
+
+	// OutProgram selects the target program (0-127).
+	OutProgram uint8 `json:"outProgram"`
+
+	// BankMSB optionally injects a Bank Select MSB (CC 0) before the program change.
+	BankMSB *uint8 `json:"bankMSB,omitempty"`
+
+	// BankLSB optionally injects a Bank Select LSB (CC 32) before the program change.
+	BankLSB *uint8 `json:"bankLSB,omitempty"`
+}
+
+// Validate checks the mapping for out of range fields.
+func (o ProgramMapping) Validate() error {
+	if o.InChannel > 16 || o.OutChannel > 16 {
+		return fmt.Errorf("program mapping %v:%v has invalid MIDI channel", o.InProgram, o.OutProgram)
+	}
+
+	if o.InProgram > 127 || o.OutProgram > 127 {
+		return fmt.Errorf("program mapping %v:%v has invalid program", o.InProgram, o.OutProgram)
+	}
+
+	if (o.BankMSB != nil && *o.BankMSB > 127) || (o.BankLSB != nil && *o.BankLSB > 127) {
+		return fmt.Errorf("program mapping %v:%v has invalid bank", o.InProgram, o.OutProgram)
+	}
+
+	return nil
+}
+
+// MatchesOut reports whether the mapping applies to an output device name.
+func (o ProgramMapping) MatchesOut(name string) bool {
+	return o.Out == "" || o.Out == name
+}
+
+// ProgramMap translates program changes.
+// Program changes without a matching mapping pass through unchanged.
+type ProgramMap []ProgramMapping
+
+// ForOut selects the mappings that apply to an output device name.
+func (o ProgramMap) ForOut(name string) ProgramMap {
+	var selected ProgramMap
+
+	for _, mapping := range o {
+		if mapping.MatchesOut(name) {
+			selected = append(selected, mapping)
+		}
+	}
+
+	return selected
+}
+
+// Transform applies the first matching mapping.
+func (o ProgramMap) Transform(msg midi.Message, emit func(midi.Message)) {
+	var channel uint8
+	var program uint8
+
+	if !msg.GetProgramChange(&channel, &program) {
+		emit(msg)
+		return
+	}
+
+	for _, mapping := range o {
+		if mapping.InProgram != program || !matchesChannel(mapping.InChannel, channel) {
+			continue
+		}
+
+		outChannel := channel
+
+		if mapping.OutChannel != 0 {
+			outChannel = mapping.OutChannel - 1
+		}
+
+		if mapping.BankMSB != nil {
+			emit(midi.ControlChange(outChannel, midi.BankSelectMSB, *mapping.BankMSB))
+		}
+
+		if mapping.BankLSB != nil {
+			emit(midi.ControlChange(outChannel, midi.BankSelectLSB, *mapping.BankLSB))
+		}
+
+		emit(midi.ProgramChange(outChannel, mapping.OutProgram))
+		return
+	}
+
+	emit(msg)
+}
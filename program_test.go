@@ -0,0 +1,41 @@
+package octane_test
+
+import (
+	"testing"
+
+	"github.com/mcandre/octane"
+	"gitlab.com/gomidi/midi/v2"
+)
+
+func TestProgramMapBankSelect(t *testing.T) {
+	bankMSB := uint8(1)
+	programMap := octane.ProgramMap{{InProgram: 3, OutChannel: 2, OutProgram: 40, BankMSB: &bankMSB}}
+	var got []midi.Message
+	emit := func(msg midi.Message) { got = append(got, msg) }
+
+	programMap.Transform(midi.ProgramChange(0, 3), emit)
+
+	if len(got) != 2 || got[0].String() != midi.ControlChange(1, 0, 1).String() || got[1].String() != midi.ProgramChange(1, 40).String() {
+		t.Errorf("expected bank select then program change, got %v", got)
+	}
+
+	got = nil
+	programMap.Transform(midi.ProgramChange(0, 4), emit)
+
+	if len(got) != 1 || got[0].String() != midi.ProgramChange(0, 4).String() {
+		t.Errorf("expected pass through program change, got %v", got)
+	}
+}
+
+func TestProgramMapForOut(t *testing.T) {
+	programMap := octane.ProgramMap{
+		{Out: "synth A", InProgram: 0, OutProgram: 10},
+		{Out: "synth B", InProgram: 0, OutProgram: 20},
+	}
+
+	selected := programMap.ForOut("synth B")
+
+	if len(selected) != 1 || selected[0].OutProgram != 20 {
+		t.Errorf("expected synth B mapping, got %v", selected)
+	}
+}
@@ -0,0 +1,225 @@
+package octane
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"gitlab.com/gomidi/midi/v2"
+)
+
+// ClockPPQN denotes the timing clock messages per quarter note.
+const ClockPPQN = 24
+
+// RatchetNote repeats notes with the velocity of the original note.
+const RatchetNote = "note"
+
+// RatchetAftertouch repeats notes with the latest aftertouch pressure.
+const RatchetAftertouch = "aftertouch"
+
+// ParseRatchet reads a "<rates>[:<controller>]" ratchet,
+// with comma-separated note divisions like "1/8,1/16,1/32".
+func ParseRatchet(s string) (Ratchet, error) {
+	rates, controller, found := strings.Cut(s, ":")
+	ratchet := Ratchet{Rates: strings.Split(rates, ",")}
+
+	if found {
+		cc, err := strconv.ParseUint(controller, 10, 8)
+
+		if err != nil {
+			return Ratchet{}, fmt.Errorf("invalid MIDI controller: %v", controller)
+		}
+
+		c := uint8(cc)
+		ratchet.CC = &c
+	}
+
+	return ratchet, ratchet.Validate()
+}
+
+// Ratchet repeats held notes at a rate synced to incoming timing clock,
+// for drum rolls and note repeat.
+type Ratchet struct {
+	// Match denotes a filter expression selecting the notes to repeat, like "channel == 10".
+	// Blank selects all notes.
+	Match string `json:"match,omitempty"`
+
+	// Rates collects note divisions like "1/16", "1/8d", or "1/16t".
+	// The first rate applies until a rate control change arrives.
+	Rates []string `json:"rates"`
+
+	// CC optionally selects a controller choosing among Rates, from low to high values.
+	// Rate control changes passing filters are consumed.
+	CC *uint8 `json:"cc,omitempty"`
+
+	// Channel selects the rate control change channel (1-16).
+	// Zero matches any channel.
+	Channel uint8 `json:"channel,omitempty"`
+
+	// Velocity denotes RatchetNote (default) or RatchetAftertouch.
+	Velocity string `json:"velocity,omitempty"`
+}
+
+// Validate checks the ratchet for errors.
+func (o Ratchet) Validate() error {
+	if o.Match != "" {
+		if _, err := ParseExpression(o.Match); err != nil {
+			return err
+		}
+	}
+
+	if _, err := o.ticks(); err != nil {
+		return err
+	}
+
+	if o.CC != nil && *o.CC > 127 {
+		return fmt.Errorf("ratchet has invalid MIDI controller: %v", *o.CC)
+	}
+
+	if o.Channel > 16 {
+		return fmt.Errorf("ratchet has invalid MIDI channel: %v", o.Channel)
+	}
+
+	if o.Velocity != "" && o.Velocity != RatchetNote && o.Velocity != RatchetAftertouch {
+		return fmt.Errorf("unsupported ratchet velocity: %v", o.Velocity)
+	}
+
+	return nil
+}
+
+// ticks converts the rates to timing clock intervals.
+func (o Ratchet) ticks() ([]int, error) {
+	if len(o.Rates) == 0 {
+		return nil, fmt.Errorf("ratchet requires a rate")
+	}
+
+	var ticks []int
+
+	for _, rate := range o.Rates {
+		beats, err := ParseDivision(rate)
+
+		if err != nil {
+			return nil, err
+		}
+
+		interval := int(math.Round(beats * ClockPPQN))
+
+		if interval < 1 {
+			return nil, fmt.Errorf("ratchet rate exceeds the timing clock: %v", rate)
+		}
+
+		ticks = append(ticks, interval)
+	}
+
+	return ticks, nil
+}
+
+// ratchetNote tracks a held note repeating.
+type ratchetNote struct {
+	velocity uint8
+
+	out string
+}
+
+// ratchetStage tracks the rate and held notes of a ratchet.
+type ratchetStage struct {
+	Ratchet
+
+	expression *Expression
+
+	intervals []int
+
+	rate int
+
+	// clock counts timing clock messages since the latest start message.
+	clock int
+
+	held map[noteID]*ratchetNote
+}
+
+// newRatchetStage compiles a ratchet.
+func newRatchetStage(ratchet Ratchet) (*ratchetStage, error) {
+	intervals, err := ratchet.ticks()
+
+	if err != nil {
+		return nil, err
+	}
+
+	o := &ratchetStage{Ratchet: ratchet, intervals: intervals, held: map[noteID]*ratchetNote{}}
+
+	if ratchet.Match != "" {
+		expression, err2 := ParseExpression(ratchet.Match)
+
+		if err2 != nil {
+			return nil, err2
+		}
+
+		o.expression = &expression
+	}
+
+	return o, nil
+}
+
+// control applies rate control changes, reporting whether msg was consumed.
+func (o *ratchetStage) control(msg midi.Message) bool {
+	var channel uint8
+	var controller uint8
+	var value uint8
+
+	if o.CC == nil || !msg.GetControlChange(&channel, &controller, &value) || controller != *o.CC || (o.Channel != 0 && channel != o.Channel-1) {
+		return false
+	}
+
+	o.rate = int(value) * len(o.intervals) / 128
+	return true
+}
+
+// track follows note and aftertouch messages routed to the named MIDI OUT device,
+// or blank for the active routing.
+func (o *ratchetStage) track(msg midi.Message, out string) {
+	var channel uint8
+	var key uint8
+	var velocity uint8
+	var pressure uint8
+
+	switch {
+	case msg.GetNoteStart(&channel, &key, &velocity):
+		if o.expression == nil || o.expression.Match(msg) {
+			o.held[noteID{channel, key}] = &ratchetNote{velocity: velocity, out: out}
+		}
+	case msg.GetNoteEnd(&channel, &key):
+		delete(o.held, noteID{channel, key})
+	case o.Velocity == RatchetAftertouch && msg.GetAfterTouch(&channel, &pressure):
+		for id, note := range o.held {
+			if id.channel == channel {
+				note.velocity = pressure
+			}
+		}
+	case o.Velocity == RatchetAftertouch && msg.GetPolyAfterTouch(&channel, &key, &pressure):
+		if note, ok := o.held[noteID{channel, key}]; ok {
+			note.velocity = pressure
+		}
+	}
+}
+
+// tick retriggers the held notes at timing clock messages on the rate grid,
+// counted from the latest start message.
+// Notes at zero aftertouch pressure skip their repeats.
+func (o *Engine) tick() {
+	due := o.ratchet.clock%o.ratchet.intervals[o.ratchet.rate] == 0
+	o.ratchet.clock++
+
+	if !due {
+		return
+	}
+
+	for id, note := range o.ratchet.held {
+		if note.velocity == 0 {
+			continue
+		}
+
+		o.send(midi.NoteOff(id.channel, id.key), note.out)
+		o.send(midi.NoteOn(id.channel, id.key, note.velocity), note.out)
+	}
+}
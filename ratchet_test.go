@@ -0,0 +1,141 @@
+package octane_test
+
+import (
+	"testing"
+
+	"github.com/mcandre/octane"
+	"gitlab.com/gomidi/midi/v2"
+	"gitlab.com/gomidi/midi/v2/drivers"
+)
+
+func TestParseRatchet(t *testing.T) {
+	ratchet, err := octane.ParseRatchet("1/8,1/16,1/32t:20")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(ratchet.Rates) != 3 || ratchet.CC == nil || *ratchet.CC != 20 {
+		t.Errorf("expected three rates selected by CC 20, got %v", ratchet)
+	}
+
+	for _, s := range []string{"", "1/8:", "1/8:128", "1/8,fast", "1/256"} {
+		if _, err2 := octane.ParseRatchet(s); err2 == nil {
+			t.Errorf("expected error for %q", s)
+		}
+	}
+
+	for _, ratchet := range []octane.Ratchet{
+		{Rates: []string{"1/16"}, Match: "key >"},
+		{Rates: []string{"1/16"}, Channel: 17},
+		{Rates: []string{"1/16"}, Velocity: "random"},
+	} {
+		if err2 := ratchet.Validate(); err2 == nil {
+			t.Errorf("expected error for %v", ratchet)
+		}
+	}
+}
+
+func TestEngineRatchet(t *testing.T) {
+	out := &fakeOut{name: "synth"}
+	cc := uint8(20)
+	ratchet := octane.Ratchet{Match: "channel == 10", Rates: []string{"1/16", "1/32"}, CC: &cc, Velocity: octane.RatchetAftertouch}
+	engine, err := octane.NewEngine(octane.Config{Ratchet: &ratchet}, []drivers.Out{out})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clock := func(ticks int) {
+		for i := 0; i < ticks; i++ {
+			engine.Process(midi.TimingClock(), false, true)
+		}
+	}
+
+	engine.Process(midi.NoteOn(9, 36, 100), false, true)
+	engine.Process(midi.NoteOn(0, 60, 100), false, true)
+	clock(6)
+	engine.Process(midi.ControlChange(9, 20, 127), false, true)
+	engine.Process(midi.AfterTouch(9, 40), false, true)
+	clock(3)
+	engine.Process(midi.NoteOff(9, 36), false, true)
+	clock(6)
+
+	// Sixteenths last six clocks, and thirty-seconds three.
+	expected := []midi.Message{
+		midi.NoteOn(9, 36, 100),
+		midi.NoteOn(0, 60, 100),
+		midi.NoteOff(9, 36),
+		midi.NoteOn(9, 36, 100),
+		midi.AfterTouch(9, 40),
+		midi.NoteOff(9, 36),
+		midi.NoteOn(9, 36, 40),
+		midi.NoteOff(9, 36),
+	}
+
+	if !equalMessages(out.sent, expected) {
+		t.Errorf("expected %v, got %v", expected, out.sent)
+	}
+
+	// Bypass suspends ratchets, passing rate control changes.
+	// Enabling bypass releases the sounding note.
+	engine.SetBypass(true)
+	engine.Process(midi.NoteOn(9, 38, 100), false, true)
+	engine.Process(midi.ControlChange(9, 20, 0), false, true)
+	clock(6)
+
+	if sent := engine.Status().Routes[0].Sent; sent != uint64(len(expected)+3) {
+		t.Errorf("expected bypassed notes to play once, got %v", out.sent[len(expected):])
+	}
+}
+
+func TestEngineRatchetGrid(t *testing.T) {
+	out := &fakeOut{name: "synth"}
+	cc := uint8(20)
+	ratchet := octane.Ratchet{Rates: []string{"1/16", "1/32"}, CC: &cc}
+	filters := []octane.Filter{{Match: "type == cc && controller == 20 && channel == 2", Action: octane.FilterDrop}}
+	engine, err := octane.NewEngine(octane.Config{Ratchet: &ratchet, Filters: filters}, []drivers.Out{out})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clock := func(ticks int) {
+		for i := 0; i < ticks; i++ {
+			engine.Process(midi.TimingClock(), false, true)
+		}
+	}
+
+	// Filters drop the rate control change before the ratchet sees it.
+	engine.Process(midi.ControlChange(1, 20, 127), false, true)
+
+	// Repeats fall on the sixteenth grid counted from start, not from the note on.
+	engine.Process(midi.Start(), false, true)
+	clock(2)
+	engine.Process(midi.NoteOn(0, 36, 100), false, true)
+	clock(4)
+
+	if !equalMessages(out.sent, []midi.Message{midi.NoteOn(0, 36, 100)}) {
+		t.Errorf("expected no repeat before the grid, got %v", out.sent)
+	}
+
+	clock(1)
+
+	expected := []midi.Message{
+		midi.NoteOn(0, 36, 100),
+		midi.NoteOff(0, 36),
+		midi.NoteOn(0, 36, 100),
+	}
+
+	if !equalMessages(out.sent, expected) {
+		t.Errorf("expected %v, got %v", expected, out.sent)
+	}
+
+	// Passed rate control changes are consumed.
+	engine.Process(midi.ControlChange(0, 20, 127), false, true)
+	clock(3)
+
+	if sent := engine.Status().Routes[0].Sent; sent != uint64(len(expected)+2) {
+		t.Errorf("expected a thirty-second repeat, got %v", out.sent[len(expected):])
+	}
+}
@@ -0,0 +1,95 @@
+package octane
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"time"
+)
+
+// DefaultWatchInterval denotes the default pause between configuration file checks.
+const DefaultWatchInterval = time.Second
+
+// WatchConfig polls a configuration file for modifications,
+// calling onChange whenever the file's modification time or size changes.
+//
+// Returns a function to stop watching.
+func WatchConfig(pth string, interval time.Duration, onChange func()) func() {
+	done := make(chan struct{})
+	ticker := time.NewTicker(interval)
+
+	var modTime time.Time
+	var size int64
+
+	if info, err := os.Stat(pth); err == nil {
+		modTime = info.ModTime()
+		size = info.Size()
+	}
+
+	go func() {
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				info, err := os.Stat(pth)
+
+				if err != nil || (info.ModTime().Equal(modTime) && info.Size() == size) {
+					continue
+				}
+
+				modTime = info.ModTime()
+				size = info.Size()
+				onChange()
+			}
+		}
+	}()
+
+	return func() { close(done) }
+}
+
+// CheckReload reports settings that differ from next in ways requiring a restart,
+// as reloading keeps MIDI devices and pseudo-ports connected.
+func (o Config) CheckReload(next Config) error {
+	var controlIn, nextControlIn string
+
+	if o.Control != nil {
+		controlIn = o.Control.In
+	}
+
+	if next.Control != nil {
+		nextControlIn = next.Control.In
+	}
+
+	switch {
+	case !reflect.DeepEqual(o.OSC, next.OSC):
+		return fmt.Errorf("changing OSC endpoints requires a restart")
+	case !reflect.DeepEqual(o.RTPMIDI, next.RTPMIDI):
+		return fmt.Errorf("changing RTP-MIDI sessions requires a restart")
+	case !reflect.DeepEqual(o.Sockets, next.Sockets):
+		return fmt.Errorf("changing socket endpoints requires a restart")
+	case !reflect.DeepEqual(o.Serial, next.Serial):
+		return fmt.Errorf("changing serial endpoints requires a restart")
+	case o.sysExBufferSize() != next.sysExBufferSize():
+		return fmt.Errorf("enabling, disabling, or resizing SysEx requires a restart")
+	case controlIn != nextControlIn:
+		return fmt.Errorf("changing the control device requires a restart")
+	default:
+		return nil
+	}
+}
+
+// sysExBufferSize reports the SysEx buffer size for listening, or zero when SysEx is disabled.
+func (o Config) sysExBufferSize() uint32 {
+	if o.SysEx == nil {
+		return 0
+	}
+
+	if o.SysEx.BufferSize == 0 {
+		return DefaultSysExBufferSize
+	}
+
+	return o.SysEx.BufferSize
+}
@@ -0,0 +1,135 @@
+package octane_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mcandre/octane"
+	"gitlab.com/gomidi/midi/v2"
+	"gitlab.com/gomidi/midi/v2/drivers"
+)
+
+func TestEngineReload(t *testing.T) {
+	out := &fakeOut{name: "synth"}
+	engine, err := octane.NewEngine(octane.Config{TransposeNote: 12}, []drivers.Out{out})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	engine.Process(midi.NoteOn(0, 60, 100), false, true)
+
+	if err2 := engine.Reload(octane.Config{TransposeNote: -12}); err2 != nil {
+		t.Fatal(err2)
+	}
+
+	engine.Process(midi.NoteOff(0, 60), false, true)
+	engine.Process(midi.NoteOn(0, 60, 100), false, true)
+
+	expected := []midi.Message{
+		midi.NoteOn(0, 72, 100),
+		midi.NoteOff(0, 72),
+		midi.NoteOn(0, 48, 100),
+	}
+
+	if len(out.sent) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, out.sent)
+	}
+
+	for i, msg := range expected {
+		if out.sent[i].String() != msg.String() {
+			t.Errorf("expected %v, got %v", msg, out.sent[i])
+		}
+	}
+
+	if err2 := engine.Reload(octane.Config{Preset: "missing"}); err2 == nil {
+		t.Errorf("expected error for invalid settings")
+	}
+}
+
+func TestEngineReloadPorts(t *testing.T) {
+	out := &fakeOut{name: "synth"}
+	lead := &fakeOut{name: "lead"}
+	config := octane.Config{
+		OSC:   []octane.OSCEndpoint{{Name: "touchosc", Listen: "127.0.0.1:8000"}},
+		SysEx: &octane.SysEx{BufferSize: 1024},
+	}
+
+	engine, err := octane.NewEngine(config, []drivers.Out{out, lead})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Routing changes among connected devices apply.
+	routed := config
+	routed.Out = []string{"lead"}
+
+	if err2 := engine.Reload(routed); err2 != nil {
+		t.Fatal(err2)
+	}
+
+	engine.Process(midi.NoteOn(0, 60, 100), false, true)
+
+	if len(out.sent) != 0 || len(lead.sent) != 1 {
+		t.Errorf("expected reloaded routing to lead, got %v and %v", out.sent, lead.sent)
+	}
+
+	// SysEx filtering applies without reconnecting.
+	filtered := routed
+	filtered.SysEx = &octane.SysEx{BufferSize: 1024, Deny: []string{"43"}}
+
+	if err2 := engine.Reload(filtered); err2 != nil {
+		t.Error(err2)
+	}
+
+	moved := config
+	moved.OSC = []octane.OSCEndpoint{{Name: "touchosc", Listen: "127.0.0.1:8001"}}
+	resized := config
+	resized.SysEx = &octane.SysEx{BufferSize: 4096}
+	controlled := config
+	controlled.Control = &octane.Control{In: "nanoPAD2"}
+	missing := config
+	missing.Out = []string{"drums"}
+	missingPreset := config
+	missingPreset.Presets = []octane.Preset{{Name: "drums", Config: octane.Config{Out: []string{"drums"}}}}
+
+	for _, c := range []octane.Config{moved, resized, controlled, missing, missingPreset} {
+		if err2 := engine.Reload(c); err2 == nil {
+			t.Errorf("expected error reloading %v", c)
+		}
+	}
+
+	if _, err2 := octane.NewEngine(missing, []drivers.Out{out}); err2 == nil {
+		t.Errorf("expected error for unknown MIDI OUT device")
+	}
+}
+
+func TestWatchConfig(t *testing.T) {
+	pth := filepath.Join(t.TempDir(), "octane.json")
+
+	if err := os.WriteFile(pth, []byte(`{}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	changes := make(chan struct{}, 1)
+	stop := octane.WatchConfig(pth, 10*time.Millisecond, func() {
+		select {
+		case changes <- struct{}{}:
+		default:
+		}
+	})
+	defer stop()
+
+	if err := os.WriteFile(pth, []byte(`{"transposeNote": 12}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-changes:
+	case <-time.After(time.Second):
+		t.Errorf("expected change notification")
+	}
+}
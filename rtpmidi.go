@@ -0,0 +1,1094 @@
+package octane
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"os"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"gitlab.com/gomidi/midi/v2"
+	"gitlab.com/gomidi/midi/v2/drivers"
+)
+
+// DefaultRTPMIDIPort denotes the customary AppleMIDI control port.
+// The data port follows it.
+const DefaultRTPMIDIPort = 5004
+
+// RTPMIDIInviteInterval denotes the pause between invitation attempts.
+const RTPMIDIInviteInterval = time.Second
+
+// RTPMIDISyncInterval denotes the pause between clock synchronizations, once connected.
+const RTPMIDISyncInterval = 10 * time.Second
+
+// RTPMIDIPeerTimeout denotes how long a peer may miss clock synchronizations before being dropped.
+const RTPMIDIPeerTimeout = 6 * RTPMIDISyncInterval
+
+// rtpMIDIJournalAge denotes how many packets a note off lingers in the recovery journal without acknowledgment.
+const rtpMIDIJournalAge = 64
+
+// AppleMIDI session commands.
+const (
+	appleMIDIInvitation = "IN"
+	appleMIDIAccept     = "OK"
+	appleMIDIReject     = "NO"
+	appleMIDIBye        = "BY"
+	appleMIDISync       = "CK"
+	appleMIDIFeedback   = "RS"
+)
+
+// rtpMIDIPayloadType denotes the RTP payload type used by AppleMIDI.
+const rtpMIDIPayloadType = 0x61
+
+// JournalNote models a note in a recovery journal.
+type JournalNote struct {
+	// Channel denotes the zero-based channel.
+	Channel uint8
+
+	// Key denotes the note number.
+	Key uint8
+
+	// Velocity denotes the note on velocity. Zero for note offs.
+	Velocity uint8
+}
+
+// RecoveryJournal models the note state carried by an RTP-MIDI recovery journal (RFC 6295 chapter N).
+type RecoveryJournal struct {
+	// Checkpoint denotes the earliest packet sequence number the journal covers.
+	Checkpoint uint16
+
+	// Notes collects notes sounding.
+	Notes []JournalNote
+
+	// Offs collects notes released since the checkpoint.
+	Offs []JournalNote
+}
+
+// channels lists the zero-based channels present in the journal, in order.
+func (o RecoveryJournal) channels() []uint8 {
+	var channels []uint8
+
+	for _, note := range append(slices.Clone(o.Notes), o.Offs...) {
+		if !slices.Contains(channels, note.Channel) {
+			channels = append(channels, note.Channel)
+		}
+	}
+
+	slices.Sort(channels)
+	return channels
+}
+
+// encode serializes the journal, coding chapter N for each channel.
+func (o RecoveryJournal) encode() []byte {
+	channels := o.channels()
+
+	if len(channels) == 0 {
+		return nil
+	}
+
+	// S=0 Y=0 A=1 H=0 TOTCHAN
+	bs := []byte{0x20 | byte(len(channels)-1)}
+	bs = binary.BigEndian.AppendUint16(bs, o.Checkpoint)
+
+	for _, channel := range channels {
+		var logs []byte
+		var offbits [16]byte
+		low, high := 15, 0
+
+		for _, note := range o.Notes {
+			if note.Channel == channel && len(logs) < 2*127 {
+				logs = append(logs, note.Key&0x7F, 0x80|note.Velocity&0x7F)
+			}
+		}
+
+		for _, note := range o.Offs {
+			if note.Channel != channel {
+				continue
+			}
+
+			octet := int(note.Key&0x7F) / 8
+			offbits[octet] |= 0x80 >> (note.Key % 8)
+			low = min(low, octet)
+			high = max(high, octet)
+		}
+
+		chapter := []byte{byte(len(logs) / 2)}
+
+		if low > high {
+			chapter = append(chapter, 0xF0)
+		} else {
+			chapter = append(chapter, byte(low<<4|high))
+		}
+
+		chapter = append(chapter, logs...)
+
+		if low <= high {
+			chapter = append(chapter, offbits[low:high+1]...)
+		}
+
+		// S=0 CHAN H=0 LENGTH, then a table of contents listing chapter N.
+		length := 3 + len(chapter)
+		bs = append(bs, channel<<3|byte(length>>8&0x03), byte(length), 0x08)
+		bs = append(bs, chapter...)
+	}
+
+	return bs
+}
+
+// decodeRecoveryJournal parses a recovery journal.
+// Channel journals without a decodable chapter N are skipped.
+func decodeRecoveryJournal(bs []byte) (RecoveryJournal, error) {
+	if len(bs) < 3 {
+		return RecoveryJournal{}, fmt.Errorf("truncated recovery journal")
+	}
+
+	journal := RecoveryJournal{Checkpoint: binary.BigEndian.Uint16(bs[1:3])}
+	system := bs[0]&0x40 != 0
+	channelJournals := bs[0]&0x20 != 0
+	total := int(bs[0]&0x0F) + 1
+	rest := bs[3:]
+
+	if system {
+		if len(rest) < 2 {
+			return RecoveryJournal{}, fmt.Errorf("truncated system journal")
+		}
+
+		length := int(binary.BigEndian.Uint16(rest) & 0x03FF)
+
+		if length > len(rest) {
+			return RecoveryJournal{}, fmt.Errorf("truncated system journal")
+		}
+
+		rest = rest[length:]
+	}
+
+	if !channelJournals {
+		return journal, nil
+	}
+
+	for range total {
+		if len(rest) < 3 {
+			return RecoveryJournal{}, fmt.Errorf("truncated channel journal")
+		}
+
+		channel := rest[0] >> 3 & 0x0F
+		length := int(rest[0]&0x03)<<8 | int(rest[1])
+
+		if length < 3 || length > len(rest) {
+			return RecoveryJournal{}, fmt.Errorf("invalid channel journal length: %v", length)
+		}
+
+		toc := rest[2]
+		chapters := rest[3:length]
+		rest = rest[length:]
+
+		if toc&0x08 == 0 || toc&0x20 != 0 {
+			continue
+		}
+
+		if toc&0x80 != 0 {
+			if len(chapters) < 3 {
+				continue
+			}
+
+			chapters = chapters[3:]
+		}
+
+		if toc&0x40 != 0 {
+			if len(chapters) < 1 || len(chapters) < 1+2*(int(chapters[0]&0x7F)+1) {
+				continue
+			}
+
+			chapters = chapters[1+2*(int(chapters[0]&0x7F)+1):]
+		}
+
+		if toc&0x10 != 0 {
+			if len(chapters) < 2 {
+				continue
+			}
+
+			chapters = chapters[2:]
+		}
+
+		if len(chapters) < 2 {
+			continue
+		}
+
+		count := int(chapters[0] & 0x7F)
+		low, high := int(chapters[1]>>4), int(chapters[1]&0x0F)
+
+		if count == 127 && low == 15 && high == 0 {
+			count = 128
+		}
+
+		chapters = chapters[2:]
+
+		if len(chapters) < 2*count {
+			continue
+		}
+
+		for i := range count {
+			key, velocity := chapters[2*i]&0x7F, chapters[2*i+1]&0x7F
+
+			if velocity > 0 {
+				journal.Notes = append(journal.Notes, JournalNote{Channel: channel, Key: key, Velocity: velocity})
+			}
+		}
+
+		chapters = chapters[2*count:]
+
+		if low > high || len(chapters) < high-low+1 {
+			continue
+		}
+
+		for i, octet := range chapters[:high-low+1] {
+			for bit := range 8 {
+				if octet&(0x80>>bit) != 0 {
+					journal.Offs = append(journal.Offs, JournalNote{Channel: channel, Key: uint8((low+i)*8 + bit)})
+				}
+			}
+		}
+	}
+
+	return journal, nil
+}
+
+// RTPMIDIPacket models an RTP-MIDI data packet.
+type RTPMIDIPacket struct {
+	// Sequence denotes the RTP sequence number.
+	Sequence uint16
+
+	// Timestamp denotes the RTP timestamp, in 100 microsecond units.
+	Timestamp uint32
+
+	// SSRC identifies the sender.
+	SSRC uint32
+
+	// Messages collects the MIDI commands.
+	Messages []midi.Message
+
+	// Journal carries recovery state, when present.
+	Journal *RecoveryJournal
+}
+
+// Encode serializes the packet.
+// Commands after the first carry zero delta times.
+func (o RTPMIDIPacket) Encode() []byte {
+	bs := []byte{0x80, rtpMIDIPayloadType}
+	bs = binary.BigEndian.AppendUint16(bs, o.Sequence)
+	bs = binary.BigEndian.AppendUint32(bs, o.Timestamp)
+	bs = binary.BigEndian.AppendUint32(bs, o.SSRC)
+
+	var list []byte
+
+	for i, msg := range o.Messages {
+		if i > 0 {
+			list = append(list, 0)
+		}
+
+		list = append(list, msg...)
+	}
+
+	var flags byte
+	var journal []byte
+
+	if o.Journal != nil {
+		journal = o.Journal.encode()
+
+		if journal != nil {
+			flags |= 0x40
+		}
+	}
+
+	if len(list) > 15 {
+		bs = append(bs, 0x80|flags|byte(len(list)>>8&0x0F), byte(len(list)))
+	} else {
+		bs = append(bs, flags|byte(len(list)))
+	}
+
+	bs = append(bs, list...)
+	return append(bs, journal...)
+}
+
+// midiCommandLength reports the data bytes following a status byte, or -1 for SysEx.
+func midiCommandLength(status byte) int {
+	switch {
+	case status < 0xC0, status >= 0xE0 && status < 0xF0:
+		return 2
+	case status < 0xE0:
+		return 1
+	case status == 0xF0:
+		return -1
+	case status == 0xF1, status == 0xF3:
+		return 1
+	case status == 0xF2:
+		return 2
+	default:
+		return 0
+	}
+}
+
+// DecodeRTPMIDI parses an RTP-MIDI data packet,
+// expanding running status and skipping delta times.
+func DecodeRTPMIDI(bs []byte) (RTPMIDIPacket, error) {
+	if len(bs) < 13 || bs[0]>>6 != 2 || bs[1]&0x7F != rtpMIDIPayloadType {
+		return RTPMIDIPacket{}, fmt.Errorf("not an RTP-MIDI packet")
+	}
+
+	packet := RTPMIDIPacket{
+		Sequence:  binary.BigEndian.Uint16(bs[2:4]),
+		Timestamp: binary.BigEndian.Uint32(bs[4:8]),
+		SSRC:      binary.BigEndian.Uint32(bs[8:12]),
+	}
+
+	header := bs[12]
+	length := int(header & 0x0F)
+	rest := bs[13:]
+
+	if header&0x80 != 0 {
+		if len(rest) < 1 {
+			return RTPMIDIPacket{}, fmt.Errorf("truncated RTP-MIDI command section")
+		}
+
+		length = length<<8 | int(rest[0])
+		rest = rest[1:]
+	}
+
+	if length > len(rest) {
+		return RTPMIDIPacket{}, fmt.Errorf("truncated RTP-MIDI command section")
+	}
+
+	list := rest[:length]
+	var running byte
+
+	for i := 0; len(list) > 0; i++ {
+		if i > 0 || header&0x20 != 0 {
+			for j := 0; j < 4 && len(list) > 0; j++ {
+				b := list[0]
+				list = list[1:]
+
+				if b&0x80 == 0 {
+					break
+				}
+			}
+		}
+
+		if len(list) == 0 {
+			break
+		}
+
+		status := list[0]
+
+		if status < 0x80 {
+			if running == 0 {
+				return RTPMIDIPacket{}, fmt.Errorf("running status without status byte")
+			}
+
+			status = running
+		} else {
+			list = list[1:]
+
+			if status < 0xF0 {
+				running = status
+			}
+		}
+
+		n := midiCommandLength(status)
+
+		if n < 0 {
+			end := slices.Index(list, 0xF7)
+
+			if end < 0 {
+				return RTPMIDIPacket{}, fmt.Errorf("unterminated SysEx")
+			}
+
+			packet.Messages = append(packet.Messages, midi.Message(append([]byte{status}, list[:end+1]...)))
+			list = list[end+1:]
+			continue
+		}
+
+		if n > len(list) {
+			return RTPMIDIPacket{}, fmt.Errorf("truncated MIDI command")
+		}
+
+		packet.Messages = append(packet.Messages, midi.Message(append([]byte{status}, list[:n]...)))
+		list = list[n:]
+	}
+
+	if header&0x40 != 0 {
+		journal, err := decodeRecoveryJournal(rest[length:])
+
+		if err != nil {
+			return RTPMIDIPacket{}, err
+		}
+
+		packet.Journal = &journal
+	}
+
+	return packet, nil
+}
+
+// RTPMIDISession declares an RTP-MIDI (AppleMIDI) network session pseudo-port.
+type RTPMIDISession struct {
+	// Name identifies the pseudo-port, and announces the session to peers.
+	Name string `json:"name"`
+
+	// Listen denotes the local control port address. The data port follows it.
+	// Default ":5004".
+	Listen string `json:"listen,omitempty"`
+
+	// Connect denotes a remote control port address to invite.
+	// Omitted waits for invitations.
+	Connect string `json:"connect,omitempty"`
+}
+
+// Validate checks the session for errors.
+func (o RTPMIDISession) Validate() error {
+	if o.Name == "" {
+		return fmt.Errorf("RTP-MIDI session requires a name")
+	}
+
+	for _, address := range []string{o.Listen, o.Connect} {
+		if address == "" {
+			continue
+		}
+
+		if _, _, err := net.SplitHostPort(address); err != nil {
+			return fmt.Errorf("invalid RTP-MIDI address: %v", address)
+		}
+	}
+
+	return nil
+}
+
+// rtpMIDIPeer tracks a remote session participant.
+type rtpMIDIPeer struct {
+	ssrc uint32
+
+	name string
+
+	control *net.UDPAddr
+
+	data *net.UDPAddr
+
+	sequence uint16
+
+	heard bool
+
+	synced time.Time
+
+	sounding [16][128]bool
+}
+
+// RTPMIDIPort presents an RTP-MIDI session as a MIDI IN and MIDI OUT device.
+// RTPMIDIPort implements drivers.In and drivers.Out.
+type RTPMIDIPort struct {
+	mutex sync.Mutex
+
+	session RTPMIDISession
+
+	number int
+
+	ssrc uint32
+
+	token uint32
+
+	start time.Time
+
+	control *net.UDPConn
+
+	data *net.UDPConn
+
+	done chan struct{}
+
+	peers map[uint32]*rtpMIDIPeer
+
+	onMsg func([]byte, int32)
+
+	sequence uint16
+
+	acknowledged uint16
+
+	notes map[JournalNote]bool
+
+	offs map[JournalNote]uint16
+}
+
+// NewRTPMIDIPort prepares an RTP-MIDI pseudo-port.
+// number distinguishes the port from other pseudo-ports.
+func NewRTPMIDIPort(session RTPMIDISession, number int) *RTPMIDIPort {
+	return &RTPMIDIPort{
+		session: session,
+		number:  number,
+		ssrc:    rand.Uint32(),
+		token:   rand.Uint32(),
+		peers:   map[uint32]*rtpMIDIPeer{},
+		notes:   map[JournalNote]bool{},
+		offs:    map[JournalNote]uint16{},
+	}
+}
+
+// Open binds the control and data ports, inviting the remote peer when configured.
+func (o *RTPMIDIPort) Open() error {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	if o.control != nil {
+		return nil
+	}
+
+	listen := o.session.Listen
+
+	if listen == "" {
+		listen = ":" + strconv.Itoa(DefaultRTPMIDIPort)
+	}
+
+	controlAddr, err := net.ResolveUDPAddr("udp", listen)
+
+	if err != nil {
+		return err
+	}
+
+	var remote *net.UDPAddr
+
+	if o.session.Connect != "" {
+		if remote, err = net.ResolveUDPAddr("udp", o.session.Connect); err != nil {
+			return err
+		}
+	}
+
+	control, err := net.ListenUDP("udp", controlAddr)
+
+	if err != nil {
+		return err
+	}
+
+	dataAddr := *control.LocalAddr().(*net.UDPAddr)
+	dataAddr.Port++
+	data, err := net.ListenUDP("udp", &dataAddr)
+
+	if err != nil {
+		_ = control.Close()
+		return err
+	}
+
+	o.control = control
+	o.data = data
+	o.start = time.Now()
+	o.done = make(chan struct{})
+	go o.receive(control, false)
+	go o.receive(data, true)
+
+	go o.expire(o.done)
+
+	if remote != nil {
+		go o.invite(remote, o.done)
+	}
+
+	return nil
+}
+
+// now reports the session clock, in 100 microsecond units.
+func (o *RTPMIDIPort) now() uint64 {
+	return uint64(time.Since(o.start) / (100 * time.Microsecond))
+}
+
+// sessionPacket serializes an invitation, acceptance, rejection, or bye.
+func (o *RTPMIDIPort) sessionPacket(command string, token uint32) []byte {
+	bs := append([]byte{0xFF, 0xFF}, command...)
+	bs = binary.BigEndian.AppendUint32(bs, 2)
+	bs = binary.BigEndian.AppendUint32(bs, token)
+	bs = binary.BigEndian.AppendUint32(bs, o.ssrc)
+
+	if command == appleMIDIBye {
+		return bs
+	}
+
+	bs = append(bs, o.session.Name...)
+	return append(bs, 0)
+}
+
+// syncPacket serializes a clock synchronization.
+func (o *RTPMIDIPort) syncPacket(count byte, timestamps [3]uint64) []byte {
+	bs := append([]byte{0xFF, 0xFF}, appleMIDISync...)
+	bs = binary.BigEndian.AppendUint32(bs, o.ssrc)
+	bs = append(bs, count, 0, 0, 0)
+
+	for _, timestamp := range timestamps {
+		bs = binary.BigEndian.AppendUint64(bs, timestamp)
+	}
+
+	return bs
+}
+
+// write sends a packet, reporting errors.
+func write(conn *net.UDPConn, bs []byte, addr *net.UDPAddr) {
+	if _, err := conn.WriteToUDP(bs, addr); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
+}
+
+// invite repeatedly invites the remote peer until connected,
+// then synchronizes clocks periodically.
+func (o *RTPMIDIPort) invite(control *net.UDPAddr, done chan struct{}) {
+	data := &net.UDPAddr{IP: control.IP, Port: control.Port + 1, Zone: control.Zone}
+	ticker := time.NewTicker(RTPMIDIInviteInterval)
+	defer ticker.Stop()
+	var synced time.Time
+
+	for {
+		o.mutex.Lock()
+
+		if o.control == nil {
+			o.mutex.Unlock()
+			return
+		}
+
+		var peer *rtpMIDIPeer
+
+		for _, p := range o.peers {
+			if p.control != nil && p.control.String() == control.String() {
+				peer = p
+			}
+		}
+
+		// Checking in at the invitation interval returns to inviting promptly
+		// after the peer says goodbye or expires.
+		switch {
+		case peer == nil:
+			write(o.control, o.sessionPacket(appleMIDIInvitation, o.token), control)
+			synced = time.Time{}
+		case peer.data == nil:
+			write(o.data, o.sessionPacket(appleMIDIInvitation, o.token), data)
+			synced = time.Time{}
+		case time.Since(synced) >= RTPMIDISyncInterval:
+			write(o.data, o.syncPacket(0, [3]uint64{o.now()}), peer.data)
+			synced = time.Now()
+		}
+
+		o.mutex.Unlock()
+
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// expire drops peers missing clock synchronizations for RTPMIDIPeerTimeout.
+func (o *RTPMIDIPort) expire(done chan struct{}) {
+	ticker := time.NewTicker(RTPMIDISyncInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+
+		o.mutex.Lock()
+
+		for ssrc, peer := range o.peers {
+			if time.Since(peer.synced) > RTPMIDIPeerTimeout {
+				delete(o.peers, ssrc)
+			}
+		}
+
+		o.mutex.Unlock()
+	}
+}
+
+// receive handles packets arriving on the control or data port until the socket closes.
+func (o *RTPMIDIPort) receive(conn *net.UDPConn, data bool) {
+	packet := make([]byte, 65535)
+
+	for {
+		n, addr, err := conn.ReadFromUDP(packet)
+
+		if err != nil {
+			return
+		}
+
+		bs := packet[:n]
+
+		if n >= 4 && bs[0] == 0xFF && bs[1] == 0xFF {
+			o.handleSession(conn, data, string(bs[2:4]), bs[4:], addr)
+			continue
+		}
+
+		if data {
+			o.handleData(bs)
+		}
+	}
+}
+
+// handleSession answers AppleMIDI session commands.
+func (o *RTPMIDIPort) handleSession(conn *net.UDPConn, data bool, command string, body []byte, addr *net.UDPAddr) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	switch command {
+	case appleMIDIInvitation, appleMIDIAccept:
+		if len(body) < 12 {
+			return
+		}
+
+		token := binary.BigEndian.Uint32(body[4:8])
+		ssrc := binary.BigEndian.Uint32(body[8:12])
+		name := string(body[12:])
+
+		if i := slices.Index(body[12:], 0); i >= 0 {
+			name = string(body[12 : 12+i])
+		}
+
+		if command == appleMIDIAccept && token != o.token {
+			return
+		}
+
+		peer, ok := o.peers[ssrc]
+
+		if !ok {
+			if data {
+				if command == appleMIDIInvitation {
+					write(conn, o.sessionPacket(appleMIDIReject, token), addr)
+				}
+
+				return
+			}
+
+			peer = &rtpMIDIPeer{ssrc: ssrc}
+			o.peers[ssrc] = peer
+		}
+
+		peer.name = name
+		peer.synced = time.Now()
+
+		if data {
+			peer.data = addr
+		} else {
+			peer.control = addr
+		}
+
+		switch {
+		case command == appleMIDIInvitation:
+			write(conn, o.sessionPacket(appleMIDIAccept, token), addr)
+		case !data:
+			// Proceed to invite the data port without waiting for a retry.
+			write(o.data, o.sessionPacket(appleMIDIInvitation, o.token), &net.UDPAddr{IP: addr.IP, Port: addr.Port + 1, Zone: addr.Zone})
+		}
+	case appleMIDIBye:
+		if len(body) < 12 {
+			return
+		}
+
+		delete(o.peers, binary.BigEndian.Uint32(body[8:12]))
+	case appleMIDISync:
+		if len(body) < 32 {
+			return
+		}
+
+		var timestamps [3]uint64
+
+		for i := range timestamps {
+			timestamps[i] = binary.BigEndian.Uint64(body[8+8*i:])
+		}
+
+		if peer, ok := o.peers[binary.BigEndian.Uint32(body[0:4])]; ok {
+			peer.synced = time.Now()
+		}
+
+		switch count := body[4]; count {
+		case 0:
+			timestamps[1] = o.now()
+			write(conn, o.syncPacket(1, timestamps), addr)
+		case 1:
+			timestamps[2] = o.now()
+			write(conn, o.syncPacket(2, timestamps), addr)
+		}
+	case appleMIDIFeedback:
+		if len(body) < 6 {
+			return
+		}
+
+		acknowledged := binary.BigEndian.Uint16(body[4:6])
+
+		for note, sequence := range o.offs {
+			if int16(acknowledged-sequence) >= 0 {
+				delete(o.offs, note)
+			}
+		}
+
+		o.acknowledged = acknowledged
+	}
+}
+
+// handleData delivers MIDI commands, recovering note state from the journal after packet loss.
+func (o *RTPMIDIPort) handleData(bs []byte) {
+	packet, err := DecodeRTPMIDI(bs)
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return
+	}
+
+	o.mutex.Lock()
+	peer, ok := o.peers[packet.SSRC]
+	onMsg := o.onMsg
+	var msgs []midi.Message
+
+	// Duplicate and reordered packets arrive at or behind the latest sequence number.
+	if ok && peer.heard && int16(packet.Sequence-peer.sequence) <= 0 {
+		ok = false
+	}
+
+	if ok {
+		lost := peer.heard && packet.Sequence != peer.sequence+1
+
+		if lost && packet.Journal != nil {
+			msgs = append(msgs, peer.recover(*packet.Journal)...)
+		}
+
+		peer.heard = true
+		peer.sequence = packet.Sequence
+
+		for _, msg := range packet.Messages {
+			peer.track(msg)
+		}
+
+		msgs = append(msgs, packet.Messages...)
+		feedback := append([]byte{0xFF, 0xFF}, appleMIDIFeedback...)
+		feedback = binary.BigEndian.AppendUint32(feedback, o.ssrc)
+		feedback = binary.BigEndian.AppendUint16(feedback, packet.Sequence)
+		feedback = append(feedback, 0, 0)
+
+		if peer.control != nil {
+			write(o.control, feedback, peer.control)
+		}
+	}
+
+	o.mutex.Unlock()
+
+	if onMsg == nil {
+		return
+	}
+
+	for _, msg := range msgs {
+		onMsg(msg, 0)
+	}
+}
+
+// track records the notes sounding from a peer.
+func (o *rtpMIDIPeer) track(msg midi.Message) {
+	var channel uint8
+	var key uint8
+	var velocity uint8
+
+	switch {
+	case msg.GetNoteStart(&channel, &key, &velocity):
+		o.sounding[channel][key] = true
+	case msg.GetNoteEnd(&channel, &key):
+		o.sounding[channel][key] = false
+	}
+}
+
+// recover reconciles the notes sounding from a peer with a recovery journal.
+func (o *rtpMIDIPeer) recover(journal RecoveryJournal) []midi.Message {
+	var msgs []midi.Message
+
+	for _, note := range journal.Offs {
+		if o.sounding[note.Channel][note.Key] {
+			msgs = append(msgs, midi.NoteOff(note.Channel, note.Key))
+		}
+	}
+
+	for _, note := range journal.Notes {
+		if !o.sounding[note.Channel][note.Key] {
+			msgs = append(msgs, midi.NoteOn(note.Channel, note.Key, note.Velocity))
+		}
+	}
+
+	for _, msg := range msgs {
+		o.track(msg)
+	}
+
+	return msgs
+}
+
+// Close says goodbye to peers, then releases the sockets.
+func (o *RTPMIDIPort) Close() error {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	if o.control == nil {
+		return nil
+	}
+
+	for _, peer := range o.peers {
+		if peer.control != nil {
+			write(o.control, o.sessionPacket(appleMIDIBye, o.token), peer.control)
+		}
+	}
+
+	clear(o.peers)
+	close(o.done)
+	err := o.control.Close()
+
+	if err2 := o.data.Close(); err == nil {
+		err = err2
+	}
+
+	o.control = nil
+	o.data = nil
+	return err
+}
+
+// IsOpen reports whether the session sockets are bound.
+func (o *RTPMIDIPort) IsOpen() bool {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	return o.control != nil
+}
+
+// Number distinguishes the port from other pseudo-ports.
+func (o *RTPMIDIPort) Number() int { return o.number }
+
+// String names the port.
+func (o *RTPMIDIPort) String() string { return o.session.Name }
+
+// Underlying exposes the session settings.
+func (o *RTPMIDIPort) Underlying() interface{} { return o.session }
+
+// Peers names the connected session participants.
+func (o *RTPMIDIPort) Peers() []string {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	var names []string
+
+	for _, peer := range o.peers {
+		if peer.data != nil {
+			names = append(names, peer.name)
+		}
+	}
+
+	slices.Sort(names)
+	return names
+}
+
+// Listen begins delivering MIDI commands from peers.
+func (o *RTPMIDIPort) Listen(onMsg func([]byte, int32), _ drivers.ListenConfig) (func(), error) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	if o.control == nil {
+		return nil, drivers.ErrPortClosed
+	}
+
+	o.onMsg = onMsg
+
+	return func() {
+		o.mutex.Lock()
+		defer o.mutex.Unlock()
+		o.onMsg = nil
+	}, nil
+}
+
+// Send transmits a MIDI message to each connected peer,
+// along with a recovery journal of note state.
+func (o *RTPMIDIPort) Send(data []byte) error {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	if o.data == nil {
+		return drivers.ErrPortClosed
+	}
+
+	msg := midi.Message(slices.Clone(data))
+	o.sequence++
+	o.journal(msg)
+	journal := RecoveryJournal{Checkpoint: o.acknowledged + 1}
+
+	for note := range o.notes {
+		journal.Notes = append(journal.Notes, note)
+	}
+
+	for note := range o.offs {
+		journal.Offs = append(journal.Offs, note)
+	}
+
+	packet := RTPMIDIPacket{
+		Sequence:  o.sequence,
+		Timestamp: uint32(o.now()),
+		SSRC:      o.ssrc,
+		Messages:  []midi.Message{msg},
+		Journal:   &journal,
+	}
+
+	bs := packet.Encode()
+
+	for _, peer := range o.peers {
+		if peer.data == nil {
+			continue
+		}
+
+		if _, err := o.data.WriteToUDP(bs, peer.data); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// journal records note state for recovery.
+func (o *RTPMIDIPort) journal(msg midi.Message) {
+	var channel uint8
+	var key uint8
+	var velocity uint8
+
+	switch {
+	case msg.GetNoteStart(&channel, &key, &velocity):
+		for note := range o.notes {
+			if note.Channel == channel && note.Key == key {
+				delete(o.notes, note)
+			}
+		}
+
+		delete(o.offs, JournalNote{Channel: channel, Key: key})
+		o.notes[JournalNote{Channel: channel, Key: key, Velocity: velocity}] = true
+	case msg.GetNoteEnd(&channel, &key):
+		for note := range o.notes {
+			if note.Channel == channel && note.Key == key {
+				delete(o.notes, note)
+			}
+		}
+
+		o.offs[JournalNote{Channel: channel, Key: key}] = o.sequence
+	}
+
+	for note, sequence := range o.offs {
+		if o.sequence-sequence > rtpMIDIJournalAge {
+			delete(o.offs, note)
+		}
+	}
+}
+
+// RTPMIDIPorts prepares pseudo-ports for the configured RTP-MIDI sessions.
+// Each session serves as both a MIDI IN and a MIDI OUT device.
+func (o Config) RTPMIDIPorts() ([]drivers.In, []drivers.Out) {
+	var ins []drivers.In
+	var outs []drivers.Out
+
+	for i, session := range o.RTPMIDI {
+		port := NewRTPMIDIPort(session, i)
+		ins = append(ins, port)
+		outs = append(outs, port)
+	}
+
+	return ins, outs
+}
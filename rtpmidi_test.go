@@ -0,0 +1,260 @@
+package octane_test
+
+import (
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/mcandre/octane"
+	"gitlab.com/gomidi/midi/v2"
+)
+
+func TestRTPMIDIPacket(t *testing.T) {
+	packet := octane.RTPMIDIPacket{
+		Sequence:  7,
+		Timestamp: 1000,
+		SSRC:      0xCAFE,
+		Messages: []midi.Message{
+			midi.NoteOn(0, 60, 100),
+			midi.ControlChange(1, 74, 64),
+			midi.Message{0xF0, 0x43, 0x10, 0xF7},
+			midi.NoteOn(0, 62, 90),
+			midi.NoteOn(0, 64, 80),
+			midi.NoteOn(0, 65, 70),
+		},
+		Journal: &octane.RecoveryJournal{
+			Checkpoint: 3,
+			Notes:      []octane.JournalNote{{Channel: 0, Key: 60, Velocity: 100}},
+			Offs:       []octane.JournalNote{{Channel: 0, Key: 62}, {Channel: 2, Key: 127}},
+		},
+	}
+
+	decoded, err := octane.DecodeRTPMIDI(packet.Encode())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if decoded.Sequence != packet.Sequence || decoded.Timestamp != packet.Timestamp || decoded.SSRC != packet.SSRC {
+		t.Errorf("expected header %v, got %v", packet, decoded)
+	}
+
+	if len(decoded.Messages) != len(packet.Messages) {
+		t.Fatalf("expected %v, got %v", packet.Messages, decoded.Messages)
+	}
+
+	for i, msg := range packet.Messages {
+		if decoded.Messages[i].String() != msg.String() {
+			t.Errorf("expected %v, got %v", msg, decoded.Messages[i])
+		}
+	}
+
+	if decoded.Journal == nil {
+		t.Fatal("expected journal")
+	}
+
+	if decoded.Journal.Checkpoint != 3 || len(decoded.Journal.Notes) != 1 || decoded.Journal.Notes[0] != packet.Journal.Notes[0] {
+		t.Errorf("expected journal %v, got %v", packet.Journal, decoded.Journal)
+	}
+
+	if len(decoded.Journal.Offs) != 2 || decoded.Journal.Offs[0] != packet.Journal.Offs[0] || decoded.Journal.Offs[1] != packet.Journal.Offs[1] {
+		t.Errorf("expected journal offs %v, got %v", packet.Journal.Offs, decoded.Journal.Offs)
+	}
+}
+
+func TestDecodeRTPMIDIRunningStatus(t *testing.T) {
+	bs := []byte{
+		0x80, 0x61, 0x00, 0x01, 0, 0, 0, 0, 0, 0, 0, 1,
+		// Z=1: the first command carries a delta time.
+		0x28,
+		0x00, 0x90, 0x3C, 0x64,
+		0x81, 0x00, 0x3E, 0x64,
+	}
+
+	packet, err := octane.DecodeRTPMIDI(bs)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []midi.Message{midi.NoteOn(0, 60, 100), midi.NoteOn(0, 62, 100)}
+
+	if len(packet.Messages) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, packet.Messages)
+	}
+
+	for i, msg := range expected {
+		if packet.Messages[i].String() != msg.String() {
+			t.Errorf("expected %v, got %v", msg, packet.Messages[i])
+		}
+	}
+}
+
+func TestRTPMIDISession(t *testing.T) {
+	probe, err := net.ListenPacket("udp", "127.0.0.1:0")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	port := probe.LocalAddr().(*net.UDPAddr).Port
+
+	if err2 := probe.Close(); err2 != nil {
+		t.Fatal(err2)
+	}
+
+	address := "127.0.0.1:" + strconv.Itoa(port)
+	listener := octane.NewRTPMIDIPort(octane.RTPMIDISession{Name: "listener", Listen: address}, 0)
+	initiator := octane.NewRTPMIDIPort(octane.RTPMIDISession{Name: "initiator", Listen: "127.0.0.1:0", Connect: address}, 1)
+
+	received := make(chan midi.Message, 1)
+
+	stop, err := midi.ListenTo(listener, func(msg midi.Message, _ int32) {
+		received <- msg
+	})
+
+	if err != nil {
+		t.Skip(err)
+	}
+
+	defer listener.Close()
+	defer stop()
+
+	if err2 := initiator.Open(); err2 != nil {
+		t.Skip(err2)
+	}
+
+	defer initiator.Close()
+	deadline := time.Now().Add(5 * time.Second)
+
+	for len(initiator.Peers()) == 0 || len(listener.Peers()) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("expected session to connect")
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if peers := listener.Peers(); peers[0] != "initiator" {
+		t.Errorf("expected peer initiator, got %v", peers)
+	}
+
+	if err2 := initiator.Send(midi.NoteOn(0, 60, 100)); err2 != nil {
+		t.Fatal(err2)
+	}
+
+	select {
+	case msg := <-received:
+		if msg.String() != midi.NoteOn(0, 60, 100).String() {
+			t.Errorf("expected %v, got %v", midi.NoteOn(0, 60, 100), msg)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("expected RTP-MIDI message")
+	}
+
+	// The initiator invites again promptly after the listener says goodbye,
+	// even once synchronizing clocks.
+	time.Sleep(octane.RTPMIDIInviteInterval + 100*time.Millisecond)
+
+	if err2 := listener.Close(); err2 != nil {
+		t.Fatal(err2)
+	}
+
+	if err2 := listener.Open(); err2 != nil {
+		t.Fatal(err2)
+	}
+
+	deadline = time.Now().Add(3 * time.Second)
+
+	for len(initiator.Peers()) == 0 || len(listener.Peers()) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("expected session to reconnect")
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestRTPMIDISequence(t *testing.T) {
+	address := freeAddress(t, "udp")
+	listener := octane.NewRTPMIDIPort(octane.RTPMIDISession{Name: "listener", Listen: address}, 0)
+	received := make(chan midi.Message, 8)
+
+	stop, err := midi.ListenTo(listener, func(msg midi.Message, _ int32) {
+		received <- msg
+	})
+
+	if err != nil {
+		t.Skip(err)
+	}
+
+	defer listener.Close()
+	defer stop()
+
+	control, err := net.ResolveUDPAddr("udp", address)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := &net.UDPAddr{IP: control.IP, Port: control.Port + 1}
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: control.IP})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer conn.Close()
+
+	// Join the session by hand, as peer 0xCAFE.
+	invitation := []byte{0xFF, 0xFF, 'I', 'N', 0, 0, 0, 2, 0, 0, 0, 1, 0, 0, 0xCA, 0xFE, 'p', 0}
+
+	for _, addr := range []*net.UDPAddr{control, data} {
+		if _, err2 := conn.WriteToUDP(invitation, addr); err2 != nil {
+			t.Fatal(err2)
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if peers := listener.Peers(); len(peers) != 1 {
+		t.Fatalf("expected peer p, got %v", peers)
+	}
+
+	// Duplicate and reordered packets neither repeat messages nor count as losses.
+	journal := &octane.RecoveryJournal{Notes: []octane.JournalNote{{Key: 64, Velocity: 100}}}
+
+	for _, packet := range []octane.RTPMIDIPacket{
+		{Sequence: 1, Messages: []midi.Message{midi.NoteOn(0, 60, 100)}},
+		{Sequence: 2, Messages: []midi.Message{midi.NoteOn(0, 62, 100)}},
+		{Sequence: 2, Messages: []midi.Message{midi.NoteOn(0, 62, 100)}, Journal: journal},
+		{Sequence: 1, Messages: []midi.Message{midi.NoteOn(0, 60, 100)}, Journal: journal},
+		{Sequence: 3, Messages: []midi.Message{midi.NoteOff(0, 60)}},
+	} {
+		packet.SSRC = 0xCAFE
+
+		if _, err2 := conn.WriteToUDP(packet.Encode(), data); err2 != nil {
+			t.Fatal(err2)
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	for _, expected := range []midi.Message{midi.NoteOn(0, 60, 100), midi.NoteOn(0, 62, 100), midi.NoteOff(0, 60)} {
+		select {
+		case msg := <-received:
+			if msg.String() != expected.String() {
+				t.Errorf("expected %v, got %v", expected, msg)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("expected %v", expected)
+		}
+	}
+
+	select {
+	case msg := <-received:
+		t.Errorf("expected no more messages, got %v", msg)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
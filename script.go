@@ -0,0 +1,418 @@
+package octane
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"slices"
+	"time"
+
+	"gitlab.com/gomidi/midi/v2"
+	"go.starlark.net/starlark"
+	"go.starlark.net/syntax"
+)
+
+// ScriptMaxOutputs limits the messages a script emits per incoming message.
+const ScriptMaxOutputs = 64
+
+// ScriptMaxDelay limits how far ahead a script schedules output.
+const ScriptMaxDelay = time.Minute
+
+// ScriptMaxSteps limits the computation a script spends per incoming message,
+// so that a runaway script drops messages rather than stalling routing.
+const ScriptMaxSteps = 1 << 20
+
+// ScriptHandler names the function a script defines to transform messages.
+const ScriptHandler = "on_message"
+
+// ScriptOutput denotes a message emitted by a script.
+type ScriptOutput struct {
+	// Delay denotes how long to wait before routing the message.
+	Delay time.Duration
+
+	// Message denotes the emitted message.
+	Message midi.Message
+}
+
+// Script transforms messages with a Starlark program.
+//
+// The program defines on_message(msg, port, time), called for each incoming message
+// with the message, the name of its MIDI IN device, and its arrival time in milliseconds since the Unix epoch.
+// The function returns a message, a list of messages, or None to drop the message.
+//
+// Messages expose the filter expression fields as attributes, like msg.key,
+// reading None when absent. msg.type follows the text format names, like "note_on".
+//
+// Predeclared names:
+//
+//	state: a dict kept between calls, which the program may fill at the top level
+//	message(text): a message in the text format, like message("note_on ch1 C4 100"), or from a list of bytes
+//	note_on(channel, key, velocity), note_off(channel, key), control_change(channel, controller, value): messages, with channels 1-16
+//	after(delay, msg): delays a message by a duration like "250ms"
+//
+// Programs have no access to files, the network, or the clock.
+type Script struct {
+	program *starlark.Program
+
+	handler starlark.Callable
+}
+
+// scriptBuiltins collects the predeclared functions, besides state.
+var scriptBuiltins = starlark.StringDict{
+	"message":        starlark.NewBuiltin("message", scriptMessageBuiltin),
+	"note_on":        starlark.NewBuiltin("note_on", scriptNoteOn),
+	"note_off":       starlark.NewBuiltin("note_off", scriptNoteOff),
+	"control_change": starlark.NewBuiltin("control_change", scriptControlChange),
+	"after":          starlark.NewBuiltin("after", scriptAfter),
+}
+
+// LoadScript reads a script file.
+func LoadScript(pth string) (*Script, error) {
+	bs, err := os.ReadFile(pth)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return parseScript(pth, bs)
+}
+
+// ParseScript compiles a script.
+func ParseScript(src string) (*Script, error) {
+	return parseScript("script", src)
+}
+
+// parseScript compiles a script, naming the file in errors.
+func parseScript(filename string, src any) (*Script, error) {
+	isPredeclared := func(name string) bool {
+		return name == "state" || scriptBuiltins.Has(name)
+	}
+
+	_, program, err := starlark.SourceProgramOptions(&syntax.FileOptions{}, filename, src, isPredeclared)
+
+	if err != nil {
+		return nil, err
+	}
+
+	o := &Script{program: program}
+
+	if err := o.Reset(); err != nil {
+		return nil, err
+	}
+
+	return o, nil
+}
+
+// scriptThread prepares a sandboxed interpreter thread, printing to stderr.
+func scriptThread() *starlark.Thread {
+	thread := &starlark.Thread{
+		Name: "script",
+		Print: func(_ *starlark.Thread, msg string) {
+			fmt.Fprintln(os.Stderr, msg)
+		},
+	}
+
+	thread.SetMaxExecutionSteps(ScriptMaxSteps)
+	return thread
+}
+
+// Reset runs the program afresh, emptying state.
+func (o *Script) Reset() error {
+	state := starlark.NewDict(0)
+	predeclared := starlark.StringDict{"state": state}
+
+	for name, builtin := range scriptBuiltins {
+		predeclared[name] = builtin
+	}
+
+	globals, err := o.program.Init(scriptThread(), predeclared)
+
+	if err != nil {
+		return err
+	}
+
+	handler, ok := globals[ScriptHandler].(*starlark.Function)
+
+	if !ok {
+		return fmt.Errorf("script requires a function %v(msg, port, time)", ScriptHandler)
+	}
+
+	if handler.NumParams() != 3 {
+		return fmt.Errorf("%v requires three parameters: msg, port, and time", ScriptHandler)
+	}
+
+	o.handler = handler
+	return nil
+}
+
+// Run feeds a message arriving from the named port at a time through the script.
+//
+// Errors, such as out of range values or exceeding ScriptMaxSteps, drop the message,
+// so that a faulty script cannot disrupt routing.
+// State changes made before the error remain.
+func (o *Script) Run(port string, msg midi.Message, at time.Time) ([]ScriptOutput, error) {
+	args := starlark.Tuple{scriptMessage{msg: msg}, starlark.String(port), starlark.MakeInt64(at.UnixMilli())}
+	result, err := starlark.Call(scriptThread(), o.handler, args, nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var values []starlark.Value
+
+	switch result := result.(type) {
+	case starlark.NoneType:
+	case *starlark.List:
+		for i := range result.Len() {
+			values = append(values, result.Index(i))
+		}
+	case starlark.Tuple:
+		values = result
+	default:
+		values = []starlark.Value{result}
+	}
+
+	if len(values) > ScriptMaxOutputs {
+		return nil, fmt.Errorf("script exceeded %v messages", ScriptMaxOutputs)
+	}
+
+	var outputs []ScriptOutput
+
+	for _, value := range values {
+		switch value := value.(type) {
+		case scriptMessage:
+			outputs = append(outputs, ScriptOutput{Message: value.msg})
+		case scriptDelayed:
+			outputs = append(outputs, value.output)
+		default:
+			return nil, fmt.Errorf("%v returned %v, not a message", ScriptHandler, value.Type())
+		}
+	}
+
+	return outputs, nil
+}
+
+// scriptMessage presents a MIDI message to scripts.
+type scriptMessage struct {
+	msg midi.Message
+}
+
+// String renders the message in the text format.
+func (o scriptMessage) String() string { return formatTextMessage(o.msg) }
+
+// Type names the Starlark type.
+func (o scriptMessage) Type() string { return "message" }
+
+// Freeze does nothing, as messages are immutable.
+func (o scriptMessage) Freeze() {}
+
+// Truth reports messages as true.
+func (o scriptMessage) Truth() starlark.Bool { return starlark.True }
+
+// Hash hashes the message bytes.
+func (o scriptMessage) Hash() (uint32, error) { return starlark.String(o.msg).Hash() }
+
+// CompareSameType compares message bytes for equality.
+func (o scriptMessage) CompareSameType(op syntax.Token, y starlark.Value, _ int) (bool, error) {
+	equal := bytes.Equal(o.msg, y.(scriptMessage).msg)
+
+	switch op {
+	case syntax.EQL:
+		return equal, nil
+	case syntax.NEQ:
+		return !equal, nil
+	}
+
+	return false, fmt.Errorf("messages support only == and !=")
+}
+
+// Attr reads a message field, or the message bytes.
+func (o scriptMessage) Attr(name string) (starlark.Value, error) {
+	fields := messageFields(o.msg)
+
+	switch {
+	case name == "type":
+		if s, ok := textTypes[midi.Type(fields[name])]; ok {
+			return starlark.String(s), nil
+		}
+
+		return starlark.String(TextRaw), nil
+	case name == "bytes":
+		var values starlark.Tuple
+
+		for _, b := range o.msg {
+			values = append(values, starlark.MakeInt(int(b)))
+		}
+
+		return values, nil
+	case slices.Contains(FilterFields, name):
+		if v, ok := fields[name]; ok {
+			return starlark.MakeInt(v), nil
+		}
+
+		return starlark.None, nil
+	}
+
+	return nil, nil
+}
+
+// AttrNames lists the message fields.
+func (o scriptMessage) AttrNames() []string {
+	return append(slices.Clone(FilterFields), "bytes")
+}
+
+// scriptDelayed presents a delayed message to scripts.
+type scriptDelayed struct {
+	output ScriptOutput
+}
+
+// String renders the delayed message.
+func (o scriptDelayed) String() string {
+	return fmt.Sprintf("after(%q, %v)", o.output.Delay, formatTextMessage(o.output.Message))
+}
+
+// Type names the Starlark type.
+func (o scriptDelayed) Type() string { return "delayed" }
+
+// Freeze does nothing, as delayed messages are immutable.
+func (o scriptDelayed) Freeze() {}
+
+// Truth reports delayed messages as true.
+func (o scriptDelayed) Truth() starlark.Bool { return starlark.True }
+
+// Hash rejects hashing.
+func (o scriptDelayed) Hash() (uint32, error) {
+	return 0, fmt.Errorf("unhashable type: delayed")
+}
+
+// scriptMessageBuiltin implements message(text), or message(bytes).
+func scriptMessageBuiltin(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var value starlark.Value
+
+	if err := starlark.UnpackPositionalArgs(b.Name(), args, kwargs, 1, &value); err != nil {
+		return nil, err
+	}
+
+	if s, ok := value.(starlark.String); ok {
+		offset, msg, err := ParseText(string(s))
+
+		if err == nil && (msg == nil || offset != 0) {
+			err = fmt.Errorf("requires a text message without offset: %v", s)
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("%v: %v", b.Name(), err)
+		}
+
+		return scriptMessage{msg: msg}, nil
+	}
+
+	iterable, ok := value.(starlark.Iterable)
+
+	if !ok {
+		return nil, fmt.Errorf("%v: requires text or a list of bytes, got %v", b.Name(), value.Type())
+	}
+
+	var bs []byte
+	iterator := iterable.Iterate()
+	defer iterator.Done()
+	var element starlark.Value
+
+	for iterator.Next(&element) {
+		var n uint8
+
+		if err := starlark.AsInt(element, &n); err != nil {
+			return nil, fmt.Errorf("%v: %v", b.Name(), err)
+		}
+
+		bs = append(bs, n)
+	}
+
+	// Bytes pass as is, like raw text messages, once they begin with a status byte.
+	if len(bs) == 0 || bs[0] < 0x80 {
+		return nil, fmt.Errorf("%v: requires a status byte: % X", b.Name(), bs)
+	}
+
+	return scriptMessage{msg: bs}, nil
+}
+
+// unpackScriptChannel unpacks a channel (1-16) and data bytes (0-127).
+func unpackScriptChannel(b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple, names ...string) (uint8, []uint8, error) {
+	values := make([]int, len(names))
+	pairs := make([]any, 0, 2*len(names))
+
+	for i, name := range names {
+		pairs = append(pairs, name, &values[i])
+	}
+
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, pairs...); err != nil {
+		return 0, nil, err
+	}
+
+	if values[0] < 1 || values[0] > 16 {
+		return 0, nil, fmt.Errorf("%v: invalid MIDI channel: %v", b.Name(), values[0])
+	}
+
+	var data []uint8
+
+	for i, v := range values[1:] {
+		if v < 0 || v > 127 {
+			return 0, nil, fmt.Errorf("%v: invalid %v: %v", b.Name(), names[i+1], v)
+		}
+
+		data = append(data, uint8(v))
+	}
+
+	return uint8(values[0] - 1), data, nil
+}
+
+// scriptNoteOn implements note_on(channel, key, velocity).
+func scriptNoteOn(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	channel, data, err := unpackScriptChannel(b, args, kwargs, "channel", "key", "velocity")
+
+	if err != nil {
+		return nil, err
+	}
+
+	return scriptMessage{msg: midi.NoteOn(channel, data[0], data[1])}, nil
+}
+
+// scriptNoteOff implements note_off(channel, key).
+func scriptNoteOff(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	channel, data, err := unpackScriptChannel(b, args, kwargs, "channel", "key")
+
+	if err != nil {
+		return nil, err
+	}
+
+	return scriptMessage{msg: midi.NoteOff(channel, data[0])}, nil
+}
+
+// scriptControlChange implements control_change(channel, controller, value).
+func scriptControlChange(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	channel, data, err := unpackScriptChannel(b, args, kwargs, "channel", "controller", "value")
+
+	if err != nil {
+		return nil, err
+	}
+
+	return scriptMessage{msg: midi.ControlChange(channel, data[0], data[1])}, nil
+}
+
+// scriptAfter implements after(delay, msg).
+func scriptAfter(_ *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var s string
+	var msg scriptMessage
+
+	if err := starlark.UnpackPositionalArgs(b.Name(), args, kwargs, 2, &s, &msg); err != nil {
+		return nil, err
+	}
+
+	delay, err := time.ParseDuration(s)
+
+	if err != nil || delay < 0 || delay > ScriptMaxDelay {
+		return nil, fmt.Errorf("%v: invalid delay: %v", b.Name(), s)
+	}
+
+	return scriptDelayed{output: ScriptOutput{Delay: delay, Message: msg.msg}}, nil
+}
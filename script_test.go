@@ -0,0 +1,229 @@
+package octane_test
+
+import (
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/mcandre/octane"
+	"gitlab.com/gomidi/midi/v2"
+	"gitlab.com/gomidi/midi/v2/drivers"
+)
+
+func TestScriptRun(t *testing.T) {
+	script, err := octane.ParseScript(`
+# Double low notes an octave up, with a quieter echo.
+state["count"] = 0
+
+def on_message(msg, port, time):
+    if msg.type == "note_on" and msg.key < 36 and port == "KeyStep":
+        state["count"] += 1
+        return [
+            note_on(msg.channel, msg.key + 12, msg.velocity),
+            after("250ms", note_on(msg.channel, msg.key + 12, msg.velocity // 2)),
+        ]
+
+    if msg.type == "control_change":
+        if state["count"] >= 2:
+            return None
+
+        return after("10ms", msg)
+
+    if msg.type == "program_change":
+        return control_change(msg.channel, 1, time % 1000 // 10)
+
+    return msg
+`)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	at := time.UnixMilli(1234)
+	outputs, err := script.Run("KeyStep", midi.NoteOn(0, 24, 100), at)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []octane.ScriptOutput{
+		{Message: midi.NoteOn(0, 36, 100)},
+		{Delay: 250 * time.Millisecond, Message: midi.NoteOn(0, 36, 50)},
+	}
+
+	if len(outputs) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, outputs)
+	}
+
+	for i, output := range expected {
+		if outputs[i].Delay != output.Delay || outputs[i].Message.String() != output.Message.String() {
+			t.Errorf("expected %v, got %v", output, outputs[i])
+		}
+	}
+
+	// Other ports and other messages pass unchanged.
+	for _, port := range []string{"nanoKEY", "KeyStep"} {
+		msg := midi.NoteOn(0, 60, 100)
+
+		if port == "nanoKEY" {
+			msg = midi.NoteOn(0, 24, 100)
+		}
+
+		outputs, err = script.Run(port, msg, at)
+
+		if err != nil || len(outputs) != 1 || outputs[0].Message.String() != msg.String() {
+			t.Errorf("expected %v to pass from %v, got %v (%v)", msg, port, outputs, err)
+		}
+	}
+
+	if outputs, err = script.Run("KeyStep", midi.ProgramChange(0, 5), at); err != nil || len(outputs) != 1 || outputs[0].Message.String() != midi.ControlChange(0, 1, 23).String() {
+		t.Errorf("expected the message time to reach the script, got %v (%v)", outputs, err)
+	}
+
+	if outputs, err = script.Run("KeyStep", midi.ControlChange(0, 1, 64), at); err != nil || len(outputs) != 1 || outputs[0].Delay != 10*time.Millisecond {
+		t.Errorf("expected delayed control change, got %v (%v)", outputs, err)
+	}
+
+	if _, err = script.Run("KeyStep", midi.NoteOn(0, 24, 100), at); err != nil {
+		t.Fatal(err)
+	}
+
+	if outputs, err = script.Run("KeyStep", midi.ControlChange(0, 1, 64), at); err != nil || len(outputs) != 0 {
+		t.Errorf("expected state to drop control change, got %v (%v)", outputs, err)
+	}
+
+	if err = script.Reset(); err != nil {
+		t.Fatal(err)
+	}
+
+	if outputs, err = script.Run("KeyStep", midi.ControlChange(0, 1, 64), at); err != nil || len(outputs) != 1 {
+		t.Errorf("expected reset state to pass control change, got %v (%v)", outputs, err)
+	}
+}
+
+func TestScriptSandbox(t *testing.T) {
+	script, err := octane.ParseScript(`
+def on_message(msg, port, time):
+    if msg.type == "note_on":
+        return note_on(1, msg.key + 100, msg.velocity)
+
+    if msg.type == "control_change":
+        return note_on(1, msg.velocity + 1, 100)
+
+    if msg.type == "program_change":
+        for i in range(100000000):
+            pass
+
+    if msg.type == "after_touch":
+        return [msg] * 65
+
+    if msg.type == "pitch_bend":
+        return msg.bend
+
+    return message("note_of ch1 C4 100")
+`)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, msg := range []midi.Message{
+		midi.NoteOn(0, 60, 100),
+		midi.ControlChange(0, 1, 64),
+		midi.ProgramChange(0, 1),
+		midi.AfterTouch(0, 64),
+		midi.Pitchbend(0, 100),
+		midi.PolyAfterTouch(0, 60, 64),
+	} {
+		if _, err2 := script.Run("", msg, time.Now()); err2 == nil {
+			t.Errorf("expected error for %v", msg)
+		}
+	}
+
+	if outputs, err2 := script.Run("", midi.NoteOn(0, 20, 100), time.Now()); err2 != nil || len(outputs) != 1 {
+		t.Errorf("expected script to recover, got %v (%v)", outputs, err2)
+	}
+
+	handler := "def on_message(msg, port, time):\n    return "
+
+	for _, src := range []string{
+		"",
+		"def on_message(msg):\n    return msg",
+		"def on_message(msg, port, time):\nreturn msg",
+		"on_message = 1",
+		handler + "bogus",
+		handler + "msg\nwhile True:\n    pass",
+		handler + "msg\nload(\"os.star\", \"system\")",
+		handler + "msg\nafter(\"2h\", message(\"note_on ch1 C4 100\"))",
+		handler + "msg\nnote_on(17, 60, 100)",
+		handler + "msg\nmessage([60, 100])",
+	} {
+		if _, err2 := octane.ParseScript(src); err2 == nil {
+			t.Errorf("expected error for %q", src)
+		}
+	}
+
+	// Messages compare by bytes.
+	equality, err := octane.ParseScript(handler + "[m for m in [msg] if m == message([0x90, 60, 100])]")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for key, count := range map[uint8]int{60: 1, 62: 0} {
+		if outputs, err2 := equality.Run("", midi.NoteOn(0, key, 100), time.Now()); err2 != nil || len(outputs) != count {
+			t.Errorf("expected %v outputs for key %v, got %v (%v)", count, key, outputs, err2)
+		}
+	}
+}
+
+func TestEngineScript(t *testing.T) {
+	pth := path.Join(t.TempDir(), "echo.star")
+
+	if err := os.WriteFile(pth, []byte(`
+def on_message(msg, port, time):
+    if msg.type == "note_on":
+        return [msg, after("20ms", note_on(msg.channel, msg.key + 12, msg.velocity))]
+
+    return msg
+`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	out := &fakeOut{name: "synth"}
+	engine, err := octane.NewEngine(octane.Config{Script: pth}, []drivers.Out{out})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	engine.Process(midi.NoteOn(0, 60, 100), false, true)
+	deadline := time.Now().Add(time.Second)
+
+	for engine.Status().Routes[0].Sent < 2 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	if expected := []midi.Message{midi.NoteOn(0, 60, 100), midi.NoteOn(0, 72, 100)}; engine.Status().Routes[0].Sent != 2 || !equalMessages(out.sent, expected) {
+		t.Errorf("expected %v, got %v", expected, out.sent)
+	}
+
+	// Reloading discards scheduled messages.
+	engine.Process(midi.NoteOn(0, 62, 100), false, true)
+
+	if err2 := engine.Reload(octane.Config{Script: pth}); err2 != nil {
+		t.Fatal(err2)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+
+	// Reloading releases the three sounding notes.
+	if sent := engine.Status().Routes[0].Sent; sent != 6 {
+		t.Errorf("expected the pending echo to be discarded, leaving 6 messages sent, got %v", sent)
+	}
+
+	if err2 := engine.Reload(octane.Config{Script: path.Join(t.TempDir(), "missing.star")}); err2 == nil {
+		t.Errorf("expected error for missing script")
+	}
+}
@@ -0,0 +1,157 @@
+package octane
+
+import (
+	"fmt"
+	"os"
+	"sync"
+
+	"gitlab.com/gomidi/midi/v2/drivers"
+)
+
+// DefaultSerialBaud denotes the MIDI DIN baud rate.
+const DefaultSerialBaud = 31250
+
+// SerialEndpoint declares a pseudo-port carrying MIDI bytes over a serial tty,
+// such as a serial-to-DIN interface or a USB-serial bridge.
+type SerialEndpoint struct {
+	// Name identifies the pseudo-port, for selection as a MIDI IN or MIDI OUT device.
+	Name string `json:"name"`
+
+	// Device denotes the tty path, such as /dev/ttyUSB0.
+	Device string `json:"device"`
+
+	// Baud denotes the baud rate. Default 31250.
+	// USB-serial bridges like Hairless MIDI commonly use 115200.
+	Baud int `json:"baud,omitempty"`
+}
+
+// Validate checks the endpoint for errors.
+func (o SerialEndpoint) Validate() error {
+	if o.Name == "" {
+		return fmt.Errorf("serial endpoint requires a name")
+	}
+
+	if o.Device == "" {
+		return fmt.Errorf("serial endpoint %v requires a device", o.Name)
+	}
+
+	if o.Baud < 0 {
+		return fmt.Errorf("serial endpoint %v has a negative baud rate", o.Name)
+	}
+
+	return nil
+}
+
+// SerialPort presents a serial tty as a MIDI IN and MIDI OUT device.
+// Incoming bytes are framed into messages with running status.
+// SerialPort implements drivers.In and drivers.Out.
+type SerialPort struct {
+	mutex sync.Mutex
+
+	endpoint SerialEndpoint
+
+	number int
+
+	file *os.File
+
+	listener streamListener
+}
+
+// NewSerialPort prepares a serial pseudo-port.
+// number distinguishes the port from other pseudo-ports.
+func NewSerialPort(endpoint SerialEndpoint, number int) *SerialPort {
+	return &SerialPort{endpoint: endpoint, number: number}
+}
+
+// Open configures the tty for raw bytes at the baud rate.
+func (o *SerialPort) Open() error {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	if o.file != nil {
+		return nil
+	}
+
+	baud := o.endpoint.Baud
+
+	if baud == 0 {
+		baud = DefaultSerialBaud
+	}
+
+	file, err := openSerial(o.endpoint.Device, baud)
+
+	if err != nil {
+		return err
+	}
+
+	o.file = file
+	go o.listener.receive(file)
+	return nil
+}
+
+// Close releases the tty.
+func (o *SerialPort) Close() error {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	if o.file == nil {
+		return nil
+	}
+
+	err := o.file.Close()
+	o.file = nil
+	return err
+}
+
+// IsOpen reports whether the tty is open.
+func (o *SerialPort) IsOpen() bool {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	return o.file != nil
+}
+
+// Number distinguishes the port from other pseudo-ports.
+func (o *SerialPort) Number() int { return o.number }
+
+// String names the port.
+func (o *SerialPort) String() string { return o.endpoint.Name }
+
+// Underlying exposes the endpoint settings.
+func (o *SerialPort) Underlying() interface{} { return o.endpoint }
+
+// Listen begins delivering incoming messages.
+func (o *SerialPort) Listen(onMsg func([]byte, int32), config drivers.ListenConfig) (func(), error) {
+	if !o.IsOpen() {
+		return nil, drivers.ErrPortClosed
+	}
+
+	return o.listener.listen(onMsg, config), nil
+}
+
+// Send writes a message to the tty.
+func (o *SerialPort) Send(data []byte) error {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	if o.file == nil {
+		return drivers.ErrPortClosed
+	}
+
+	_, err := o.file.Write(data)
+	return err
+}
+
+// SerialPorts prepares pseudo-ports for the configured serial endpoints.
+// Each endpoint serves as both a MIDI IN and a MIDI OUT device.
+func (o Config) SerialPorts() ([]drivers.In, []drivers.Out) {
+	var ins []drivers.In
+	var outs []drivers.Out
+
+	for i, endpoint := range o.Serial {
+		port := NewSerialPort(endpoint, i)
+		ins = append(ins, port)
+		outs = append(outs, port)
+	}
+
+	return ins, outs
+}
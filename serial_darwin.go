@@ -0,0 +1,63 @@
+//go:build darwin
+
+package octane
+
+import (
+	"os"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// iossiospeed denotes the macOS ioctl for arbitrary baud rates, from IOKit/serial/ioss.h.
+const iossiospeed = 0x80085402
+
+// openSerial opens a tty for raw bytes,
+// applying arbitrary baud rates such as 31250 via IOSSIOSPEED.
+func openSerial(device string, baud int) (*os.File, error) {
+	file, err := os.OpenFile(device, os.O_RDWR|unix.O_NOCTTY, 0)
+
+	if err != nil {
+		return nil, err
+	}
+
+	raw, err := file.SyscallConn()
+
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+
+	var err2 error
+
+	err = raw.Control(func(fd uintptr) {
+		var t *unix.Termios
+
+		if t, err2 = unix.IoctlGetTermios(int(fd), unix.TIOCGETA); err2 != nil {
+			return
+		}
+
+		makeRaw(t)
+
+		if err2 = unix.IoctlSetTermios(int(fd), unix.TIOCSETA, t); err2 != nil {
+			return
+		}
+
+		speed := uint64(baud)
+
+		if _, _, errno := unix.Syscall(unix.SYS_IOCTL, fd, iossiospeed, uintptr(unsafe.Pointer(&speed))); errno != 0 {
+			err2 = errno
+		}
+	})
+
+	if err == nil {
+		err = err2
+	}
+
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+
+	return file, nil
+}
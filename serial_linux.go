@@ -0,0 +1,54 @@
+//go:build linux && !ppc && !ppc64 && !ppc64le
+
+package octane
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// openSerial opens a tty for raw bytes,
+// applying arbitrary baud rates such as 31250 via termios2.
+func openSerial(device string, baud int) (*os.File, error) {
+	file, err := os.OpenFile(device, os.O_RDWR|unix.O_NOCTTY, 0)
+
+	if err != nil {
+		return nil, err
+	}
+
+	raw, err := file.SyscallConn()
+
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+
+	var err2 error
+
+	err = raw.Control(func(fd uintptr) {
+		var t *unix.Termios
+
+		if t, err2 = unix.IoctlGetTermios(int(fd), unix.TCGETS2); err2 != nil {
+			return
+		}
+
+		makeRaw(t)
+		t.Cflag &^= unix.CBAUD
+		t.Cflag |= unix.BOTHER
+		t.Ispeed = uint32(baud)
+		t.Ospeed = uint32(baud)
+		err2 = unix.IoctlSetTermios(int(fd), unix.TCSETS2, t)
+	})
+
+	if err == nil {
+		err = err2
+	}
+
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+
+	return file, nil
+}
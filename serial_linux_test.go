@@ -0,0 +1,87 @@
+//go:build linux && !ppc && !ppc64 && !ppc64le
+
+package octane_test
+
+import (
+	"io"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/mcandre/octane"
+	"gitlab.com/gomidi/midi/v2"
+	"golang.org/x/sys/unix"
+)
+
+// openPTY opens a pseudo-terminal pair, returning the controller and the device path.
+func openPTY(t *testing.T) (*os.File, string) {
+	controller, err := os.OpenFile("/dev/ptmx", os.O_RDWR|unix.O_NOCTTY, 0)
+
+	if err != nil {
+		t.Skip(err)
+	}
+
+	fd := int(controller.Fd())
+
+	if err2 := unix.IoctlSetPointerInt(fd, unix.TIOCSPTLCK, 0); err2 != nil {
+		t.Fatal(err2)
+	}
+
+	n, err := unix.IoctlGetInt(fd, unix.TIOCGPTN)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return controller, "/dev/pts/" + strconv.Itoa(n)
+}
+
+func TestSerialPort(t *testing.T) {
+	controller, device := openPTY(t)
+	defer controller.Close()
+
+	port := octane.NewSerialPort(octane.SerialEndpoint{Name: "din", Device: device}, 0)
+	received := make(chan midi.Message, 2)
+
+	stop, err := midi.ListenTo(port, func(msg midi.Message, _ int32) {
+		received <- msg
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer port.Close()
+	defer stop()
+
+	// Running status carries the second note off.
+	if _, err2 := controller.Write([]byte{0x80, 60, 0, 62, 0}); err2 != nil {
+		t.Fatal(err2)
+	}
+
+	for _, expected := range []midi.Message{midi.NoteOff(0, 60), midi.NoteOff(0, 62)} {
+		select {
+		case msg := <-received:
+			if msg.String() != expected.String() {
+				t.Errorf("expected %v, got %v", expected, msg)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("expected %v", expected)
+		}
+	}
+
+	if err2 := port.Send(midi.ControlChange(0, 7, 100)); err2 != nil {
+		t.Fatal(err2)
+	}
+
+	buf := make([]byte, 3)
+
+	if _, err2 := io.ReadFull(controller, buf); err2 != nil {
+		t.Fatal(err2)
+	}
+
+	if midi.Message(buf).String() != midi.ControlChange(0, 7, 100).String() {
+		t.Errorf("expected %v, got % X", midi.ControlChange(0, 7, 100), buf)
+	}
+}
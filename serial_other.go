@@ -0,0 +1,14 @@
+//go:build !darwin && (!linux || ppc || ppc64 || ppc64le)
+
+package octane
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+)
+
+// openSerial reports that serial pseudo-ports are unsupported on this platform.
+func openSerial(device string, _ int) (*os.File, error) {
+	return nil, fmt.Errorf("serial ports unsupported on %v/%v: %v", runtime.GOOS, runtime.GOARCH, device)
+}
@@ -0,0 +1,396 @@
+package octane
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"slices"
+	"sync"
+	"time"
+
+	"gitlab.com/gomidi/midi/v2/drivers"
+)
+
+// SocketWriteTimeout denotes how long a stream connection may stall a send before being dropped.
+const SocketWriteTimeout = 100 * time.Millisecond
+
+// SocketMaxSenders denotes how many datagram senders keep their own running status.
+// The least recently heard sender is forgotten first.
+const SocketMaxSenders = 64
+
+// SocketEndpoint declares a pseudo-port carrying raw MIDI bytes over a network socket.
+type SocketEndpoint struct {
+	// Name identifies the pseudo-port, for selection as a MIDI IN or MIDI OUT device.
+	Name string `json:"name"`
+
+	// Network denotes tcp, udp, or unix (stream sockets).
+	Network string `json:"network"`
+
+	// Listen denotes a local address (or socket path) to accept connections or datagrams.
+	Listen string `json:"listen,omitempty"`
+
+	// Connect denotes a remote address (or socket path) to connect or send datagrams to.
+	Connect string `json:"connect,omitempty"`
+}
+
+// Validate checks the endpoint for errors.
+func (o SocketEndpoint) Validate() error {
+	if o.Name == "" {
+		return fmt.Errorf("socket endpoint requires a name")
+	}
+
+	switch o.Network {
+	case "tcp", "unix":
+		if (o.Listen == "") == (o.Connect == "") {
+			return fmt.Errorf("socket endpoint %v requires exactly one of listen or connect", o.Name)
+		}
+	case "udp":
+		if o.Listen == "" && o.Connect == "" {
+			return fmt.Errorf("socket endpoint %v requires a listen or connect address", o.Name)
+		}
+	default:
+		return fmt.Errorf("unsupported socket network: %v", o.Network)
+	}
+
+	return nil
+}
+
+// streamListener frames incoming bytes into messages for the current listener.
+type streamListener struct {
+	mutex sync.Mutex
+
+	config drivers.ListenConfig
+
+	onMsg func([]byte, int32)
+}
+
+// listen begins delivering messages, returning a function to stop.
+func (o *streamListener) listen(onMsg func([]byte, int32), config drivers.ListenConfig) func() {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	o.onMsg = onMsg
+	o.config = config
+
+	return func() {
+		o.mutex.Lock()
+		defer o.mutex.Unlock()
+		o.onMsg = nil
+	}
+}
+
+// reader prepares a running status parser delivering to the current listener.
+func (o *streamListener) reader() *drivers.Reader {
+	o.mutex.Lock()
+	config := o.config
+	o.mutex.Unlock()
+
+	return drivers.NewReader(config, func(bs []byte, ms int32) {
+		o.mutex.Lock()
+		onMsg := o.onMsg
+		o.mutex.Unlock()
+
+		if onMsg != nil {
+			onMsg(slices.Clone(bs), ms)
+		}
+	})
+}
+
+// receive frames bytes from a stream until it ends.
+func (o *streamListener) receive(r io.Reader) {
+	var reader *drivers.Reader
+	buf := make([]byte, 4096)
+
+	for {
+		n, err := r.Read(buf)
+
+		if n > 0 {
+			// Streams may precede listening, so settle listen options at the first byte.
+			if reader == nil {
+				reader = o.reader()
+			}
+
+			reader.EachMessage(buf[:n], 0)
+		}
+
+		if err != nil {
+			return
+		}
+	}
+}
+
+// SocketPort presents a network socket as a MIDI IN and MIDI OUT device.
+// Incoming bytes are framed into messages with running status,
+// per connection or per datagram sender.
+// SocketPort implements drivers.In and drivers.Out.
+type SocketPort struct {
+	mutex sync.Mutex
+
+	endpoint SocketEndpoint
+
+	number int
+
+	open bool
+
+	server net.Listener
+
+	packet net.PacketConn
+
+	remote net.Addr
+
+	conns []net.Conn
+
+	listener streamListener
+}
+
+// NewSocketPort prepares a socket pseudo-port.
+// number distinguishes the port from other pseudo-ports.
+func NewSocketPort(endpoint SocketEndpoint, number int) *SocketPort {
+	return &SocketPort{endpoint: endpoint, number: number}
+}
+
+// Open listens, binds, or connects the socket.
+func (o *SocketPort) Open() error {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	if o.open {
+		return nil
+	}
+
+	switch {
+	case o.endpoint.Network == "udp":
+		var err error
+
+		if o.endpoint.Connect != "" {
+			if o.remote, err = net.ResolveUDPAddr("udp", o.endpoint.Connect); err != nil {
+				return err
+			}
+		}
+
+		if o.packet, err = net.ListenPacket("udp", o.endpoint.Listen); err != nil {
+			return err
+		}
+
+		go o.receivePackets(o.packet)
+	case o.endpoint.Listen != "":
+		listener, err := net.Listen(o.endpoint.Network, o.endpoint.Listen)
+
+		if err != nil {
+			return err
+		}
+
+		o.server = listener
+		go o.accept(listener)
+	default:
+		conn, err := net.Dial(o.endpoint.Network, o.endpoint.Connect)
+
+		if err != nil {
+			return err
+		}
+
+		o.conns = append(o.conns, conn)
+		go o.receive(conn)
+	}
+
+	o.open = true
+	return nil
+}
+
+// accept serves stream connections until the listener closes.
+func (o *SocketPort) accept(listener net.Listener) {
+	for {
+		conn, err := listener.Accept()
+
+		if err != nil {
+			return
+		}
+
+		o.mutex.Lock()
+		o.conns = append(o.conns, conn)
+		o.mutex.Unlock()
+		go o.receive(conn)
+	}
+}
+
+// receive frames bytes from a stream connection until it closes.
+func (o *SocketPort) receive(conn net.Conn) {
+	defer o.drop(conn)
+	o.listener.receive(conn)
+}
+
+// packetSender tracks the running status of a datagram sender.
+type packetSender struct {
+	reader *drivers.Reader
+
+	heard int
+}
+
+// receivePackets frames bytes from datagrams until the socket closes.
+func (o *SocketPort) receivePackets(packet net.PacketConn) {
+	senders := map[string]*packetSender{}
+	buf := make([]byte, 65535)
+
+	for heard := 0; ; heard++ {
+		n, addr, err := packet.ReadFrom(buf)
+
+		if err != nil {
+			return
+		}
+
+		sender, ok := senders[addr.String()]
+
+		if !ok {
+			if len(senders) >= SocketMaxSenders {
+				var idle string
+
+				for key, s := range senders {
+					if idle == "" || s.heard < senders[idle].heard {
+						idle = key
+					}
+				}
+
+				delete(senders, idle)
+			}
+
+			sender = &packetSender{reader: o.listener.reader()}
+			senders[addr.String()] = sender
+		}
+
+		sender.heard = heard
+
+		o.mutex.Lock()
+
+		if o.endpoint.Connect == "" {
+			o.remote = addr
+		}
+
+		o.mutex.Unlock()
+		sender.reader.EachMessage(buf[:n], 0)
+	}
+}
+
+// drop forgets a closed stream connection.
+func (o *SocketPort) drop(conn net.Conn) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	o.conns = slices.DeleteFunc(o.conns, func(c net.Conn) bool { return c == conn })
+	_ = conn.Close()
+}
+
+// Close releases the socket and its connections.
+func (o *SocketPort) Close() error {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	if !o.open {
+		return nil
+	}
+
+	var err error
+
+	if o.server != nil {
+		err = o.server.Close()
+		o.server = nil
+	}
+
+	if o.packet != nil {
+		err = o.packet.Close()
+		o.packet = nil
+	}
+
+	for _, conn := range o.conns {
+		if err2 := conn.Close(); err == nil {
+			err = err2
+		}
+	}
+
+	o.conns = nil
+	o.open = false
+	return err
+}
+
+// IsOpen reports whether the socket is open.
+func (o *SocketPort) IsOpen() bool {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	return o.open
+}
+
+// Number distinguishes the port from other pseudo-ports.
+func (o *SocketPort) Number() int { return o.number }
+
+// String names the port.
+func (o *SocketPort) String() string { return o.endpoint.Name }
+
+// Underlying exposes the endpoint settings.
+func (o *SocketPort) Underlying() interface{} { return o.endpoint }
+
+// Listen begins delivering incoming messages.
+func (o *SocketPort) Listen(onMsg func([]byte, int32), config drivers.ListenConfig) (func(), error) {
+	if !o.IsOpen() {
+		return nil, drivers.ErrPortClosed
+	}
+
+	return o.listener.listen(onMsg, config), nil
+}
+
+// Send writes a message to every connection, or to the datagram peer.
+// Datagram endpoints without a connect address reply to the latest sender.
+//
+// Connections failing to accept the message within SocketWriteTimeout are closed and dropped,
+// while the rest still receive it. Send reports the first failure.
+func (o *SocketPort) Send(data []byte) error {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	if !o.open {
+		return drivers.ErrPortClosed
+	}
+
+	if o.packet != nil {
+		if o.remote == nil {
+			return nil
+		}
+
+		_, err := o.packet.WriteTo(data, o.remote)
+		return err
+	}
+
+	var err error
+
+	o.conns = slices.DeleteFunc(o.conns, func(conn net.Conn) bool {
+		err2 := conn.SetWriteDeadline(time.Now().Add(SocketWriteTimeout))
+
+		if err2 == nil {
+			_, err2 = conn.Write(data)
+		}
+
+		if err2 == nil {
+			return false
+		}
+
+		if err == nil {
+			err = err2
+		}
+
+		_ = conn.Close()
+		return true
+	})
+
+	return err
+}
+
+// SocketPorts prepares pseudo-ports for the configured socket endpoints.
+// Each endpoint serves as both a MIDI IN and a MIDI OUT device.
+func (o Config) SocketPorts() ([]drivers.In, []drivers.Out) {
+	var ins []drivers.In
+	var outs []drivers.Out
+
+	for i, endpoint := range o.Sockets {
+		port := NewSocketPort(endpoint, i)
+		ins = append(ins, port)
+		outs = append(outs, port)
+	}
+
+	return ins, outs
+}
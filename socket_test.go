@@ -0,0 +1,251 @@
+package octane_test
+
+import (
+	"io"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mcandre/octane"
+	"gitlab.com/gomidi/midi/v2"
+)
+
+// freeAddress reserves a loopback address for the network.
+func freeAddress(t *testing.T, network string) string {
+	var addr string
+
+	switch network {
+	case "tcp":
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		addr = listener.Addr().String()
+
+		if err2 := listener.Close(); err2 != nil {
+			t.Fatal(err2)
+		}
+	case "udp":
+		packet, err := net.ListenPacket("udp", "127.0.0.1:0")
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		addr = packet.LocalAddr().String()
+
+		if err2 := packet.Close(); err2 != nil {
+			t.Fatal(err2)
+		}
+	default:
+		addr = filepath.Join(t.TempDir(), "octane.sock")
+	}
+
+	return addr
+}
+
+func TestSocketPort(t *testing.T) {
+	for _, network := range []string{"tcp", "udp", "unix"} {
+		t.Run(network, func(t *testing.T) {
+			addr := freeAddress(t, network)
+			server := octane.NewSocketPort(octane.SocketEndpoint{Name: "server", Network: network, Listen: addr}, 0)
+			client := octane.NewSocketPort(octane.SocketEndpoint{Name: "client", Network: network, Connect: addr}, 1)
+
+			received := make(chan midi.Message, 4)
+
+			stop, err := midi.ListenTo(server, func(msg midi.Message, _ int32) {
+				received <- msg
+			})
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			defer server.Close()
+			defer stop()
+
+			if err2 := client.Open(); err2 != nil {
+				t.Fatal(err2)
+			}
+
+			defer client.Close()
+
+			// Running status carries the second note on.
+			if err2 := client.Send([]byte{0x90, 60, 100, 62, 100}); err2 != nil {
+				t.Fatal(err2)
+			}
+
+			for _, expected := range []midi.Message{midi.NoteOn(0, 60, 100), midi.NoteOn(0, 62, 100)} {
+				select {
+				case msg := <-received:
+					if msg.String() != expected.String() {
+						t.Errorf("expected %v, got %v", expected, msg)
+					}
+				case <-time.After(time.Second):
+					t.Fatalf("expected %v", expected)
+				}
+			}
+		})
+	}
+
+	if err := (octane.SocketEndpoint{Name: "pipe", Network: "tcp", Listen: ":9000", Connect: "host:9000"}).Validate(); err == nil {
+		t.Errorf("expected error for listen and connect stream")
+	}
+}
+
+func TestSocketPortStalledClient(t *testing.T) {
+	addr := freeAddress(t, "tcp")
+	server := octane.NewSocketPort(octane.SocketEndpoint{Name: "server", Network: "tcp", Listen: addr}, 0)
+
+	if err := server.Open(); err != nil {
+		t.Fatal(err)
+	}
+
+	defer server.Close()
+
+	// The stalled client never reads.
+	stalled, err := net.Dial("tcp", addr)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer stalled.Close()
+
+	healthy, err := net.Dial("tcp", addr)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer healthy.Close()
+	received := make(chan int64)
+
+	go func() {
+		n, _ := io.Copy(io.Discard, healthy)
+		received <- n
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	sysEx := make([]byte, 1<<16)
+	sysEx[0] = 0xF0
+	sysEx[len(sysEx)-1] = 0xF7
+	var failures int
+	sends := 256
+
+	for range sends {
+		if err2 := server.Send(sysEx); err2 != nil {
+			failures++
+		}
+	}
+
+	if failures != 1 {
+		t.Errorf("expected the stalled client to fail once, got %v failures", failures)
+	}
+
+	if err2 := server.Close(); err2 != nil {
+		t.Fatal(err2)
+	}
+
+	if n := <-received; n != int64(sends*len(sysEx)) {
+		t.Errorf("expected the healthy client to receive %v bytes, got %v", sends*len(sysEx), n)
+	}
+}
+
+func TestSocketPortDatagramSenders(t *testing.T) {
+	addr := freeAddress(t, "udp")
+	server := octane.NewSocketPort(octane.SocketEndpoint{Name: "server", Network: "udp", Listen: addr}, 0)
+	received := make(chan midi.Message, 4)
+
+	stop, err := midi.ListenTo(server, func(msg midi.Message, _ int32) {
+		received <- msg
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer server.Close()
+	defer stop()
+	var senders []net.Conn
+
+	for range 2 {
+		conn, err2 := net.Dial("udp", addr)
+
+		if err2 != nil {
+			t.Fatal(err2)
+		}
+
+		defer conn.Close()
+		senders = append(senders, conn)
+	}
+
+	// Running status belongs to each sender, so the second sender's bare data bytes are dropped.
+	for _, packet := range []struct {
+		sender int
+		bytes  []byte
+	}{
+		{0, []byte{0x90, 60, 100}},
+		{1, []byte{62, 100}},
+		{0, []byte{64, 100}},
+	} {
+		if _, err2 := senders[packet.sender].Write(packet.bytes); err2 != nil {
+			t.Fatal(err2)
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	for _, expected := range []midi.Message{midi.NoteOn(0, 60, 100), midi.NoteOn(0, 64, 100)} {
+		select {
+		case msg := <-received:
+			if msg.String() != expected.String() {
+				t.Errorf("expected %v, got %v", expected, msg)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("expected %v", expected)
+		}
+	}
+
+	select {
+	case msg := <-received:
+		t.Errorf("expected no more messages, got %v", msg)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// Enough newer senders make the server forget the first sender's running status.
+	for range octane.SocketMaxSenders {
+		conn, err2 := net.Dial("udp", addr)
+
+		if err2 != nil {
+			t.Fatal(err2)
+		}
+
+		defer conn.Close()
+
+		if _, err2 = conn.Write([]byte{0xB0, 1, 1}); err2 != nil {
+			t.Fatal(err2)
+		}
+	}
+
+	for range octane.SocketMaxSenders {
+		select {
+		case <-received:
+		case <-time.After(time.Second):
+			t.Fatalf("expected a control change from each sender")
+		}
+	}
+
+	if _, err2 := senders[0].Write([]byte{66, 100}); err2 != nil {
+		t.Fatal(err2)
+	}
+
+	select {
+	case msg := <-received:
+		t.Errorf("expected forgotten running status to drop data bytes, got %v", msg)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
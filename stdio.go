@@ -0,0 +1,217 @@
+package octane
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"gitlab.com/gomidi/midi/v2"
+	"gitlab.com/gomidi/midi/v2/drivers"
+)
+
+// StdioName selects standard input or standard output in place of a MIDI device name.
+const StdioName = "-"
+
+// StdioRaw streams MIDI bytes.
+const StdioRaw = "raw"
+
+// StdioHex streams one message per line, as hex bytes like "90 3C 64".
+const StdioHex = "hex"
+
+// StdioJSON streams one JSON object per line, like {"bytes": "90 3C 64"}.
+const StdioJSON = "json"
+
+// StdioText streams one message per line, in the text format like "480ms note_off ch1 C4".
+// Input waits for each line's offset, counted from the first line.
+const StdioText = "text"
+
+// StdioFormats collects the supported stdio formats.
+var StdioFormats = []string{StdioRaw, StdioHex, StdioJSON, StdioText}
+
+// StdioPort presents a byte stream, such as standard input and output, as a MIDI device.
+// StdioPort implements drivers.In and drivers.Out.
+type StdioPort struct {
+	mutex sync.Mutex
+
+	name string
+
+	format string
+
+	r io.Reader
+
+	w io.Writer
+
+	open bool
+
+	done chan struct{}
+
+	reading sync.Once
+
+	listener streamListener
+
+	recorder *TextRecorder
+}
+
+// NewStdioPort prepares a stream pseudo-port.
+// r or w may be nil, for an input-only or output-only stream.
+func NewStdioPort(name string, r io.Reader, w io.Writer, format string) (*StdioPort, error) {
+	switch format {
+	case StdioRaw, StdioHex, StdioJSON, StdioText:
+	default:
+		return nil, fmt.Errorf("unsupported stdio format: %v", format)
+	}
+
+	return &StdioPort{name: name, format: format, r: r, w: w, done: make(chan struct{}), recorder: NewTextRecorder(w)}, nil
+}
+
+// Open prepares the port.
+func (o *StdioPort) Open() error {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	o.open = true
+	return nil
+}
+
+// receive reads the input stream until it ends.
+func (o *StdioPort) receive() {
+	defer close(o.done)
+
+	if o.format == StdioRaw {
+		o.listener.receive(o.r)
+		return
+	}
+
+	o.receiveLines()
+}
+
+// receiveLines parses line-based input until the stream ends.
+// Malformed lines are skipped.
+func (o *StdioPort) receiveLines() {
+	scanner := bufio.NewScanner(o.r)
+	scanner.Buffer(nil, 1<<20)
+	var reader *drivers.Reader
+	var start time.Time
+
+	for scanner.Scan() {
+		offset, bs, err := o.decode(scanner.Text())
+
+		if err != nil || len(bs) == 0 {
+			continue
+		}
+
+		if start.IsZero() {
+			start = time.Now()
+		}
+
+		time.Sleep(time.Until(start.Add(offset)))
+
+		if reader == nil {
+			reader = o.listener.reader()
+		}
+
+		reader.EachMessage(bs, 0)
+	}
+}
+
+// decode reads the offset and bytes of a line.
+// Only the text format carries offsets.
+func (o *StdioPort) decode(line string) (time.Duration, []byte, error) {
+	switch o.format {
+	case StdioText:
+		offset, msg, err := ParseText(line)
+		return offset, msg, err
+	case StdioJSON:
+		var event MonitorEvent
+
+		if err := json.Unmarshal([]byte(line), &event); err != nil {
+			return 0, nil, err
+		}
+
+		line = event.Bytes
+	}
+
+	bs, _, err := ParseHexBytes(line, false)
+	return 0, bs, err
+}
+
+// Done signals the end of the input stream, once listening.
+func (o *StdioPort) Done() <-chan struct{} {
+	return o.done
+}
+
+// Close stops delivering messages. The underlying streams stay open.
+func (o *StdioPort) Close() error {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	o.open = false
+	return nil
+}
+
+// IsOpen reports whether the port is open.
+func (o *StdioPort) IsOpen() bool {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	return o.open
+}
+
+// Number distinguishes the port from other pseudo-ports.
+func (o *StdioPort) Number() int { return 0 }
+
+// String names the port.
+func (o *StdioPort) String() string { return o.name }
+
+// Underlying exposes the stream format.
+func (o *StdioPort) Underlying() interface{} { return o.format }
+
+// Listen begins delivering incoming messages.
+func (o *StdioPort) Listen(onMsg func([]byte, int32), config drivers.ListenConfig) (func(), error) {
+	if !o.IsOpen() {
+		return nil, drivers.ErrPortClosed
+	}
+
+	stop := o.listener.listen(onMsg, config)
+
+	// Begin reading only once listening, so that no input is lost.
+	if o.r != nil {
+		o.reading.Do(func() { go o.receive() })
+	}
+
+	return stop, nil
+}
+
+// Send writes a message to the output stream, if any.
+func (o *StdioPort) Send(data []byte) error {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	if !o.open {
+		return drivers.ErrPortClosed
+	}
+
+	if o.w == nil {
+		return nil
+	}
+
+	switch o.format {
+	case StdioHex:
+		_, err := fmt.Fprintf(o.w, "% X\n", data)
+		return err
+	case StdioJSON:
+		bs, err := json.Marshal(NewMonitorEvent(DirectionOut, o.name, midi.Message(data)))
+
+		if err != nil {
+			return err
+		}
+
+		_, err = fmt.Fprintf(o.w, "%s\n", bs)
+		return err
+	case StdioText:
+		return o.recorder.Write(midi.Message(data))
+	default:
+		_, err := o.w.Write(data)
+		return err
+	}
+}
@@ -0,0 +1,77 @@
+package octane_test
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/mcandre/octane"
+	"gitlab.com/gomidi/midi/v2"
+	"gitlab.com/gomidi/midi/v2/drivers"
+)
+
+func TestStdioPortFilter(t *testing.T) {
+	inputs := map[string]string{
+		octane.StdioRaw:  "\x90\x3C\x64\x3E\x64",
+		octane.StdioHex:  "90 3C 64\n\nnot hex\n3E 64\n",
+		octane.StdioJSON: "{\"bytes\": \"90 3C 64\"}\n{\"bytes\": \"90 3E 64\"}\n",
+		octane.StdioText: "# fixture\n0ms note_on ch1 C5 100\nnote_on\n20ms note_on ch1 62 100\n",
+	}
+
+	outputs := map[string]string{
+		octane.StdioRaw:  "\x90\x48\x64\x90\x4A\x64",
+		octane.StdioHex:  "90 48 64\n90 4A 64\n",
+		octane.StdioJSON: "{\"direction\":\"out\",\"port\":\"-\",\"message\":\"NoteOn channel: 0 key: 72 velocity: 100\",\"bytes\":\"90 48 64\"}\n{\"direction\":\"out\",\"port\":\"-\",\"message\":\"NoteOn channel: 0 key: 74 velocity: 100\",\"bytes\":\"90 4A 64\"}\n",
+		octane.StdioText: "ms note_on ch1 C6 100\nms note_on ch1 D6 100\n",
+	}
+
+	// Text offsets vary with scheduling.
+	offsets := regexp.MustCompile(`(?m)^[0-9]+`)
+
+	for _, format := range octane.StdioFormats {
+		var stdout bytes.Buffer
+		port, err := octane.NewStdioPort(octane.StdioName, strings.NewReader(inputs[format]), &stdout, format)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		engine, err := octane.NewEngine(octane.Config{TransposeNote: 12}, []drivers.Out{port})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err2 := engine.Listen(port); err2 != nil {
+			t.Fatal(err2)
+		}
+
+		<-port.Done()
+		output := stdout.String()
+
+		if format == octane.StdioText {
+			output = offsets.ReplaceAllString(output, "")
+		}
+
+		if output != outputs[format] {
+			t.Errorf("expected %q for %v, got %q", outputs[format], format, output)
+		}
+	}
+
+	if _, err := octane.NewStdioPort(octane.StdioName, nil, nil, "midi"); err == nil {
+		t.Errorf("expected error for unsupported format")
+	}
+}
+
+func TestStdioPortClosed(t *testing.T) {
+	port, err := octane.NewStdioPort(octane.StdioName, nil, &bytes.Buffer{}, octane.StdioRaw)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err2 := port.Send(midi.NoteOn(0, 60, 100)); err2 == nil {
+		t.Errorf("expected error sending to closed port")
+	}
+}
@@ -0,0 +1,247 @@
+package octane
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"gitlab.com/gomidi/midi/v2"
+)
+
+// DefaultSysExBufferSize denotes the default SysEx buffer size, in bytes.
+const DefaultSysExBufferSize = 1024
+
+// ParseHexBytes reads space separated hexadecimal bytes, such as "F0 43 10".
+//
+// When wildcards is true, "??" bytes are accepted, and reported in the mask as false.
+func ParseHexBytes(s string, wildcards bool) ([]byte, []bool, error) {
+	var bs []byte
+	var mask []bool
+
+	for _, field := range strings.Fields(s) {
+		if wildcards && field == "??" {
+			bs = append(bs, 0)
+			mask = append(mask, false)
+			continue
+		}
+
+		b, err := hex.DecodeString(field)
+
+		if err != nil || len(b) != 1 {
+			return nil, nil, fmt.Errorf("invalid hex byte: %v", field)
+		}
+
+		bs = append(bs, b[0])
+		mask = append(mask, true)
+	}
+
+	return bs, mask, nil
+}
+
+// ManufacturerID extracts the one or three byte manufacturer ID of a SysEx message.
+// Universal non-realtime (7E) and realtime (7F) messages report their single byte ID.
+func ManufacturerID(msg midi.Message) []byte {
+	if len(msg) < 2 || msg[0] != 0xF0 {
+		return nil
+	}
+
+	if msg[1] == 0x00 && len(msg) >= 4 {
+		return msg[1:4]
+	}
+
+	return msg[1:2]
+}
+
+// SysExRewrite overwrites bytes of matching SysEx messages.
+type SysExRewrite struct {
+	// Match denotes a prefix pattern of space separated hex bytes, including F0.
+	// "??" matches any byte.
+	Match string `json:"match"`
+
+	// Replace denotes the replacement prefix, of the same length as Match.
+	// "??" preserves the original byte.
+	// Replacements begin with F0 or "??", followed by data bytes (00-7F).
+	Replace string `json:"replace"`
+}
+
+// Validate checks the rule for malformed patterns.
+func (o SysExRewrite) Validate() error {
+	match, _, err := ParseHexBytes(o.Match, true)
+
+	if err != nil {
+		return err
+	}
+
+	replace, mask, err := ParseHexBytes(o.Replace, true)
+
+	if err != nil {
+		return err
+	}
+
+	if len(match) != len(replace) {
+		return fmt.Errorf("SysEx rewrite requires equal length match and replace patterns: %v / %v", o.Match, o.Replace)
+	}
+
+	// Replacements keep the leading F0, and data bytes after it, so that messages stay well formed.
+	for i, b := range replace {
+		if !mask[i] {
+			continue
+		}
+
+		if i == 0 && b != 0xF0 {
+			return fmt.Errorf("SysEx rewrite must begin with F0 or ??: %v", o.Replace)
+		}
+
+		if i > 0 && b >= 0x80 {
+			return fmt.Errorf("SysEx rewrite replaces data with status byte %02X: %v", b, o.Replace)
+		}
+	}
+
+	return nil
+}
+
+// SysEx configures SysEx forwarding.
+type SysEx struct {
+	// BufferSize denotes the largest SysEx message accepted, in bytes.
+	// Zero selects DefaultSysExBufferSize.
+	BufferSize uint32 `json:"bufferSize,omitempty"`
+
+	// Allow lists manufacturer IDs to forward, as hex bytes such as "43" or "00 20 29".
+	// When empty, all manufacturers not denied are forwarded.
+	Allow []string `json:"allow,omitempty"`
+
+	// Deny lists manufacturer IDs to drop, as hex bytes.
+	Deny []string `json:"deny,omitempty"`
+
+	// Rewrite collects byte pattern rewrite rules, applied in order.
+	Rewrite []SysExRewrite `json:"rewrite,omitempty"`
+}
+
+// Validate checks the settings for malformed IDs and patterns.
+func (o SysEx) Validate() error {
+	for _, id := range append(append([]string{}, o.Allow...), o.Deny...) {
+		bs, _, err := ParseHexBytes(id, false)
+
+		if err != nil {
+			return err
+		}
+
+		if len(bs) != 1 && len(bs) != 3 {
+			return fmt.Errorf("invalid SysEx manufacturer ID: %v", id)
+		}
+	}
+
+	for _, rewrite := range o.Rewrite {
+		if err := rewrite.Validate(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Options generates the MIDI IN listening options for SysEx.
+func (o SysEx) Options() []midi.Option {
+	bufferSize := o.BufferSize
+
+	if bufferSize == 0 {
+		bufferSize = DefaultSysExBufferSize
+	}
+
+	return []midi.Option{midi.UseSysEx(), midi.SysExBufferSize(bufferSize)}
+}
+
+// Transformer prepares a SysEx filter.
+// The settings are assumed valid.
+func (o SysEx) Transformer() Transformer {
+	var filter sysExFilter
+
+	for _, id := range o.Allow {
+		bs, _, _ := ParseHexBytes(id, false)
+		filter.allow = append(filter.allow, bs)
+	}
+
+	for _, id := range o.Deny {
+		bs, _, _ := ParseHexBytes(id, false)
+		filter.deny = append(filter.deny, bs)
+	}
+
+	for _, rewrite := range o.Rewrite {
+		var rule sysExRule
+		rule.match, rule.matchMask, _ = ParseHexBytes(rewrite.Match, true)
+		rule.replace, rule.replaceMask, _ = ParseHexBytes(rewrite.Replace, true)
+		filter.rules = append(filter.rules, rule)
+	}
+
+	return filter
+}
+
+// sysExRule models a parsed rewrite rule.
+type sysExRule struct {
+	match       []byte
+	matchMask   []bool
+	replace     []byte
+	replaceMask []bool
+}
+
+// apply rewrites msg in place when it matches.
+func (o sysExRule) apply(msg midi.Message) {
+	if len(msg) < len(o.match) {
+		return
+	}
+
+	for i, b := range o.match {
+		if o.matchMask[i] && msg[i] != b {
+			return
+		}
+	}
+
+	for i, b := range o.replace {
+		if o.replaceMask[i] {
+			msg[i] = b
+		}
+	}
+}
+
+// sysExFilter models parsed SysEx settings.
+type sysExFilter struct {
+	allow [][]byte
+	deny  [][]byte
+	rules []sysExRule
+}
+
+// listed reports whether a manufacturer ID occurs in a list of IDs.
+func listed(ids [][]byte, id []byte) bool {
+	for _, bs := range ids {
+		if bytes.Equal(bs, id) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Transform filters SysEx messages by manufacturer, and applies rewrite rules.
+func (o sysExFilter) Transform(msg midi.Message, emit func(midi.Message)) {
+	if !msg.Is(midi.SysExMsg) {
+		emit(msg)
+		return
+	}
+
+	id := ManufacturerID(msg)
+
+	if (len(o.allow) != 0 && !listed(o.allow, id)) || listed(o.deny, id) {
+		return
+	}
+
+	if len(o.rules) != 0 {
+		msg = bytes.Clone(msg)
+
+		for _, rule := range o.rules {
+			rule.apply(msg)
+		}
+	}
+
+	emit(msg)
+}
@@ -0,0 +1,59 @@
+package octane_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/mcandre/octane"
+	"gitlab.com/gomidi/midi/v2"
+)
+
+func TestSysExFilter(t *testing.T) {
+	sysEx := octane.SysEx{Allow: []string{"43", "00 20 29"}, Deny: []string{"00 20 29"}}
+
+	if err := sysEx.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	filter := sysEx.Transformer()
+	var got []midi.Message
+	emit := func(msg midi.Message) { got = append(got, msg) }
+
+	filter.Transform(midi.SysEx([]byte{0x43, 0x10, 0x01}), emit)
+	filter.Transform(midi.SysEx([]byte{0x00, 0x20, 0x29, 0x01}), emit)
+	filter.Transform(midi.SysEx([]byte{0x41, 0x10, 0x01}), emit)
+
+	if len(got) != 1 || octane.ManufacturerID(got[0])[0] != 0x43 {
+		t.Errorf("expected only Yamaha SysEx, got %v", got)
+	}
+}
+
+func TestSysExRewrite(t *testing.T) {
+	sysEx := octane.SysEx{Rewrite: []octane.SysExRewrite{{Match: "F0 43 10", Replace: "?? ?? 11"}}}
+
+	if err := sysEx.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	original := midi.SysEx([]byte{0x43, 0x10, 0x7F})
+	var got midi.Message
+	sysEx.Transformer().Transform(original, func(msg midi.Message) { got = msg })
+
+	if !bytes.Equal(got, []byte{0xF0, 0x43, 0x11, 0x7F, 0xF7}) {
+		t.Errorf("expected device ID rewrite, got % X", got)
+	}
+
+	if original[2] != 0x10 {
+		t.Errorf("expected original message to remain unchanged")
+	}
+
+	for _, rewrite := range []octane.SysExRewrite{
+		{Match: "F0 43", Replace: "F0"},
+		{Match: "F0 43 10", Replace: "?? 43 F7"},
+		{Match: "F0 43", Replace: "F1 43"},
+	} {
+		if err := rewrite.Validate(); err == nil {
+			t.Errorf("expected error for %v", rewrite)
+		}
+	}
+}
@@ -0,0 +1,392 @@
+package octane
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gitlab.com/gomidi/midi/v2"
+)
+
+// textTypes names message types in the text format.
+// Names follow midi.Type names, in snake case.
+var textTypes = map[midi.Type]string{
+	midi.NoteOnMsg:         "note_on",
+	midi.NoteOffMsg:        "note_off",
+	midi.ControlChangeMsg:  "control_change",
+	midi.PitchBendMsg:      "pitch_bend",
+	midi.AfterTouchMsg:     "after_touch",
+	midi.PolyAfterTouchMsg: "poly_after_touch",
+	midi.ProgramChangeMsg:  "program_change",
+	midi.SysExMsg:          "sysex",
+	midi.TimingClockMsg:    "timing_clock",
+	midi.TickMsg:           "tick",
+	midi.StartMsg:          "start",
+	midi.ContinueMsg:       "continue",
+	midi.StopMsg:           "stop",
+	midi.ActiveSenseMsg:    "active_sense",
+	midi.ResetMsg:          "reset",
+	midi.MTCMsg:            "mtc",
+	midi.SongSelectMsg:     "song_select",
+	midi.SPPMsg:            "spp",
+	midi.TuneMsg:           "tune",
+}
+
+// TextRaw names messages outside the text format vocabulary,
+// written as hex bytes like "raw F4".
+const TextRaw = "raw"
+
+// noteNames maps note letters to pitch classes.
+var noteNames = map[byte]int{'C': 0, 'D': 2, 'E': 4, 'F': 5, 'G': 7, 'A': 9, 'B': 11}
+
+// ParseNote reads a key as a note name like "C4", "C#4", or "Db4", or as a number (0-127).
+// Octaves follow midi.Note, where C0 denotes key 0.
+func ParseNote(s string) (uint8, error) {
+	if n, err := strconv.ParseUint(s, 10, 7); err == nil {
+		return uint8(n), nil
+	}
+
+	if s == "" {
+		return 0, fmt.Errorf("invalid note: %v", s)
+	}
+
+	class, ok := noteNames[strings.ToUpper(s[:1])[0]]
+
+	if !ok {
+		return 0, fmt.Errorf("invalid note: %v", s)
+	}
+
+	rest := s[1:]
+
+	switch {
+	case strings.HasPrefix(rest, "#"):
+		class++
+		rest = rest[1:]
+	case strings.HasPrefix(rest, "b"):
+		class--
+		rest = rest[1:]
+	}
+
+	octave, err := strconv.Atoi(rest)
+
+	if err != nil {
+		return 0, fmt.Errorf("invalid note: %v", s)
+	}
+
+	key := octave*12 + class
+
+	if key < 0 || key > 127 {
+		return 0, fmt.Errorf("note out of range: %v", s)
+	}
+
+	return uint8(key), nil
+}
+
+// ParseText reads a text message line like "480ms note_off ch1 C4".
+//
+// The leading offset is optional, in any time.ParseDuration unit.
+// Channels range ch1-ch16, and keys accept note names or numbers.
+// Comments begin with a # field, and blank lines report a nil message.
+func ParseText(line string) (time.Duration, midi.Message, error) {
+	fields := strings.Fields(line)
+
+	for i, field := range fields {
+		if strings.HasPrefix(field, "#") {
+			fields = fields[:i]
+			break
+		}
+	}
+
+	if len(fields) == 0 {
+		return 0, nil, nil
+	}
+
+	var offset time.Duration
+
+	if fields[0][0] >= '0' && fields[0][0] <= '9' {
+		d, err := time.ParseDuration(fields[0])
+
+		if err != nil {
+			return 0, nil, fmt.Errorf("invalid offset: %v", fields[0])
+		}
+
+		offset = d
+		fields = fields[1:]
+	}
+
+	if len(fields) == 0 {
+		return 0, nil, fmt.Errorf("missing message: %v", strings.TrimSpace(line))
+	}
+
+	msg, err := parseTextMessage(fields[0], fields[1:])
+
+	if err != nil {
+		return 0, nil, fmt.Errorf("invalid text message %q: %v", strings.Join(fields, " "), err)
+	}
+
+	return offset, msg, nil
+}
+
+// parseTextMessage assembles a message from its type name and arguments.
+func parseTextMessage(name string, args []string) (midi.Message, error) {
+	if name == TextRaw || name == textTypes[midi.SysExMsg] {
+		bs, _, err := ParseHexBytes(strings.Join(args, " "), false)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if len(bs) == 0 {
+			return nil, fmt.Errorf("missing bytes")
+		}
+
+		if name != TextRaw && (bs[0] != 0xF0 || bs[len(bs)-1] != 0xF7) {
+			return nil, fmt.Errorf("sysex requires F0 ... F7")
+		}
+
+		return midi.Message(bs), nil
+	}
+
+	var typ midi.Type
+
+	for t, n := range textTypes {
+		if n == name {
+			typ = t
+		}
+	}
+
+	var channel uint8
+	var values []int
+
+	if typ.Is(midi.ChannelMsg) {
+		if len(args) == 0 || !strings.HasPrefix(args[0], "ch") {
+			return nil, fmt.Errorf("missing channel")
+		}
+
+		n, err := strconv.Atoi(strings.TrimPrefix(args[0], "ch"))
+
+		if err != nil || n < 1 || n > 16 {
+			return nil, fmt.Errorf("invalid channel: %v", args[0])
+		}
+
+		channel = uint8(n - 1)
+		args = args[1:]
+	}
+
+	for i, arg := range args {
+		if i == 0 && (typ == midi.NoteOnMsg || typ == midi.NoteOffMsg || typ == midi.PolyAfterTouchMsg) {
+			key, err := ParseNote(arg)
+
+			if err != nil {
+				return nil, err
+			}
+
+			values = append(values, int(key))
+			continue
+		}
+
+		n, err := strconv.Atoi(arg)
+
+		if err != nil {
+			return nil, fmt.Errorf("invalid number: %v", arg)
+		}
+
+		values = append(values, n)
+	}
+
+	arity := func(min, max int) error {
+		if len(values) < min || len(values) > max {
+			return fmt.Errorf("%v takes %v to %v values", name, min, max)
+		}
+
+		return nil
+	}
+
+	var err error
+	var msg midi.Message
+
+	switch typ {
+	case midi.NoteOnMsg:
+		if err = arity(2, 2); err == nil {
+			msg = midi.NoteOn(channel, uint8(values[0]), uint8(values[1]))
+		}
+	case midi.NoteOffMsg:
+		if err = arity(1, 2); err == nil {
+			values = append(values, 0)
+			msg = midi.NoteOffVelocity(channel, uint8(values[0]), uint8(values[1]))
+		}
+	case midi.PolyAfterTouchMsg:
+		if err = arity(2, 2); err == nil {
+			msg = midi.PolyAfterTouch(channel, uint8(values[0]), uint8(values[1]))
+		}
+	case midi.ControlChangeMsg:
+		if err = arity(2, 2); err == nil {
+			msg = midi.ControlChange(channel, uint8(values[0]), uint8(values[1]))
+		}
+	case midi.AfterTouchMsg:
+		if err = arity(1, 1); err == nil {
+			msg = midi.AfterTouch(channel, uint8(values[0]))
+		}
+	case midi.ProgramChangeMsg:
+		if err = arity(1, 1); err == nil {
+			msg = midi.ProgramChange(channel, uint8(values[0]))
+		}
+	case midi.PitchBendMsg:
+		if err = arity(1, 1); err == nil {
+			if values[0] < -8192 || values[0] > 8191 {
+				return nil, fmt.Errorf("pitch bend out of range: %v", values[0])
+			}
+
+			msg = midi.Pitchbend(channel, int16(values[0]))
+		}
+	case midi.MTCMsg:
+		if err = arity(1, 1); err == nil {
+			msg = midi.MTC(uint8(values[0]))
+		}
+	case midi.SongSelectMsg:
+		if err = arity(1, 1); err == nil {
+			msg = midi.SongSelect(uint8(values[0]))
+		}
+	case midi.SPPMsg:
+		if err = arity(1, 1); err == nil {
+			msg = midi.SPP(uint16(values[0]))
+		}
+	case midi.TimingClockMsg:
+		msg, err = midi.TimingClock(), arity(0, 0)
+	case midi.TickMsg:
+		msg, err = midi.Tick(), arity(0, 0)
+	case midi.StartMsg:
+		msg, err = midi.Start(), arity(0, 0)
+	case midi.ContinueMsg:
+		msg, err = midi.Continue(), arity(0, 0)
+	case midi.StopMsg:
+		msg, err = midi.Stop(), arity(0, 0)
+	case midi.ActiveSenseMsg:
+		msg, err = midi.Activesense(), arity(0, 0)
+	case midi.ResetMsg:
+		msg, err = midi.Reset(), arity(0, 0)
+	case midi.TuneMsg:
+		msg, err = midi.Tune(), arity(0, 0)
+	default:
+		return nil, fmt.Errorf("unsupported message type: %v", name)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, value := range values {
+		switch typ {
+		case midi.PitchBendMsg:
+		case midi.SPPMsg:
+			if value < 0 || value > 16383 {
+				return nil, fmt.Errorf("song position out of range: %v", value)
+			}
+		default:
+			if value < 0 || value > 127 {
+				return nil, fmt.Errorf("value out of range: %v", value)
+			}
+		}
+	}
+
+	return msg, nil
+}
+
+// FormatText writes a message as a text line like "480ms note_off ch1 C4",
+// without a trailing newline. Offsets round down to milliseconds.
+// Messages outside the text vocabulary are written as raw hex bytes.
+func FormatText(offset time.Duration, msg midi.Message) string {
+	return fmt.Sprintf("%dms %v", offset.Milliseconds(), formatTextMessage(msg))
+}
+
+// formatTextMessage writes a message without its offset.
+func formatTextMessage(msg midi.Message) string {
+	var channel, key, value uint8
+	var relative int16
+	var absolute uint16
+
+	switch {
+	case msg.GetNoteOn(&channel, &key, &value):
+		return fmt.Sprintf("note_on ch%d %v %d", channel+1, midi.Note(key), value)
+	case msg.GetNoteOff(&channel, &key, &value):
+		if value == 0 {
+			return fmt.Sprintf("note_off ch%d %v", channel+1, midi.Note(key))
+		}
+
+		return fmt.Sprintf("note_off ch%d %v %d", channel+1, midi.Note(key), value)
+	case msg.GetPolyAfterTouch(&channel, &key, &value):
+		return fmt.Sprintf("poly_after_touch ch%d %v %d", channel+1, midi.Note(key), value)
+	case msg.GetControlChange(&channel, &key, &value):
+		return fmt.Sprintf("control_change ch%d %d %d", channel+1, key, value)
+	case msg.GetAfterTouch(&channel, &value):
+		return fmt.Sprintf("after_touch ch%d %d", channel+1, value)
+	case msg.GetProgramChange(&channel, &value):
+		return fmt.Sprintf("program_change ch%d %d", channel+1, value)
+	case msg.GetPitchBend(&channel, &relative, &absolute):
+		return fmt.Sprintf("pitch_bend ch%d %d", channel+1, relative)
+	case msg.GetMTC(&value):
+		return fmt.Sprintf("mtc %d", value)
+	case msg.GetSongSelect(&value):
+		return fmt.Sprintf("song_select %d", value)
+	case msg.GetSPP(&absolute):
+		return fmt.Sprintf("spp %d", absolute)
+	case msg.Is(midi.SysExMsg) && len(msg) > 1 && msg[len(msg)-1] == 0xF7:
+		return fmt.Sprintf("sysex % X", msg.Bytes())
+	}
+
+	if name, ok := textTypes[msg.Type()]; ok && len(msg) == 1 {
+		return name
+	}
+
+	return fmt.Sprintf("%v % X", TextRaw, msg.Bytes())
+}
+
+// TextRecorder writes messages as text lines,
+// with offsets counted from the first message.
+type TextRecorder struct {
+	mutex sync.Mutex
+
+	w io.Writer
+
+	start time.Time
+}
+
+// NewTextRecorder prepares a TextRecorder.
+func NewTextRecorder(w io.Writer) *TextRecorder {
+	return &TextRecorder{w: w}
+}
+
+// offset reports the time elapsed since the first message.
+func (o *TextRecorder) offset() time.Duration {
+	if o.start.IsZero() {
+		o.start = time.Now()
+	}
+
+	return time.Since(o.start)
+}
+
+// Write records a message.
+func (o *TextRecorder) Write(msg midi.Message) error {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	_, err := fmt.Fprintln(o.w, FormatText(o.offset(), msg))
+	return err
+}
+
+// Monitor records a monitored message,
+// annotated with its direction and port in a trailing comment.
+func (o *TextRecorder) Monitor(event MonitorEvent) error {
+	bs, _, err := ParseHexBytes(event.Bytes, false)
+
+	if err != nil {
+		return err
+	}
+
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+	_, err = fmt.Fprintf(o.w, "%v # %v %v\n", FormatText(o.offset(), midi.Message(bs)), event.Direction, event.Port)
+	return err
+}
@@ -0,0 +1,131 @@
+package octane_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/mcandre/octane"
+	"gitlab.com/gomidi/midi/v2"
+)
+
+func TestTextRoundTrip(t *testing.T) {
+	lines := map[string]midi.Message{
+		"0ms note_on ch1 C4 100":           midi.NoteOn(0, 48, 100),
+		"480ms note_off ch1 C4":            midi.NoteOff(0, 48),
+		"10ms note_off ch16 Db5 64":        midi.NoteOffVelocity(15, 61, 64),
+		"0ms poly_after_touch ch2 A0 10":   midi.PolyAfterTouch(1, 9, 10),
+		"0ms control_change ch3 74 127":    midi.ControlChange(2, 74, 127),
+		"0ms after_touch ch1 64":           midi.AfterTouch(0, 64),
+		"0ms program_change ch10 5":        midi.ProgramChange(9, 5),
+		"0ms pitch_bend ch1 -8192":         midi.Pitchbend(0, -8192),
+		"0ms sysex F0 43 10 4C 00 F7":      midi.SysEx([]byte{0x43, 0x10, 0x4C, 0x00}),
+		"0ms timing_clock":                 midi.TimingClock(),
+		"0ms start":                        midi.Start(),
+		"0ms spp 300":                      midi.SPP(300),
+		"0ms song_select 3":                midi.SongSelect(3),
+		"1500ms raw F4":                    midi.Message{0xF4},
+		"2000ms note_on ch1 Eb10 1":        midi.NoteOn(0, 123, 1),
+		"0ms control_change ch1 0 0":       midi.ControlChange(0, 0, 0),
+		"0ms poly_after_touch ch1 G10 127": midi.PolyAfterTouch(0, 127, 127),
+	}
+
+	for line, expected := range lines {
+		offset, msg, err := octane.ParseText(line)
+
+		if err != nil {
+			t.Errorf("%v: %v", line, err)
+			continue
+		}
+
+		if !bytes.Equal(msg, expected) {
+			t.Errorf("%v: expected % X, got % X", line, expected.Bytes(), msg.Bytes())
+		}
+
+		if formatted := octane.FormatText(offset, msg); formatted != line {
+			t.Errorf("expected %q, got %q", line, formatted)
+		}
+	}
+}
+
+func TestParseTextVariants(t *testing.T) {
+	lines := map[string]midi.Message{
+		"note_on ch1 60 100":             midi.NoteOn(0, 60, 100),
+		"0.5s note_on ch1 c#4 100":       midi.NoteOn(0, 49, 100),
+		"  note_off ch1 C4 # lift  ":     midi.NoteOff(0, 48),
+		"note_on ch1 Cb4 1":              midi.NoteOn(0, 47, 1),
+		"pitch_bend ch1 8191 # max bend": midi.Pitchbend(0, 8191),
+	}
+
+	for line, expected := range lines {
+		_, msg, err := octane.ParseText(line)
+
+		if err != nil {
+			t.Errorf("%v: %v", line, err)
+			continue
+		}
+
+		if !bytes.Equal(msg, expected) {
+			t.Errorf("%v: expected % X, got % X", line, expected.Bytes(), msg.Bytes())
+		}
+	}
+
+	offset, _, err := octane.ParseText("0.5s start")
+
+	if err != nil || offset != 500*time.Millisecond {
+		t.Errorf("expected 500ms offset, got %v (%v)", offset, err)
+	}
+
+	for _, line := range []string{"", "   ", "# comment"} {
+		if _, msg, err2 := octane.ParseText(line); err2 != nil || msg != nil {
+			t.Errorf("expected no message for %q, got %v (%v)", line, msg, err2)
+		}
+	}
+
+	for _, line := range []string{
+		"0ms",
+		"0xms start",
+		"note_on",
+		"note_on C4 100",
+		"note_on ch0 C4 100",
+		"note_on ch17 C4 100",
+		"note_on ch1 H4 100",
+		"note_on ch1 C11 100",
+		"note_on ch1 C4",
+		"note_on ch1 C4 128",
+		"control_change ch1 74 -1",
+		"pitch_bend ch1 8192",
+		"start now",
+		"sysex 43 10",
+		"raw",
+		"raw GG",
+		"bogus ch1 1",
+	} {
+		if _, _, err2 := octane.ParseText(line); err2 == nil {
+			t.Errorf("expected error for %q", line)
+		}
+	}
+}
+
+func TestTextRecorderMonitor(t *testing.T) {
+	var buf bytes.Buffer
+	recorder := octane.NewTextRecorder(&buf)
+
+	if err := recorder.Monitor(octane.NewMonitorEvent(octane.DirectionIn, "KeyStep", midi.NoteOn(0, 60, 100))); err != nil {
+		t.Fatal(err)
+	}
+
+	_, msg, err := octane.ParseText(buf.String())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(msg, midi.NoteOn(0, 60, 100)) {
+		t.Errorf("expected monitored line to replay, got %q", buf.String())
+	}
+
+	if expected := "0ms note_on ch1 C5 100 # in KeyStep\n"; buf.String() != expected {
+		t.Errorf("expected %q, got %q", expected, buf.String())
+	}
+}
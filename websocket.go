@@ -0,0 +1,441 @@
+package octane
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gitlab.com/gomidi/midi/v2"
+	"gitlab.com/gomidi/midi/v2/drivers"
+)
+
+// WebSocketIn names the virtual MIDI IN device for messages injected over WebSocket.
+const WebSocketIn = "websocket"
+
+// WebSocketMaxPayload denotes the largest WebSocket message accepted, in bytes.
+const WebSocketMaxPayload = 1 << 20
+
+// WebSocketVersion denotes the supported WebSocket protocol version, per RFC 6455.
+const WebSocketVersion = "13"
+
+// WebSocketCloseTimeout denotes how long to wait for a close frame to send.
+const WebSocketCloseTimeout = time.Second
+
+// webSocketGUID salts the WebSocket handshake, per RFC 6455.
+const webSocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// WebSocket frame opcodes.
+const (
+	opContinuation = 0x0
+	opText         = 0x1
+	opBinary       = 0x2
+	opClose        = 0x8
+	opPing         = 0x9
+	opPong         = 0xA
+)
+
+// WebSocket close status codes.
+const (
+	closeProtocolError = 1002
+	closeTooLarge      = 1009
+)
+
+// protocolError reports a client violating the WebSocket protocol.
+type protocolError struct {
+	// code denotes the close status code to reply with.
+	code uint16
+
+	message string
+}
+
+// Error describes the violation.
+func (o protocolError) Error() string {
+	return o.message
+}
+
+// frame models a WebSocket frame to send.
+type frame struct {
+	opcode byte
+
+	payload []byte
+}
+
+// writeFrame sends an unmasked, unfragmented server frame.
+func writeFrame(w io.Writer, f frame) error {
+	header := []byte{0x80 | f.opcode}
+
+	switch n := len(f.payload); {
+	case n < 126:
+		header = append(header, byte(n))
+	case n <= 0xFFFF:
+		header = append(header, 126)
+		header = binary.BigEndian.AppendUint16(header, uint16(n))
+	default:
+		header = append(header, 127)
+		header = binary.BigEndian.AppendUint64(header, uint64(n))
+	}
+
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+
+	_, err := w.Write(f.payload)
+	return err
+}
+
+// closeFrame prepares a close frame with a status code.
+func closeFrame(code uint16) frame {
+	return frame{opcode: opClose, payload: binary.BigEndian.AppendUint16(nil, code)}
+}
+
+// readFrame receives a client frame, unmasking the payload.
+// Clients must mask every frame.
+func readFrame(r io.Reader) (bool, byte, []byte, error) {
+	var header [2]byte
+
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return false, 0, nil, err
+	}
+
+	fin := header[0]&0x80 != 0
+	opcode := header[0] & 0x0F
+	masked := header[1]&0x80 != 0
+	n := uint64(header[1] & 0x7F)
+
+	switch n {
+	case 126:
+		var extended [2]byte
+
+		if _, err := io.ReadFull(r, extended[:]); err != nil {
+			return false, 0, nil, err
+		}
+
+		n = uint64(binary.BigEndian.Uint16(extended[:]))
+	case 127:
+		var extended [8]byte
+
+		if _, err := io.ReadFull(r, extended[:]); err != nil {
+			return false, 0, nil, err
+		}
+
+		n = binary.BigEndian.Uint64(extended[:])
+	}
+
+	if !masked {
+		return false, 0, nil, protocolError{code: closeProtocolError, message: "websocket client frame unmasked"}
+	}
+
+	if n > WebSocketMaxPayload {
+		return false, 0, nil, protocolError{code: closeTooLarge, message: fmt.Sprintf("websocket frame too large: %v bytes", n)}
+	}
+
+	var mask [4]byte
+
+	if _, err := io.ReadFull(r, mask[:]); err != nil {
+		return false, 0, nil, err
+	}
+
+	payload := make([]byte, n)
+
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return false, 0, nil, err
+	}
+
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+
+	return fin, opcode, payload, nil
+}
+
+// readMessage receives a complete data message, reassembling fragments,
+// or a close frame.
+// Ping frames are answered via control.
+func readMessage(r io.Reader, control chan<- frame) (byte, []byte, error) {
+	var opcode byte
+	var message []byte
+
+	for {
+		fin, op, payload, err := readFrame(r)
+
+		if err != nil {
+			return 0, nil, err
+		}
+
+		switch op {
+		case opPing:
+			select {
+			case control <- frame{opcode: opPong, payload: payload}:
+			default:
+			}
+
+			continue
+		case opPong:
+			continue
+		case opClose:
+			return opClose, payload, nil
+		case opContinuation:
+		default:
+			opcode = op
+			message = nil
+		}
+
+		message = append(message, payload...)
+
+		if len(message) > WebSocketMaxPayload {
+			return 0, nil, protocolError{code: closeTooLarge, message: fmt.Sprintf("websocket message too large: %v bytes", len(message))}
+		}
+
+		if fin {
+			return opcode, message, nil
+		}
+	}
+}
+
+// ParseChannels reads a comma separated list of channels (1-16).
+func ParseChannels(s string) ([]uint8, error) {
+	var channels []uint8
+
+	for _, field := range strings.Split(s, ",") {
+		channel, err := strconv.ParseUint(strings.TrimSpace(field), 10, 8)
+
+		if err != nil || channel < 1 || channel > 16 {
+			return nil, fmt.Errorf("invalid channel: %v", field)
+		}
+
+		channels = append(channels, uint8(channel))
+	}
+
+	return channels, nil
+}
+
+// webSocketClient models the per-client settings of a WebSocket bridge.
+type webSocketClient struct {
+	// raw selects binary frames of MIDI bytes, rather than JSON text frames.
+	raw bool
+
+	// channels filters published channel messages (1-16).
+	// Empty publishes all messages.
+	channels []uint8
+}
+
+// publishes reports whether the client receives a message.
+func (o webSocketClient) publishes(msg midi.Message) bool {
+	if len(o.channels) == 0 {
+		return true
+	}
+
+	var channel uint8
+
+	if !msg.GetChannel(&channel) {
+		return false
+	}
+
+	for _, c := range o.channels {
+		if c == channel+1 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// encode prepares a frame for a sent message.
+func (o webSocketClient) encode(event MonitorEvent, msg midi.Message) (frame, error) {
+	if o.raw {
+		return frame{opcode: opBinary, payload: msg}, nil
+	}
+
+	bs, err := json.Marshal(event)
+	return frame{opcode: opText, payload: bs}, err
+}
+
+// webSocket bridges an Engine to WebSocket clients.
+//
+// Clients receive transformed messages, and may inject messages
+// as if they arrived on the WebSocketIn MIDI IN device.
+//
+// Query parameters:
+//
+// format: json (default) for JSON text frames, or raw for binary frames of MIDI bytes.
+// channels: comma separated channels (1-16) to publish. Omitted publishes all messages.
+func (o api) webSocket(w http.ResponseWriter, r *http.Request) {
+	if !o.trusted(r) {
+		http.Error(w, fmt.Sprintf("cross-origin request from %v", r.Header.Get("Origin")), http.StatusForbidden)
+		return
+	}
+
+	var client webSocketClient
+
+	switch format := r.URL.Query().Get("format"); format {
+	case "", "json":
+	case "raw":
+		client.raw = true
+	default:
+		http.Error(w, fmt.Sprintf("unsupported format: %v", format), http.StatusBadRequest)
+		return
+	}
+
+	if s := r.URL.Query().Get("channels"); s != "" {
+		channels, err := ParseChannels(s)
+
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		client.channels = channels
+	}
+
+	key := r.Header.Get("Sec-WebSocket-Key")
+
+	if !strings.EqualFold(r.Header.Get("Upgrade"), "websocket") || key == "" {
+		http.Error(w, "websocket upgrade required", http.StatusBadRequest)
+		return
+	}
+
+	if r.Header.Get("Sec-WebSocket-Version") != WebSocketVersion {
+		w.Header().Set("Sec-WebSocket-Version", WebSocketVersion)
+		http.Error(w, "unsupported websocket version", http.StatusUpgradeRequired)
+		return
+	}
+
+	conn, rw, err := http.NewResponseController(w).Hijack()
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	defer conn.Close()
+
+	digest := sha1.Sum([]byte(key + webSocketGUID))
+	accept := base64.StdEncoding.EncodeToString(digest[:])
+
+	if _, err2 := fmt.Fprintf(rw, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %v\r\n\r\n", accept); err2 != nil {
+		return
+	}
+
+	if err2 := rw.Flush(); err2 != nil {
+		return
+	}
+
+	queue := make(chan frame, MonitorBufferSize)
+	control := make(chan frame, 1)
+	closing := make(chan frame, 1)
+	done := make(chan struct{})
+	written := make(chan struct{})
+
+	stop := o.engine.monitor(func(event MonitorEvent, msg midi.Message) {
+		if event.Direction != DirectionOut || !client.publishes(msg) {
+			return
+		}
+
+		f, err2 := client.encode(event, msg)
+
+		if err2 != nil {
+			return
+		}
+
+		select {
+		case queue <- f:
+		default:
+		}
+	})
+	defer stop()
+
+	go func() {
+		defer close(written)
+
+		for {
+			var f frame
+
+			select {
+			case <-done:
+				return
+			case f = <-closing:
+			case f = <-queue:
+			case f = <-control:
+			}
+
+			if err2 := writeFrame(conn, f); err2 != nil || f.opcode == opClose {
+				return
+			}
+		}
+	}()
+
+	defer close(done)
+
+	if reply, ok := o.receive(rw.Reader, control); ok {
+		if err2 := conn.SetWriteDeadline(time.Now().Add(WebSocketCloseTimeout)); err2 != nil {
+			return
+		}
+
+		closing <- reply
+		<-written
+	}
+}
+
+// receive injects messages from a WebSocket client until the connection closes,
+// returning the close frame to reply with, if any.
+func (o api) receive(r *bufio.Reader, control chan<- frame) (frame, bool) {
+	inject := func(bs []byte, _ int32) {
+		o.engine.Inject(WebSocketIn, midi.Message(append([]byte{}, bs...)))
+	}
+
+	reader := drivers.NewReader(drivers.ListenConfig{SysEx: true, SysExBufferSize: WebSocketMaxPayload}, inject)
+
+	for {
+		opcode, payload, err := readMessage(r, control)
+
+		if err != nil {
+			var protocolErr protocolError
+
+			if errors.As(err, &protocolErr) {
+				fmt.Fprintln(os.Stderr, err)
+				return closeFrame(protocolErr.code), true
+			}
+
+			if err != io.EOF {
+				fmt.Fprintln(os.Stderr, err)
+			}
+
+			return frame{}, false
+		}
+
+		// Echo the client's close status code.
+		if opcode == opClose {
+			return frame{opcode: opClose, payload: payload[:min(len(payload), 2)]}, true
+		}
+
+		if opcode == opText {
+			var event MonitorEvent
+
+			if err2 := json.Unmarshal(payload, &event); err2 != nil {
+				fmt.Fprintln(os.Stderr, err2)
+				continue
+			}
+
+			bs, _, err2 := ParseHexBytes(event.Bytes, false)
+
+			if err2 != nil {
+				fmt.Fprintln(os.Stderr, err2)
+				continue
+			}
+
+			payload = bs
+		}
+
+		reader.EachMessage(payload, 0)
+	}
+}
@@ -0,0 +1,261 @@
+package octane_test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mcandre/octane"
+	"gitlab.com/gomidi/midi/v2"
+	"gitlab.com/gomidi/midi/v2/drivers"
+)
+
+// dialWebSocket opens a WebSocket client connection, with optional extra header lines.
+func dialWebSocket(t *testing.T, server *httptest.Server, path string, headers ...string) (net.Conn, *bufio.Reader) {
+	conn, err := net.Dial("tcp", strings.TrimPrefix(server.URL, "http://"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err2 := fmt.Fprintf(conn, "GET %v HTTP/1.1\r\nHost: localhost\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\nSec-WebSocket-Version: 13\r\n%v\r\n", path, strings.Join(append(headers, ""), "\r\n")); err2 != nil {
+		t.Fatal(err2)
+	}
+
+	r := bufio.NewReader(conn)
+
+	for {
+		line, err2 := r.ReadString('\n')
+
+		if err2 != nil {
+			t.Fatal(err2)
+		}
+
+		if strings.HasPrefix(line, "HTTP/1.1 ") && !strings.HasPrefix(line, "HTTP/1.1 101") {
+			t.Fatalf("expected switching protocols, got %v", line)
+		}
+
+		if strings.HasPrefix(line, "Sec-WebSocket-Accept:") && strings.TrimSpace(strings.TrimPrefix(line, "Sec-WebSocket-Accept:")) != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+			t.Errorf("unexpected handshake: %v", line)
+		}
+
+		if line == "\r\n" {
+			return conn, r
+		}
+	}
+}
+
+// writeClientFrame sends a short masked frame.
+func writeClientFrame(t *testing.T, conn net.Conn, opcode byte, payload []byte) {
+	mask := []byte{1, 2, 3, 4}
+	bs := []byte{0x80 | opcode, 0x80 | byte(len(payload))}
+	bs = append(bs, mask...)
+
+	for i, b := range payload {
+		bs = append(bs, b^mask[i%4])
+	}
+
+	if _, err := conn.Write(bs); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// readServerFrame receives a short unmasked frame.
+func readServerFrame(t *testing.T, r *bufio.Reader) (byte, []byte) {
+	var header [2]byte
+
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		t.Fatal(err)
+	}
+
+	payload := make([]byte, header[1]&0x7F)
+
+	if _, err := io.ReadFull(r, payload); err != nil {
+		t.Fatal(err)
+	}
+
+	return header[0] & 0x0F, payload
+}
+
+func TestWebSocketBridge(t *testing.T) {
+	out := &fakeOut{name: "synth"}
+	engine, err := octane.NewEngine(octane.Config{TransposeNote: 12}, []drivers.Out{out})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewServer(octane.NewAPIHandler(engine, nil))
+	defer server.Close()
+
+	jsonConn, jsonReader := dialWebSocket(t, server, "/ws?channels=1")
+	defer jsonConn.Close()
+
+	rawConn, rawReader := dialWebSocket(t, server, "/ws?format=raw")
+	defer rawConn.Close()
+
+	writeClientFrame(t, jsonConn, 0x1, []byte(`{"bytes": "90 3C 64"}`))
+
+	if err2 := jsonConn.SetReadDeadline(time.Now().Add(time.Second)); err2 != nil {
+		t.Fatal(err2)
+	}
+
+	opcode, payload := readServerFrame(t, jsonReader)
+
+	if opcode != 0x1 {
+		t.Fatalf("expected text frame, got opcode %v", opcode)
+	}
+
+	var event octane.MonitorEvent
+
+	if err2 := json.Unmarshal(payload, &event); err2 != nil {
+		t.Fatal(err2)
+	}
+
+	expected := octane.NewMonitorEvent(octane.DirectionOut, "synth", midi.NoteOn(0, 72, 100))
+
+	if event != expected {
+		t.Errorf("expected %v, got %v", expected, event)
+	}
+
+	// Running status carries the second note on.
+	writeClientFrame(t, rawConn, 0x2, []byte{0x91, 60, 100, 62, 100})
+
+	if err2 := rawConn.SetReadDeadline(time.Now().Add(time.Second)); err2 != nil {
+		t.Fatal(err2)
+	}
+
+	var raws []string
+
+	for range 3 {
+		opcode, payload = readServerFrame(t, rawReader)
+
+		if opcode != 0x2 {
+			t.Fatalf("expected binary frame, got opcode %v", opcode)
+		}
+
+		raws = append(raws, midi.Message(payload).String())
+	}
+
+	expectedRaws := []string{
+		midi.NoteOn(0, 72, 100).String(),
+		midi.NoteOn(1, 72, 100).String(),
+		midi.NoteOn(1, 74, 100).String(),
+	}
+
+	for i, raw := range expectedRaws {
+		if raws[i] != raw {
+			t.Errorf("expected %v, got %v", raw, raws[i])
+		}
+	}
+}
+
+func TestWebSocketHandshake(t *testing.T) {
+	engine, err := octane.NewEngine(octane.Config{}, []drivers.Out{&fakeOut{name: "synth"}})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewServer(octane.NewAPIHandler(engine, nil, "http://localhost:3000"))
+	defer server.Close()
+
+	conn, _ := dialWebSocket(t, server, "/ws", "Origin: http://localhost:3000")
+	conn.Close()
+
+	for _, tc := range []struct {
+		origin  string
+		version string
+		code    int
+	}{
+		{origin: "http://evil.example", version: "13", code: http.StatusForbidden},
+		// Requests name their host as example.com, as if rebound to the API.
+		{origin: "http://example.com", version: "13", code: http.StatusForbidden},
+		{version: "8", code: http.StatusUpgradeRequired},
+	} {
+		request := httptest.NewRequest(http.MethodGet, "/ws", nil)
+		request.Header.Set("Upgrade", "websocket")
+		request.Header.Set("Connection", "Upgrade")
+		request.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+		request.Header.Set("Sec-WebSocket-Version", tc.version)
+
+		if tc.origin != "" {
+			request.Header.Set("Origin", tc.origin)
+		}
+
+		recorder := httptest.NewRecorder()
+		octane.NewAPIHandler(engine, nil).ServeHTTP(recorder, request)
+
+		if recorder.Code != tc.code {
+			t.Errorf("expected %v for %+v, got %v", tc.code, tc, recorder.Code)
+		}
+	}
+}
+
+func TestWebSocketClose(t *testing.T) {
+	engine, err := octane.NewEngine(octane.Config{}, []drivers.Out{&fakeOut{name: "synth"}})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewServer(octane.NewAPIHandler(engine, nil))
+	defer server.Close()
+
+	// The server echoes the client's close status code.
+	conn, r := dialWebSocket(t, server, "/ws")
+	defer conn.Close()
+	writeClientFrame(t, conn, 0x8, []byte{0x03, 0xE8})
+
+	if err2 := conn.SetReadDeadline(time.Now().Add(time.Second)); err2 != nil {
+		t.Fatal(err2)
+	}
+
+	if opcode, payload := readServerFrame(t, r); opcode != 0x8 || !bytes.Equal(payload, []byte{0x03, 0xE8}) {
+		t.Errorf("expected close 1000, got opcode %v payload %v", opcode, payload)
+	}
+
+	// Unmasked client frames close the connection with a protocol error.
+	conn2, r2 := dialWebSocket(t, server, "/ws")
+	defer conn2.Close()
+
+	if _, err2 := conn2.Write([]byte{0x82, 0x03, 0x90, 60, 100}); err2 != nil {
+		t.Fatal(err2)
+	}
+
+	if err2 := conn2.SetReadDeadline(time.Now().Add(time.Second)); err2 != nil {
+		t.Fatal(err2)
+	}
+
+	if opcode, payload := readServerFrame(t, r2); opcode != 0x8 || !bytes.Equal(payload, []byte{0x03, 0xEA}) {
+		t.Errorf("expected close 1002, got opcode %v payload %v", opcode, payload)
+	}
+
+	if status := engine.Status(); status.Received != 0 {
+		t.Errorf("expected unmasked message to be dropped, got %v received", status.Received)
+	}
+}
+
+func TestParseChannels(t *testing.T) {
+	channels, err := octane.ParseChannels("1, 16")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(channels) != 2 || channels[0] != 1 || channels[1] != 16 {
+		t.Errorf("expected [1 16], got %v", channels)
+	}
+
+	if _, err2 := octane.ParseChannels("0"); err2 == nil {
+		t.Errorf("expected error for channel 0")
+	}
+}